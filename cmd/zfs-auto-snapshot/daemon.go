@@ -0,0 +1,241 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"zfstools-go/internal/cli"
+	"zfstools-go/internal/config"
+	"zfstools-go/internal/lock"
+	"zfstools-go/internal/schedule"
+	"zfstools-go/internal/zfs"
+	"zfstools-go/internal/zfstools"
+)
+
+// poolWorkers runs the jobs of each pool one after the other, and those of different pools side by side
+type poolWorkers struct {
+	queues map[string]chan func()
+	// pending are the pool and interval of the jobs which are queued but haven't started
+	pending   map[[2]string]bool
+	size      int
+	mutex     sync.Mutex
+	waitGroup sync.WaitGroup
+}
+
+// newPoolWorkers returns workers which queue up to size jobs for each pool
+func newPoolWorkers(size int) *poolWorkers {
+	return &poolWorkers{
+		queues:  map[string]chan func(){},
+		pending: map[[2]string]bool{},
+		size:    size,
+	}
+}
+
+// submit queues job, taking the snapshots of interval in pool, to run once the jobs of pool before it have. It
+// returns false, without queueing it, when a job of the same interval is still waiting to start.
+func (w *poolWorkers) submit(pool, interval string, job func()) bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	key := [2]string{pool, interval}
+	if w.pending[key] {
+		return false
+	}
+
+	queue, ok := w.queues[pool]
+	if !ok {
+		queue = make(chan func(), w.size)
+		w.queues[pool] = queue
+
+		w.waitGroup.Add(1)
+
+		go func() {
+			defer w.waitGroup.Done()
+
+			for job := range queue {
+				job()
+			}
+		}()
+	}
+
+	if len(queue) == cap(queue) {
+		return false
+	}
+
+	w.pending[key] = true
+	queue <- func() {
+		w.mutex.Lock()
+		delete(w.pending, key)
+		w.mutex.Unlock()
+
+		job()
+	}
+
+	return true
+}
+
+// background runs fn alongside the jobs, stop waits for it too
+func (w *poolWorkers) background(fn func()) {
+	w.waitGroup.Add(1)
+
+	go func() {
+		defer w.waitGroup.Done()
+
+		fn()
+	}()
+}
+
+// stop waits for the queued jobs to be run, and for those run in the background
+func (w *poolWorkers) stop() {
+	w.mutex.Lock()
+
+	for _, queue := range w.queues {
+		close(queue)
+	}
+
+	w.mutex.Unlock()
+
+	w.waitGroup.Wait()
+}
+
+// runPool takes the snapshots of pool once the other runs on it are done, returning the exit status and why the run
+// was interrupted, if it was
+func runPool(
+	ctx context.Context,
+	client *zfs.Client,
+	cfg config.Config,
+	pool string,
+	options cli.RunOptions,
+) (int, error) {
+	poolLock, err := zfstools.LockPools(ctx, client, cfg, lock.DefaultDir, pool, options.LockWait)
+	if cli.Failed(os.Stderr, "locking pool "+pool, err) {
+		return 1, cli.Cause(ctx)
+	}
+
+	defer func() { _ = poolLock.Release() }()
+
+	if cfg.Verbose {
+		fmt.Printf("Taking %s snapshots of %s\n", cfg.Interval, pool) //nolint:forbidigo
+	}
+
+	// a run under way is finished when the daemon is stopped, unless it takes too long
+	runCtx, cancel := context.WithoutCancel(ctx), context.CancelFunc(func() {})
+	if options.Timeout > 0 {
+		runCtx, cancel = context.WithTimeoutCause(runCtx, options.Timeout,
+			fmt.Errorf("%w after %s", cli.ErrTimedOut, options.Timeout))
+	}
+
+	defer cancel()
+
+	return autoSnapshot(runCtx, client, cfg, pool), cli.Cause(runCtx)
+}
+
+// startRun queues a run of entry for pool, or for each pool when it is empty. The run reports, as one, once each
+// pool is done. Runs queued when ctx is done are skipped, those under way are finished.
+func startRun(
+	ctx context.Context,
+	client *zfs.Client,
+	cfg config.Config,
+	pool string,
+	entry schedule.Entry,
+	options cli.RunOptions,
+	workers *poolWorkers,
+) {
+	cfg.Timestamp = time.Now()
+	cfg.Interval = entry.Interval
+	cfg.Keep = entry.Keep
+	cfg.KeepGiven = !entry.KeepFromFile
+	cfg.KeepAge = entry.KeepAge
+
+	pools, err := zfstools.PoolNames(ctx, client, cfg, pool)
+	if cli.Failed(os.Stderr, "starting "+cfg.Interval+" snapshots", err) {
+		return
+	}
+
+	events, metrics := cli.NewReporters(&cfg, options.JSONOutput, options.MetricsFile != "")
+
+	var run sync.WaitGroup
+
+	var mutex sync.Mutex
+
+	status := 0
+
+	var interrupted error
+
+	for _, name := range pools {
+		run.Add(1)
+
+		queued := workers.submit(name, cfg.Interval, func() {
+			defer run.Done()
+
+			if ctx.Err() != nil {
+				return
+			}
+
+			poolStatus, cause := runPool(ctx, client, cfg, name, options)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			status = max(status, poolStatus)
+			interrupted = cmp.Or(interrupted, cause)
+		})
+		if !queued {
+			run.Done()
+
+			_, _ = fmt.Fprintf(os.Stderr, "Skipping %s snapshots of %s: the last ones haven't started yet\n",
+				cfg.Interval, name)
+		}
+	}
+
+	workers.background(func() {
+		run.Wait()
+
+		status = cli.WriteMetrics(metrics, options.MetricsFile, cfg.Interval, status)
+
+		if events != nil {
+			events.Finish(cfg.Interval, cfg.DryRun, status, interrupted)
+		}
+	})
+}
+
+// daemon takes the snapshots of each entry of the schedule at its times, until ctx is done, and then waits for the
+// runs under way to finish. The runs of a pool are taken one at a time. An entry which was due while the host was
+// suspended is run once it resumes.
+func daemon(
+	ctx context.Context,
+	client *zfs.Client,
+	cfg config.Config,
+	pool string,
+	entries []schedule.Entry,
+	options cli.RunOptions,
+) int {
+	due := schedule.New(entries, time.Now())
+	workers := newPoolWorkers(len(entries))
+
+	for {
+		// timers don't count the time the host is suspended, so the clock is checked at least every minute
+		wait := time.Minute
+		if next := due.Next(); !next.IsZero() {
+			wait = max(min(wait, time.Until(next)), 0)
+		}
+
+		select {
+		case <-ctx.Done():
+			_, _ = fmt.Fprintf(os.Stderr, "Stopping, %v: waiting for the snapshots under way\n", context.Cause(ctx))
+
+			workers.stop()
+
+			return 0
+		case <-time.After(wait):
+		}
+
+		for _, entry := range due.Due(time.Now()) {
+			startRun(ctx, client, cfg, pool, entry, options, workers)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestPoolWorkers(t *testing.T) {
+	t.Parallel()
+
+	workers := newPoolWorkers(4)
+
+	var mutex sync.Mutex
+
+	var ran []string
+
+	record := func(name string) func() {
+		return func() {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			ran = append(ran, name)
+		}
+	}
+
+	// hold up tank until its later jobs are queued
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	if !workers.submit("tank", "daily", func() {
+		close(started)
+		<-release
+		record("tank daily")()
+	}) {
+		t.Fatal("submit() didn't queue the first job")
+	}
+
+	<-started
+
+	queued := []bool{
+		workers.submit("tank", "hourly", record("tank hourly")),
+		workers.submit("tank", "frequent", record("tank frequent 1")),
+		// the last frequent run hasn't started yet
+		workers.submit("tank", "frequent", record("tank frequent 2")),
+		// but another pool's has nothing to do with it
+		workers.submit("backup", "frequent", record("backup frequent")),
+	}
+
+	if !slices.Equal(queued, []bool{true, true, false, true}) {
+		t.Errorf("submit() = %v", queued)
+	}
+
+	close(release)
+	workers.stop()
+
+	var tank []string
+
+	for _, name := range ran {
+		if name != "backup frequent" {
+			tank = append(tank, name)
+		}
+	}
+
+	if !slices.Equal(tank, []string{"tank daily", "tank hourly", "tank frequent 1"}) || len(ran) != 4 {
+		t.Errorf("ran %v", ran)
+	}
+}
@@ -1,16 +1,21 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
-	"strconv"
 	"time"
 	_ "time/tzdata"
 
 	"github.com/spf13/pflag"
 
+	"zfstools-go/internal/cli"
 	"zfstools-go/internal/config"
+	"zfstools-go/internal/coordinator"
+	"zfstools-go/internal/lock"
+	"zfstools-go/internal/schedule"
+	"zfstools-go/internal/zfs"
 	"zfstools-go/internal/zfstools"
 )
 
@@ -20,16 +25,40 @@ var (
 )
 
 func usageWriter(writer io.Writer, name string) {
-	_, _ = fmt.Fprintf(writer, "Usage: %s [-dknpuv] <INTERVAL> <KEEP>\n", name)
+	_, _ = fmt.Fprintf(writer, "Usage: %s [-bdknuv] [-p[=n]] [-c file] <INTERVAL> [<KEEP>]\n", name)
+	_, _ = fmt.Fprintf(writer, "       %s --daemon [-bdknuv] [-p[=n]] [-c file] [--schedule file]\n", name)
+	_, _ = fmt.Fprintln(writer, "    -b              Bookmark expired snapshots before destroying them.")
+	_, _ = fmt.Fprintln(writer, "    -c file         Read the configuration from file (default "+config.DefaultPath+").")
 	_, _ = fmt.Fprintln(writer, "    -d              Show debug output.")
 	_, _ = fmt.Fprintln(writer, "    -k              Keep zero-sized snapshots.")
 	_, _ = fmt.Fprintln(writer, "    -n              Do a dry-run. Nothing is committed. Only show what would be done.")
-	_, _ = fmt.Fprintln(writer, "    -p              Create snapshots in parallel.")
+	_, _ = fmt.Fprintln(writer, "    -p[=n]          Run up to n zfs commands at once on each pool, one per CPU for a bare -p (default 1).") //nolint:lll
 	_, _ = fmt.Fprintln(writer, "    -P pool         Act only on the specified pool.")
 	_, _ = fmt.Fprintln(writer, "    -u              Use UTC for snapshots.")
 	_, _ = fmt.Fprintln(writer, "    -v              Show what is being done.")
+	_, _ = fmt.Fprintln(writer, "    --timeout dur   Give up and kill running zfs commands after dur (e.g. 10m).")
+	_, _ = fmt.Fprintln(writer, "    --json          Write each action and a summary of the run as JSON lines.")
+	_, _ = fmt.Fprintln(writer, "    --lock-wait dur Give up after dur when other runs on the pools haven't finished.")
+	_, _ = fmt.Fprintln(writer, "    --no-wait       Give up at once when other runs on the pools haven't finished.")
+	_, _ = fmt.Fprintln(writer, "    --metrics-file file")
+	_, _ = fmt.Fprintln(writer, "                    Write metrics of the run to file for the node_exporter textfile collector.") //nolint:lll
+	_, _ = fmt.Fprintln(writer, "    --keep-bookmarks n")
+	_, _ = fmt.Fprintln(writer, "                    Keep only the newest n bookmarks of the interval (default all).")
+	_, _ = fmt.Fprintln(writer, "    --hook-timeout dur")
+	_, _ = fmt.Fprintln(writer, "                    Kill snapshot hooks which run for longer than dur (default 5m).")
+	_, _ = fmt.Fprintln(writer, "    --hooks-dir dir Run only the hooks in dir (default "+zfs.DefaultHooksDir+").")
+	_, _ = fmt.Fprintln(writer, "    --channel-program")
+	_, _ = fmt.Fprintln(writer, "                    Create and destroy snapshots with zfs channel programs, where supported.") //nolint:lll
+	_, _ = fmt.Fprintln(writer, "    --daemon        Keep running, taking the snapshots of the schedule at their times.")
+	_, _ = fmt.Fprintln(writer, "    --schedule file")
+	_, _ = fmt.Fprintln(writer, "                    Read the daemon's schedule from file (default "+schedule.DefaultPath+").") //nolint:lll
+	_, _ = fmt.Fprintln(writer, "    --print-config  Print the configuration merged from the file and flags, and exit.")
+	_, _ = fmt.Fprintln(writer, "    --mysql-dsn dsn Connect to MySQL with dsn to lock mysql datasets (default as in my.cnf).") //nolint:lll
+	_, _ = fmt.Fprintln(writer, "    --postgres-dsn dsn")
+	_, _ = fmt.Fprintln(writer, "                    Connect to PostgreSQL with dsn to back up postgresql datasets.")
 	_, _ = fmt.Fprintln(writer, "    INTERVAL        The interval to snapshot.")
-	_, _ = fmt.Fprintln(writer, "    KEEP            How many snapshots to keep.")
+	_, _ = fmt.Fprintln(writer, "    KEEP            How many snapshots to keep, or how long for (e.g. 36h, 7d).")
+	_, _ = fmt.Fprintln(writer, "                    Defaults to the keep of INTERVAL in the configuration file.")
 }
 
 func usage() {
@@ -43,26 +72,194 @@ func version(writer io.Writer) {
 	os.Exit(0)
 }
 
-func main() {
+// autoSnapshot creates the new snapshots and cleans up the expired ones, returning the exit status
+func autoSnapshot(ctx context.Context, client *zfs.Client, cfg config.Config, pool string) int {
+	datasets, err := zfstools.FindEligibleDatasets(ctx, client, cfg, pool)
+	if cli.Interrupted(ctx, os.Stderr, "finding eligible datasets") ||
+		cli.Failed(os.Stderr, "finding eligible datasets", err) {
+		return 1
+	}
+
+	status := 0
+
+	if cfg.Keep > 0 || cfg.KeepAge > 0 {
+		err = zfstools.DoNewSnapshots(ctx, client, cfg, datasets)
+		if cli.Interrupted(ctx, os.Stderr, "creating snapshots") {
+			return 1
+		}
+
+		// expired snapshots are still cleaned up when some could not be created
+		if cli.Failed(os.Stderr, "creating snapshots", err) {
+			status = 1
+		}
+	}
+
+	err = zfstools.CleanupExpiredSnapshots(ctx, client, cfg, pool, datasets)
+	if cli.Interrupted(ctx, os.Stderr, "destroying expired snapshots") ||
+		cli.Failed(os.Stderr, "destroying expired snapshots", err) {
+		return 1
+	}
+
+	return status
+}
+
+// newClient returns a client which runs hooks and coordinates databases as configured
+func newClient(hookTimeout time.Duration, hooksDir, mysqlDSN, postgresDSN string) *zfs.Client {
+	client := zfs.NewClient(zfs.CommandExecutor{})
+	client.SetHookTimeout(hookTimeout)
+	client.SetHooksDir(hooksDir)
+	client.SetCoordinator("mysql", coordinator.NewMySQL(mysqlDSN))
+	client.SetCoordinator("postgresql", coordinator.NewPostgres(postgresDSN))
+
+	return client
+}
+
+// parseArgs sets the interval and what to keep of cfg from the INTERVAL and KEEP arguments, KEEP defaulting to
+// that of the interval in the configuration file. It returns false when they are missing.
+func parseArgs(cfg *config.Config, file config.File, args []string) (bool, error) {
+	if len(args) == 0 {
+		return false, nil
+	}
+
+	keep, ok := file.Keep[args[0]]
+
+	// a KEEP argument wins over the keep of the pools in the configuration file too
+	cfg.KeepGiven = len(args) > 1
+	if cfg.KeepGiven {
+		keep, ok = args[1], true
+	}
+
+	if !ok {
+		return false, nil
+	}
+
 	var err error
 
+	cfg.Interval = args[0]
+
+	cfg.Keep, cfg.KeepAge, err = config.ParseKeep(keep)
+	if err != nil {
+		return false, err //nolint:wrapcheck
+	}
+
+	return true, nil
+}
+
+// configure applies the configuration file, and then the arguments, to cfg. With printConfig it prints the result
+// and exits. It returns the configuration file, and false when INTERVAL or KEEP is missing.
+func configure(cfg *config.Config, jsonOutput *bool, printConfig bool) (config.File, bool) {
+	file, err := cli.LoadConfig(pflag.CommandLine, map[string]string{
+		"snapshot_prefix": "snapshot-prefix",
+		"utc":             "utc",
+		"parallel":        "parallel-snapshots",
+		"output":          "json",
+	}, cfg, jsonOutput)
+
+	hasArgs := false
+	if err == nil {
+		hasArgs, err = parseArgs(cfg, file, pflag.Args())
+	}
+
+	if err == nil && printConfig {
+		err = file.Effective(*cfg, *jsonOutput).Write(os.Stdout)
+		if err == nil {
+			os.Exit(0)
+		}
+	}
+
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+
+		os.Exit(1)
+	}
+
+	return file, hasArgs
+}
+
+// startDaemon reads the schedule, taking the keep of the lines which leave it out from that of the configuration
+// file, and runs the daemon until it is told to stop, returning the exit status
+func startDaemon(
+	client *zfs.Client,
+	cfg config.Config,
+	file config.File,
+	pool, scheduleFile string,
+	options cli.RunOptions,
+) int {
+	entries, err := schedule.ParseFile(scheduleFile, file.Keep)
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+
+		return 1
+	}
+
+	// only the time between runs is unbounded, each run is given the timeout
+	ctx, cancel := cli.Context(0)
+	defer cancel()
+
+	return daemon(ctx, client, cfg, pool, entries, options)
+}
+
+// runOnce takes the snapshots of the interval once the other runs on the pools are done, returning the exit status
+func runOnce(client *zfs.Client, cfg config.Config, pool string, options cli.RunOptions) int {
+	return cli.RunOnce(client, cfg, pool, options, func(ctx context.Context, cfg config.Config) int {
+		return autoSnapshot(ctx, client, cfg, pool)
+	})
+}
+
+func main() {
 	var pool string
 
+	var options cli.RunOptions
+
+	var noWait bool
+
 	var keepZeroSized bool
 
+	var hookTimeout time.Duration
+
+	var hooksDir string
+
+	var channelPrograms bool
+
+	var runDaemon bool
+
+	var scheduleFile string
+
+	var printConfig bool
+
+	var mysqlDSN string
+
+	var postgresDSN string
+
 	cfg := config.Config{
 		Timestamp:              time.Now(),
 		ShouldDestroyZeroSized: true,
 	}
 
 	pflag.BoolVarP(&cfg.UseUTC, "utc", "u", false, "")
+	pflag.BoolVarP(&cfg.Bookmark, "bookmark", "b", false, "")
 	pflag.BoolVarP(&keepZeroSized, "keep-zero-sized-snapshots", "k", false, "")
-	pflag.BoolVarP(&cfg.UseThreads, "parallel-snapshots", "p", false, "")
+	cli.ParallelFlag(pflag.CommandLine, &cfg.Parallelism, "parallel-snapshots")
 	pflag.StringVarP(&pool, "pool", "P", "", "")
 	pflag.BoolVarP(&cfg.DryRun, "dry-run", "n", false, "")
 	pflag.BoolVarP(&cfg.Verbose, "verbose", "v", false, "")
 	pflag.BoolVarP(&cfg.Debug, "debug", "d", false, "")
 	pflag.StringVarP(&cfg.SnapshotPrefix, "snapshot-prefix", "s", "zfs-auto-snap", "")
+	pflag.DurationVar(&options.Timeout, "timeout", 0, "")
+	pflag.BoolVar(&options.JSONOutput, "json", false, "")
+	pflag.StringVar(&options.MetricsFile, "metrics-file", "", "")
+	pflag.DurationVar(&options.LockWait, "lock-wait", lock.WaitForever, "")
+	pflag.BoolVar(&noWait, "no-wait", false, "")
+	pflag.IntVar(&cfg.KeepBookmarks, "keep-bookmarks", 0, "")
+	pflag.DurationVar(&hookTimeout, "hook-timeout", zfs.DefaultHookTimeout, "")
+	pflag.StringVar(&hooksDir, "hooks-dir", zfs.DefaultHooksDir, "")
+	pflag.BoolVar(&channelPrograms, "channel-program", false, "")
+	pflag.BoolVar(&runDaemon, "daemon", false, "")
+	pflag.StringVar(&scheduleFile, "schedule", schedule.DefaultPath, "")
+	pflag.StringP("config", "c", config.DefaultPath, "")
+	pflag.BoolVar(&printConfig, "print-config", false, "")
+	pflag.StringVar(&mysqlDSN, "mysql-dsn", coordinator.DefaultMySQLDSN, "")
+	pflag.StringVar(&postgresDSN, "postgres-dsn", coordinator.DefaultPostgresDSN, "")
 	pflag.Usage = usage
 	showVersion := pflag.BoolP("version", "", false, "Print version information and exit")
 
@@ -76,27 +273,22 @@ func main() {
 		cfg.ShouldDestroyZeroSized = false
 	}
 
-	args := pflag.Args()
-	if len(args) < 2 {
-		usage()
+	if noWait {
+		options.LockWait = 0
 	}
 
-	cfg.Interval = args[0]
+	file, hasArgs := configure(&cfg, &options.JSONOutput, printConfig)
 
-	var keepInt int64
+	client := newClient(hookTimeout, hooksDir, mysqlDSN, postgresDSN)
+	client.SetChannelPrograms(channelPrograms)
 
-	keepInt, err = strconv.ParseInt(args[1], 10, 0)
-	if err != nil {
-		cfg.Keep = 0
-	} else {
-		cfg.Keep = int(keepInt)
+	if runDaemon {
+		os.Exit(startDaemon(client, cfg, file, pool, scheduleFile, options))
 	}
 
-	datasets := zfstools.FindEligibleDatasets(cfg, pool)
-
-	if cfg.Keep > 0 {
-		zfstools.DoNewSnapshots(cfg, datasets)
+	if !hasArgs {
+		usage()
 	}
 
-	zfstools.CleanupExpiredSnapshots(cfg, pool, datasets)
+	os.Exit(runOnce(client, cfg, pool, options))
 }
@@ -3,6 +3,8 @@ package main
 import (
 	"bytes"
 	"testing"
+
+	"zfstools-go/internal/config"
 )
 
 func Test_usageWriter(t *testing.T) {
@@ -18,16 +20,40 @@ func Test_usageWriter(t *testing.T) {
 		{
 			name: "simple",
 			args: args{name: "/usr/local/sbin/zfs-auto-snapshot"},
-			wantWriter: `Usage: /usr/local/sbin/zfs-auto-snapshot [-dknpuv] <INTERVAL> <KEEP>
+			wantWriter: `Usage: /usr/local/sbin/zfs-auto-snapshot [-bdknuv] [-p[=n]] [-c file] <INTERVAL> [<KEEP>]
+       /usr/local/sbin/zfs-auto-snapshot --daemon [-bdknuv] [-p[=n]] [-c file] [--schedule file]
+    -b              Bookmark expired snapshots before destroying them.
+    -c file         Read the configuration from file (default /usr/local/etc/zfstools.conf).
     -d              Show debug output.
     -k              Keep zero-sized snapshots.
     -n              Do a dry-run. Nothing is committed. Only show what would be done.
-    -p              Create snapshots in parallel.
+    -p[=n]          Run up to n zfs commands at once on each pool, one per CPU for a bare -p (default 1).
     -P pool         Act only on the specified pool.
     -u              Use UTC for snapshots.
     -v              Show what is being done.
+    --timeout dur   Give up and kill running zfs commands after dur (e.g. 10m).
+    --json          Write each action and a summary of the run as JSON lines.
+    --lock-wait dur Give up after dur when other runs on the pools haven't finished.
+    --no-wait       Give up at once when other runs on the pools haven't finished.
+    --metrics-file file
+                    Write metrics of the run to file for the node_exporter textfile collector.
+    --keep-bookmarks n
+                    Keep only the newest n bookmarks of the interval (default all).
+    --hook-timeout dur
+                    Kill snapshot hooks which run for longer than dur (default 5m).
+    --hooks-dir dir Run only the hooks in dir (default /usr/local/etc/zfstools/hooks).
+    --channel-program
+                    Create and destroy snapshots with zfs channel programs, where supported.
+    --daemon        Keep running, taking the snapshots of the schedule at their times.
+    --schedule file
+                    Read the daemon's schedule from file (default /usr/local/etc/zfs-auto-snapshot.schedule).
+    --print-config  Print the configuration merged from the file and flags, and exit.
+    --mysql-dsn dsn Connect to MySQL with dsn to lock mysql datasets (default as in my.cnf).
+    --postgres-dsn dsn
+                    Connect to PostgreSQL with dsn to back up postgresql datasets.
     INTERVAL        The interval to snapshot.
-    KEEP            How many snapshots to keep.
+    KEEP            How many snapshots to keep, or how long for (e.g. 36h, 7d).
+                    Defaults to the keep of INTERVAL in the configuration file.
 `,
 		},
 	}
@@ -48,3 +74,56 @@ func Test_usageWriter(t *testing.T) {
 		})
 	}
 }
+
+func Test_parseArgs(t *testing.T) {
+	t.Parallel()
+
+	file := config.File{Keep: map[string]string{"hourly": "24"}}
+
+	tests := []struct {
+		name          string
+		args          []string
+		want          bool
+		wantKeep      int
+		wantKeepGiven bool
+	}{
+		{
+			name: "none",
+		},
+		{
+			name:     "fileKeep",
+			args:     []string{"hourly"},
+			want:     true,
+			wantKeep: 24,
+		},
+		{
+			name: "noKeep",
+			args: []string{"daily"},
+		},
+		{
+			name:          "keep",
+			args:          []string{"hourly", "12"},
+			want:          true,
+			wantKeep:      12,
+			wantKeepGiven: true,
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			var cfg config.Config
+
+			got, err := parseArgs(&cfg, file, testCase.args)
+			if err != nil {
+				t.Fatalf("parseArgs() error = %v", err)
+			}
+
+			if got != testCase.want || cfg.Keep != testCase.wantKeep || cfg.KeepGiven != testCase.wantKeepGiven {
+				t.Errorf("parseArgs() = %v, Keep %d, KeepGiven %v, want %v, %d, %v", got, cfg.Keep, cfg.KeepGiven,
+					testCase.want, testCase.wantKeep, testCase.wantKeepGiven)
+			}
+		})
+	}
+}
@@ -1,16 +1,19 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
-	"strings"
 	"time"
 	_ "time/tzdata"
 
 	"github.com/spf13/pflag"
 
+	"zfstools-go/internal/cli"
 	"zfstools-go/internal/config"
+	"zfstools-go/internal/lock"
+	"zfstools-go/internal/report"
 	"zfstools-go/internal/zfs"
 	"zfstools-go/internal/zfstools"
 )
@@ -21,12 +24,18 @@ var (
 )
 
 func usageWriter(writer io.Writer, name string) {
-	_, _ = fmt.Fprintf(writer, "Usage: %s [-dnv]\n", name)
+	_, _ = fmt.Fprintf(writer, "Usage: %s [-dnv] [-p[=n]] [-c file]\n", name)
+	_, _ = fmt.Fprintln(writer, "    -c file         Read the configuration from file (default "+config.DefaultPath+").")
 	_, _ = fmt.Fprintln(writer, "    -d              Show debug output.")
 	_, _ = fmt.Fprintln(writer, "    -n              Do a dry-run. Nothing is committed. Only show what would be done.")
-	_, _ = fmt.Fprintln(writer, "    -p              Create snapshots in parallel.")
+	_, _ = fmt.Fprintln(writer, "    -p[=n]          Run up to n zfs commands at once on each pool, one per CPU for a bare -p (default 1).") //nolint:lll
 	_, _ = fmt.Fprintln(writer, "    -P pool         Act only on the specified pool.")
 	_, _ = fmt.Fprintln(writer, "    -v              Show what is being done.")
+	_, _ = fmt.Fprintln(writer, "    --timeout dur   Give up and kill running zfs commands after dur (e.g. 10m).")
+	_, _ = fmt.Fprintln(writer, "    --json          Write each action and a summary of the run as JSON lines.")
+	_, _ = fmt.Fprintln(writer, "    --lock-wait dur Give up after dur when other runs on the pools haven't finished.")
+	_, _ = fmt.Fprintln(writer, "    --no-wait       Give up at once when other runs on the pools haven't finished.")
+	_, _ = fmt.Fprintln(writer, "    --print-config  Print the configuration merged from the file and flags, and exit.")
 }
 
 func usage() {
@@ -40,18 +49,56 @@ func version(writer io.Writer) {
 	os.Exit(0)
 }
 
+// cleanupSnapshots destroys the zero-sized snapshots not created by zfs-auto-snapshot, going by their prefix, once
+// the other runs on the pools are done, returning the exit status
+func cleanupSnapshots(ctx context.Context, cfg config.Config, pool string, lockWait time.Duration) int {
+	client := zfs.NewClient(zfs.CommandExecutor{})
+
+	poolLock, err := zfstools.LockPools(ctx, client, cfg, lock.DefaultDir, pool, lockWait)
+	if cli.Failed(os.Stderr, "locking pools", err) {
+		return 1
+	}
+
+	defer func() { _ = poolLock.Release() }()
+
+	err = zfstools.CleanupZeroSizedSnapshots(ctx, client, cfg, pool)
+	if cli.Interrupted(ctx, os.Stderr, "destroying zero-sized snapshots") ||
+		cli.Failed(os.Stderr, "destroying zero-sized snapshots", err) {
+		return 1
+	}
+
+	return 0
+}
+
 func main() {
 	cfg := config.Config{
-		Timestamp: time.Now(),
+		Timestamp:      time.Now(),
+		SnapshotPrefix: "zfs-auto-snap",
 	}
 
 	var pool string
 
+	var timeout time.Duration
+
+	var jsonOutput bool
+
+	var printConfig bool
+
+	var noWait bool
+
+	lockWait := lock.WaitForever
+
 	pflag.BoolVar(&cfg.Debug, "d", false, "")
 	pflag.BoolVar(&cfg.DryRun, "n", false, "")
-	pflag.BoolVar(&cfg.UseThreads, "p", false, "")
+	cli.ParallelFlag(pflag.CommandLine, &cfg.Parallelism, "parallel")
 	pflag.StringVar(&pool, "P", "", "")
 	pflag.BoolVar(&cfg.Verbose, "v", false, "")
+	pflag.DurationVar(&timeout, "timeout", 0, "")
+	pflag.StringP("config", "c", config.DefaultPath, "")
+	pflag.BoolVar(&printConfig, "print-config", false, "")
+	pflag.BoolVar(&jsonOutput, "json", false, "")
+	pflag.DurationVar(&lockWait, "lock-wait", lock.WaitForever, "")
+	pflag.BoolVar(&noWait, "no-wait", false, "")
 	showVersion := pflag.BoolP("version", "", false, "Print version information and exit")
 	pflag.Usage = usage
 	pflag.Parse()
@@ -60,32 +107,46 @@ func main() {
 		version(os.Stdout)
 	}
 
-	if len(pflag.Args()) > 0 {
-		usage()
+	if noWait {
+		lockWait = 0
+	}
+
+	file, err := cli.LoadConfig(pflag.CommandLine, map[string]string{
+		"parallel": "parallel",
+		"output":   "json",
+	}, &cfg, &jsonOutput)
+	if err == nil && printConfig {
+		err = file.Effective(cfg, jsonOutput).Write(os.Stdout)
+		if err == nil {
+			os.Exit(0)
+		}
 	}
 
-	// List all snapshots recursively
-	snapshots, err := zfs.ListSnapshotsFn(pool, true, cfg.Debug)
 	if err != nil {
-		_, _ = fmt.Fprintf(os.Stderr, "Error listing snapshots: %v\n", err)
+		_, _ = fmt.Fprintln(os.Stderr, err)
+
 		os.Exit(1)
 	}
 
-	// Filter snapshots that are zero-sized and not created by zfs-auto-snapshot
-	var filtered []zfs.Snapshot
+	if len(pflag.Args()) > 0 {
+		usage()
+	}
 
-	prefix := "zfs-auto-snap_"
+	var events *report.JSON
 
-	for _, snap := range snapshots {
-		if !strings.Contains(snap.Name, prefix) && snap.IsZero(cfg.Debug) {
-			filtered = append(filtered, snap)
-		}
+	if jsonOutput {
+		events = report.NewJSON(os.Stdout)
+		cfg.Reporter = events
 	}
 
-	// Get dataset list
-	datasets := zfs.ListDatasets(pool, []string{}, cfg.Debug)
+	ctx, cancel := cli.Context(timeout)
+
+	status := cleanupSnapshots(ctx, cfg, pool, lockWait)
+
+	if events != nil {
+		events.Finish("", cfg.DryRun, status, cli.Cause(ctx))
+	}
 
-	// Group and destroy
-	grouped := zfstools.GroupSnapshotsIntoDatasets(filtered, datasets)
-	zfstools.DatasetsDestroyZeroSizedSnapshots(grouped, cfg)
+	cancel()
+	os.Exit(status)
 }
@@ -18,12 +18,18 @@ func Test_usageWriter(t *testing.T) {
 		{
 			name: "simple",
 			args: args{name: "/usr/sbin/zfs-cleanup-snapshots"},
-			wantWriter: `Usage: /usr/sbin/zfs-cleanup-snapshots [-dnv]
+			wantWriter: `Usage: /usr/sbin/zfs-cleanup-snapshots [-dnv] [-p[=n]] [-c file]
+    -c file         Read the configuration from file (default /usr/local/etc/zfstools.conf).
     -d              Show debug output.
     -n              Do a dry-run. Nothing is committed. Only show what would be done.
-    -p              Create snapshots in parallel.
+    -p[=n]          Run up to n zfs commands at once on each pool, one per CPU for a bare -p (default 1).
     -P pool         Act only on the specified pool.
     -v              Show what is being done.
+    --timeout dur   Give up and kill running zfs commands after dur (e.g. 10m).
+    --json          Write each action and a summary of the run as JSON lines.
+    --lock-wait dur Give up after dur when other runs on the pools haven't finished.
+    --no-wait       Give up at once when other runs on the pools haven't finished.
+    --print-config  Print the configuration merged from the file and flags, and exit.
 `,
 		},
 	}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/spf13/pflag"
+
+	"zfstools-go/internal/cli"
+	"zfstools-go/internal/config"
+	"zfstools-go/internal/lock"
+	"zfstools-go/internal/report"
+	"zfstools-go/internal/zfs"
+	"zfstools-go/internal/zfstools"
+)
+
+var (
+	Version = "dev"
+	Commit  = "none"
+)
+
+func usageWriter(writer io.Writer, name string) {
+	_, _ = fmt.Fprintf(writer, "Usage: %s [-dnv] [-p[=n]] [-c file] <POLICY>\n", name)
+	_, _ = fmt.Fprintln(writer, "    -c file         Read the configuration from file (default "+config.DefaultPath+").")
+	_, _ = fmt.Fprintln(writer, "    -d              Show debug output.")
+	_, _ = fmt.Fprintln(writer, "    -n              Do a dry-run. Nothing is committed. Only show what would be done.")
+	_, _ = fmt.Fprintln(writer, "    -p[=n]          Run up to n zfs commands at once on each pool, one per CPU for a bare -p (default 1).") //nolint:lll
+	_, _ = fmt.Fprintln(writer, "    -P pool         Act only on the specified pool.")
+	_, _ = fmt.Fprintln(writer, "    -v              Show what is being done.")
+	_, _ = fmt.Fprintln(writer, "    --timeout dur   Give up and kill running zfs commands after dur (e.g. 10m).")
+	_, _ = fmt.Fprintln(writer, "    --json          Write each action and a summary of the run as JSON lines.")
+	_, _ = fmt.Fprintln(writer, "    --lock-wait dur Give up after dur when other runs on the pools haven't finished.")
+	_, _ = fmt.Fprintln(writer, "    --no-wait       Give up at once when other runs on the pools haven't finished.")
+	_, _ = fmt.Fprintln(writer, "    --print-config  Print the configuration merged from the file and flags, and exit.")
+	_, _ = fmt.Fprintln(writer, "    POLICY          How many hourly, daily, weekly, monthly and yearly snapshots to keep")
+	_, _ = fmt.Fprintln(writer, "                    (e.g. hourly=24,daily=30,monthly=12,yearly=5).")
+}
+
+func usage() {
+	usageWriter(os.Stderr, os.Args[0])
+	os.Exit(0)
+}
+
+func version(writer io.Writer) {
+	_, _ = fmt.Fprintf(writer, "%s (commit %s)\n", Version, Commit)
+
+	os.Exit(0)
+}
+
+// explain writes what was decided about each snapshot, and why those which are kept are kept
+func explain(writer io.Writer, retentions []zfstools.Retention) {
+	for _, retention := range retentions {
+		if retention.Keep() {
+			_, _ = fmt.Fprintf(writer, "keep    %s (%s)\n", retention.Snapshot.Name, strings.Join(retention.Reasons, ", "))
+		} else {
+			_, _ = fmt.Fprintf(writer, "destroy %s\n", retention.Snapshot.Name)
+		}
+	}
+}
+
+// pruneSnapshots destroys the snapshots the policy doesn't keep, once the other runs on the pools are done,
+// returning the exit status
+func pruneSnapshots(
+	ctx context.Context,
+	cfg config.Config,
+	pool string,
+	policy zfstools.RetentionPolicy,
+	lockWait time.Duration,
+) int {
+	client := zfs.NewClient(zfs.CommandExecutor{})
+
+	poolLock, err := zfstools.LockPools(ctx, client, cfg, lock.DefaultDir, pool, lockWait)
+	if cli.Failed(os.Stderr, "locking pools", err) {
+		return 1
+	}
+
+	defer func() { _ = poolLock.Release() }()
+
+	retentions, err := zfstools.PruneSnapshots(ctx, client, cfg, pool, policy)
+
+	if cfg.DryRun || cfg.Verbose {
+		// standard output is left to the JSON lines when there are any
+		writer := os.Stdout
+		if cfg.Reporter != nil {
+			writer = os.Stderr
+		}
+
+		explain(writer, retentions)
+	}
+
+	if cli.Interrupted(ctx, os.Stderr, "pruning snapshots") || cli.Failed(os.Stderr, "pruning snapshots", err) {
+		return 1
+	}
+
+	return 0
+}
+
+func main() {
+	cfg := config.Config{
+		Timestamp: time.Now(),
+	}
+
+	var pool string
+
+	var timeout time.Duration
+
+	var jsonOutput bool
+
+	var printConfig bool
+
+	var noWait bool
+
+	lockWait := lock.WaitForever
+
+	pflag.BoolVarP(&cfg.Debug, "debug", "d", false, "")
+	pflag.BoolVarP(&cfg.DryRun, "dry-run", "n", false, "")
+	cli.ParallelFlag(pflag.CommandLine, &cfg.Parallelism, "parallel")
+	pflag.StringVarP(&pool, "pool", "P", "", "")
+	pflag.BoolVarP(&cfg.Verbose, "verbose", "v", false, "")
+	pflag.StringVarP(&cfg.SnapshotPrefix, "snapshot-prefix", "s", "zfs-auto-snap", "")
+	pflag.DurationVar(&timeout, "timeout", 0, "")
+	pflag.StringP("config", "c", config.DefaultPath, "")
+	pflag.BoolVar(&printConfig, "print-config", false, "")
+	pflag.BoolVar(&jsonOutput, "json", false, "")
+	pflag.DurationVar(&lockWait, "lock-wait", lock.WaitForever, "")
+	pflag.BoolVar(&noWait, "no-wait", false, "")
+	pflag.Usage = usage
+	showVersion := pflag.BoolP("version", "", false, "Print version information and exit")
+
+	pflag.Parse()
+
+	if *showVersion {
+		version(os.Stdout)
+	}
+
+	if noWait {
+		lockWait = 0
+	}
+
+	file, err := cli.LoadConfig(pflag.CommandLine, map[string]string{
+		"snapshot_prefix": "snapshot-prefix",
+		"parallel":        "parallel",
+		"output":          "json",
+	}, &cfg, &jsonOutput)
+	if err == nil && printConfig {
+		err = file.Effective(cfg, jsonOutput).Write(os.Stdout)
+		if err == nil {
+			os.Exit(0)
+		}
+	}
+
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+
+		os.Exit(1)
+	}
+
+	if pflag.NArg() != 1 {
+		usage()
+	}
+
+	policy, err := zfstools.ParseRetentionPolicy(pflag.Arg(0))
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+
+		os.Exit(1)
+	}
+
+	var events *report.JSON
+
+	if jsonOutput {
+		events = report.NewJSON(os.Stdout)
+		cfg.Reporter = events
+	}
+
+	ctx, cancel := cli.Context(timeout)
+
+	status := pruneSnapshots(ctx, cfg, pool, policy, lockWait)
+
+	if events != nil {
+		events.Finish("", cfg.DryRun, status, cli.Cause(ctx))
+	}
+
+	cancel()
+	os.Exit(status)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"zfstools-go/internal/zfs"
+	"zfstools-go/internal/zfstools"
+)
+
+func Test_usageWriter(t *testing.T) {
+	t.Parallel()
+
+	writer := &bytes.Buffer{}
+	usageWriter(writer, "/usr/local/sbin/zfs-prune-snapshots")
+
+	want := `Usage: /usr/local/sbin/zfs-prune-snapshots [-dnv] [-p[=n]] [-c file] <POLICY>
+    -c file         Read the configuration from file (default /usr/local/etc/zfstools.conf).
+    -d              Show debug output.
+    -n              Do a dry-run. Nothing is committed. Only show what would be done.
+    -p[=n]          Run up to n zfs commands at once on each pool, one per CPU for a bare -p (default 1).
+    -P pool         Act only on the specified pool.
+    -v              Show what is being done.
+    --timeout dur   Give up and kill running zfs commands after dur (e.g. 10m).
+    --json          Write each action and a summary of the run as JSON lines.
+    --lock-wait dur Give up after dur when other runs on the pools haven't finished.
+    --no-wait       Give up at once when other runs on the pools haven't finished.
+    --print-config  Print the configuration merged from the file and flags, and exit.
+    POLICY          How many hourly, daily, weekly, monthly and yearly snapshots to keep
+                    (e.g. hourly=24,daily=30,monthly=12,yearly=5).
+`
+
+	if writer.String() != want {
+		t.Errorf("usageWriter() = %v, want %v", writer.String(), want)
+	}
+}
+
+func Test_explain(t *testing.T) {
+	t.Parallel()
+
+	writer := &bytes.Buffer{}
+	explain(writer, []zfstools.Retention{
+		{
+			Snapshot: zfs.Snapshot{Name: "tank@zfs-auto-snap_daily-2025-01-02-00h00"},
+			Reasons:  []string{"hourly 2025-01-02 00h", "daily 2025-01-02"},
+		},
+		{Snapshot: zfs.Snapshot{Name: "tank@zfs-auto-snap_hourly-2025-01-01-23h00"}},
+	})
+
+	want := `keep    tank@zfs-auto-snap_daily-2025-01-02-00h00 (hourly 2025-01-02 00h, daily 2025-01-02)
+destroy tank@zfs-auto-snap_hourly-2025-01-01-23h00
+`
+
+	if writer.String() != want {
+		t.Errorf("explain() = %v, want %v", writer.String(), want)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/spf13/pflag"
+
+	"zfstools-go/internal/cli"
+	"zfstools-go/internal/config"
+	"zfstools-go/internal/report"
+	"zfstools-go/internal/zfs"
+	"zfstools-go/internal/zfstools"
+)
+
+var (
+	Version = "dev"
+	Commit  = "none"
+)
+
+func usageWriter(writer io.Writer, name string) {
+	_, _ = fmt.Fprintf(writer, "Usage: %s [-dnv] <INTERVAL> <TARGET>\n", name)
+	_, _ = fmt.Fprintln(writer, "    -d              Show debug output.")
+	_, _ = fmt.Fprintln(writer, "    -n              Do a dry-run. Nothing is committed. Only show what would be done.")
+	_, _ = fmt.Fprintln(writer, "    -P pool         Act only on the specified pool.")
+	_, _ = fmt.Fprintln(writer, "    -R command      Run zfs on the target through command (e.g. \"ssh backup\").")
+	_, _ = fmt.Fprintln(writer, "    -v              Show what is being done.")
+	_, _ = fmt.Fprintln(writer, "    --timeout dur   Give up and kill running zfs commands after dur (e.g. 10m).")
+	_, _ = fmt.Fprintln(writer, "    --json          Write each action and a summary of the run as JSON lines.")
+	_, _ = fmt.Fprintln(writer, "    INTERVAL        The interval whose eligible datasets are replicated.")
+	_, _ = fmt.Fprintln(writer, "    TARGET          The dataset the replicas are received below.")
+}
+
+func usage() {
+	usageWriter(os.Stderr, os.Args[0])
+	os.Exit(0)
+}
+
+func version(writer io.Writer) {
+	_, _ = fmt.Fprintf(writer, "%s (commit %s)\n", Version, Commit)
+
+	os.Exit(0)
+}
+
+// replicate replicates the eligible datasets to the target, returning the exit status
+func replicate(ctx context.Context, cfg config.Config, pool string, target zfstools.ReplicationTarget) int {
+	client := zfs.NewClient(zfs.CommandExecutor{})
+
+	datasets, err := zfstools.FindEligibleDatasets(ctx, client, cfg, pool)
+	if cli.Interrupted(ctx, os.Stderr, "finding eligible datasets") ||
+		cli.Failed(os.Stderr, "finding eligible datasets", err) {
+		return 1
+	}
+
+	err = zfstools.Replicate(ctx, client, cfg, datasets, target)
+	if cli.Interrupted(ctx, os.Stderr, "replicating datasets") || cli.Failed(os.Stderr, "replicating datasets", err) {
+		return 1
+	}
+
+	return 0
+}
+
+func main() {
+	cfg := config.Config{
+		Timestamp: time.Now(),
+	}
+
+	var pool string
+
+	var remote string
+
+	var timeout time.Duration
+
+	var jsonOutput bool
+
+	pflag.BoolVarP(&cfg.Debug, "debug", "d", false, "")
+	pflag.BoolVarP(&cfg.DryRun, "dry-run", "n", false, "")
+	pflag.StringVarP(&pool, "pool", "P", "", "")
+	pflag.StringVarP(&remote, "remote", "R", "", "")
+	pflag.BoolVarP(&cfg.Verbose, "verbose", "v", false, "")
+	pflag.StringVarP(&cfg.SnapshotPrefix, "snapshot-prefix", "s", "zfs-auto-snap", "")
+	pflag.DurationVar(&timeout, "timeout", 0, "")
+	pflag.BoolVar(&jsonOutput, "json", false, "")
+	pflag.Usage = usage
+	showVersion := pflag.BoolP("version", "", false, "Print version information and exit")
+
+	pflag.Parse()
+
+	if *showVersion {
+		version(os.Stdout)
+	}
+
+	if pflag.NArg() != 2 { //nolint:mnd
+		usage()
+	}
+
+	cfg.Interval = pflag.Arg(0)
+	target := zfstools.ReplicationTarget{Remote: strings.Fields(remote), Root: pflag.Arg(1)}
+
+	var events *report.JSON
+
+	if jsonOutput {
+		events = report.NewJSON(os.Stdout)
+		cfg.Reporter = events
+	}
+
+	ctx, cancel := cli.Context(timeout)
+
+	status := replicate(ctx, cfg, pool, target)
+
+	if events != nil {
+		events.Finish(cfg.Interval, cfg.DryRun, status, cli.Cause(ctx))
+	}
+
+	cancel()
+	os.Exit(status)
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func Test_usageWriter(t *testing.T) {
+	t.Parallel()
+
+	writer := &bytes.Buffer{}
+	usageWriter(writer, "/usr/local/sbin/zfs-replicate")
+
+	want := `Usage: /usr/local/sbin/zfs-replicate [-dnv] <INTERVAL> <TARGET>
+    -d              Show debug output.
+    -n              Do a dry-run. Nothing is committed. Only show what would be done.
+    -P pool         Act only on the specified pool.
+    -R command      Run zfs on the target through command (e.g. "ssh backup").
+    -v              Show what is being done.
+    --timeout dur   Give up and kill running zfs commands after dur (e.g. 10m).
+    --json          Write each action and a summary of the run as JSON lines.
+    INTERVAL        The interval whose eligible datasets are replicated.
+    TARGET          The dataset the replicas are received below.
+`
+
+	if writer.String() != want {
+		t.Errorf("usageWriter() = %v, want %v", writer.String(), want)
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/spf13/pflag"
+
+	"zfstools-go/internal/cli"
+	"zfstools-go/internal/config"
+	"zfstools-go/internal/zfs"
+	"zfstools-go/internal/zfstools"
+)
+
+var (
+	Version = "dev"
+	Commit  = "none"
+)
+
+var errInvalidAge = errors.New("invalid age, want one such as 36h or 7d")
+
+func usageWriter(writer io.Writer, name string) {
+	_, _ = fmt.Fprintf(writer, "Usage: %s [-dnrv] [-x age] TAG SNAPSHOT...\n", name)
+	_, _ = fmt.Fprintf(writer, "       %s -l SNAPSHOT...\n", name)
+	_, _ = fmt.Fprintln(writer, "    -d              Show debug output.")
+	_, _ = fmt.Fprintln(writer, "    -l              List the holds on each snapshot, and when they expire.")
+	_, _ = fmt.Fprintln(writer, "    -n              Do a dry-run. Nothing is committed. Only show what would be done.")
+	_, _ = fmt.Fprintln(writer, "    -r              Release the holds instead of placing them.")
+	_, _ = fmt.Fprintln(writer, "    -v              Show what is being done.")
+	_, _ = fmt.Fprintln(writer, "    -x age          Let zfs-auto-snapshot release the holds after age (e.g. 30d).")
+	_, _ = fmt.Fprintln(writer, "    --timeout dur   Give up and kill running zfs commands after dur (e.g. 10m).")
+	_, _ = fmt.Fprintln(writer, "    TAG             The name of the holds.")
+	_, _ = fmt.Fprintln(writer, "    SNAPSHOT        The snapshots to hold or release.")
+}
+
+func usage() {
+	usageWriter(os.Stderr, os.Args[0])
+	os.Exit(0)
+}
+
+func version(writer io.Writer) {
+	_, _ = fmt.Fprintf(writer, "%s (commit %s)\n", Version, Commit)
+
+	os.Exit(0)
+}
+
+// listHolds writes the tag of each hold on the snapshots, with when it expires, returning the exit status
+func listHolds(ctx context.Context, writer io.Writer, cfg config.Config, snapshots []string) int {
+	client := zfs.NewClient(zfs.CommandExecutor{})
+
+	var errs []error
+
+	for _, snapshot := range snapshots {
+		tags, err := client.Holds(ctx, snapshot, cfg.Debug)
+		if err != nil {
+			errs = append(errs, err)
+
+			continue
+		}
+
+		expiries, err := client.HoldExpiries(ctx, snapshot, cfg.Debug)
+		if err != nil {
+			errs = append(errs, err)
+
+			continue
+		}
+
+		slices.Sort(tags)
+
+		for _, tag := range tags {
+			expires := "-"
+			if expiry, ok := expiries[tag]; ok {
+				expires = expiry.Format(time.RFC3339)
+			}
+
+			_, _ = fmt.Fprintf(writer, "%s\t%s\t%s\n", snapshot, tag, expires)
+		}
+	}
+
+	if cli.Interrupted(ctx, os.Stderr, "listing holds") || cli.Failed(os.Stderr, "listing holds", errors.Join(errs...)) {
+		return 1
+	}
+
+	return 0
+}
+
+// holdSnapshots places or, with release, releases the holds with tag on the snapshots, returning the exit status
+func holdSnapshots(
+	ctx context.Context,
+	cfg config.Config,
+	tag string,
+	snapshots []string,
+	release bool,
+	expires time.Time,
+) int {
+	client := zfs.NewClient(zfs.CommandExecutor{})
+
+	op := "holding snapshots"
+	err := zfstools.HoldSnapshots(ctx, client, cfg, tag, snapshots, expires)
+
+	if release {
+		op = "releasing snapshots"
+		err = zfstools.ReleaseSnapshots(ctx, client, cfg, tag, snapshots)
+	}
+
+	if cli.Interrupted(ctx, os.Stderr, op) || cli.Failed(os.Stderr, op, err) {
+		return 1
+	}
+
+	return 0
+}
+
+func main() {
+	cfg := config.Config{
+		Timestamp: time.Now(),
+	}
+
+	var list bool
+
+	var release bool
+
+	var expiry string
+
+	var timeout time.Duration
+
+	pflag.BoolVarP(&cfg.Debug, "debug", "d", false, "")
+	pflag.BoolVarP(&list, "list", "l", false, "")
+	pflag.BoolVarP(&cfg.DryRun, "dry-run", "n", false, "")
+	pflag.BoolVarP(&release, "release", "r", false, "")
+	pflag.BoolVarP(&cfg.Verbose, "verbose", "v", false, "")
+	pflag.StringVarP(&expiry, "expire", "x", "", "")
+	pflag.DurationVar(&timeout, "timeout", 0, "")
+	pflag.Usage = usage
+	showVersion := pflag.BoolP("version", "", false, "Print version information and exit")
+
+	pflag.Parse()
+
+	if *showVersion {
+		version(os.Stdout)
+	}
+
+	ctx, cancel := cli.Context(timeout)
+
+	if list {
+		if pflag.NArg() == 0 {
+			usage()
+		}
+
+		status := listHolds(ctx, os.Stdout, cfg, pflag.Args())
+
+		cancel()
+		os.Exit(status)
+	}
+
+	if pflag.NArg() < 2 || (release && expiry != "") { //nolint:mnd
+		usage()
+	}
+
+	var expires time.Time
+
+	if expiry != "" {
+		_, age, err := config.ParseKeep(expiry)
+		if err != nil || age == 0 {
+			_, _ = fmt.Fprintf(os.Stderr, "%v: %q\n", errInvalidAge, expiry)
+
+			os.Exit(1)
+		}
+
+		expires = cfg.Timestamp.Add(age)
+	}
+
+	status := holdSnapshots(ctx, cfg, pflag.Arg(0), pflag.Args()[1:], release, expires)
+
+	cancel()
+	os.Exit(status)
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func Test_usageWriter(t *testing.T) {
+	t.Parallel()
+
+	writer := &bytes.Buffer{}
+	usageWriter(writer, "/usr/local/sbin/zfs-snapshot-hold")
+
+	want := `Usage: /usr/local/sbin/zfs-snapshot-hold [-dnrv] [-x age] TAG SNAPSHOT...
+       /usr/local/sbin/zfs-snapshot-hold -l SNAPSHOT...
+    -d              Show debug output.
+    -l              List the holds on each snapshot, and when they expire.
+    -n              Do a dry-run. Nothing is committed. Only show what would be done.
+    -r              Release the holds instead of placing them.
+    -v              Show what is being done.
+    -x age          Let zfs-auto-snapshot release the holds after age (e.g. 30d).
+    --timeout dur   Give up and kill running zfs commands after dur (e.g. 10m).
+    TAG             The name of the holds.
+    SNAPSHOT        The snapshots to hold or release.
+`
+
+	if writer.String() != want {
+		t.Errorf("usageWriter() = %v, want %v", writer.String(), want)
+	}
+}
@@ -5,11 +5,17 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
 	"time"
 	_ "time/tzdata"
 
 	"github.com/spf13/pflag"
+
+	"zfstools-go/internal/cli"
+	"zfstools-go/internal/config"
+	"zfstools-go/internal/coordinator"
+	"zfstools-go/internal/lock"
+	"zfstools-go/internal/zfs"
+	"zfstools-go/internal/zfstools"
 )
 
 var (
@@ -18,10 +24,31 @@ var (
 )
 
 func usageWriter(writer io.Writer, name string) {
-	_, _ = fmt.Fprintf(writer, "Usage: %s [-dnv] DATASET\n", name)
+	_, _ = fmt.Fprintf(writer, "Usage: %s [-bdknuv] [-p[=n]] [-c file] <INTERVAL> <KEEP> DATASET\n", name)
+	_, _ = fmt.Fprintln(writer, "    -b              Bookmark expired snapshots before destroying them.")
+	_, _ = fmt.Fprintln(writer, "    -c file         Read the configuration from file (default "+config.DefaultPath+").")
 	_, _ = fmt.Fprintln(writer, "    -d              Show debug output.")
+	_, _ = fmt.Fprintln(writer, "    -k              Keep zero-sized snapshots.")
 	_, _ = fmt.Fprintln(writer, "    -n              Do a dry-run. Nothing is committed. Only show what would be done.")
+	_, _ = fmt.Fprintln(writer, "    -p[=n]          Run up to n zfs commands at once on the pool, one per CPU for a bare -p (default 1).") //nolint:lll
+	_, _ = fmt.Fprintln(writer, "    -P pool         Act only when DATASET is on the specified pool.")
+	_, _ = fmt.Fprintln(writer, "    -s prefix       Name snapshots with prefix (default zfs-auto-snap).")
+	_, _ = fmt.Fprintln(writer, "    -u              Use UTC for snapshots.")
 	_, _ = fmt.Fprintln(writer, "    -v              Show what is being done.")
+	_, _ = fmt.Fprintln(writer, "    --timeout dur   Give up and kill running zfs commands after dur (e.g. 10m).")
+	_, _ = fmt.Fprintln(writer, "    --json          Write each action and a summary of the run as JSON lines.")
+	_, _ = fmt.Fprintln(writer, "    --lock-wait dur Give up after dur when other runs on the pool haven't finished.")
+	_, _ = fmt.Fprintln(writer, "    --no-wait       Give up at once when other runs on the pool haven't finished.")
+	_, _ = fmt.Fprintln(writer, "    --metrics-file file")
+	_, _ = fmt.Fprintln(writer, "                    Write metrics of the run to file for the node_exporter textfile collector.") //nolint:lll
+	_, _ = fmt.Fprintln(writer, "    --no-recursive  Snapshot only DATASET, not the datasets below it.")
+	_, _ = fmt.Fprintln(writer, "    --print-config  Print the configuration merged from the file and flags, and exit.")
+	_, _ = fmt.Fprintln(writer, "    --mysql-dsn dsn Connect to MySQL with dsn (default as in my.cnf).")
+	_, _ = fmt.Fprintln(writer, "    --lock-timeout dur")
+	_, _ = fmt.Fprintln(writer, "                    Give up when MySQL can't be locked within dur (default 1m).")
+	_, _ = fmt.Fprintln(writer, "    INTERVAL        The interval to snapshot.")
+	_, _ = fmt.Fprintln(writer, "    KEEP            How many snapshots to keep, or how long for (e.g. 36h, 7d).")
+	_, _ = fmt.Fprintln(writer, "    DATASET         The dataset holding MySQL's data, snapshot with those below it.")
 }
 
 func usage() {
@@ -35,16 +62,105 @@ func version(writer io.Writer) {
 	os.Exit(0)
 }
 
+// snapshotMySQL snapshots the dataset while MySQL is locked and cleans up its expired snapshots, returning the exit
+// status
+func snapshotMySQL(ctx context.Context, client *zfs.Client, cfg config.Config, dataset string, recursive bool) int {
+	datasets, err := zfstools.FindDatasetTree(ctx, client, cfg, dataset, "mysql", recursive)
+	if cli.Interrupted(ctx, os.Stderr, "finding datasets") || cli.Failed(os.Stderr, "finding datasets", err) {
+		return 1
+	}
+
+	status := 0
+
+	if cfg.Keep > 0 || cfg.KeepAge > 0 {
+		err = zfstools.DoNewSnapshots(ctx, client, cfg, datasets)
+		if cli.Interrupted(ctx, os.Stderr, "snapshotting "+dataset) {
+			return 1
+		}
+
+		// expired snapshots are still cleaned up when the new one could not be created
+		if cli.Failed(os.Stderr, "snapshotting "+dataset, err) {
+			status = 1
+		}
+	}
+
+	err = zfstools.CleanupExpiredSnapshots(ctx, client, cfg, dataset, datasets)
+	if cli.Interrupted(ctx, os.Stderr, "destroying expired snapshots") ||
+		cli.Failed(os.Stderr, "destroying expired snapshots", err) {
+		return 1
+	}
+
+	return status
+}
+
+// configure applies the configuration file, and then the INTERVAL and KEEP arguments, to cfg. With printConfig it
+// prints the result and exits.
+func configure(cfg *config.Config, jsonOutput *bool, printConfig bool) {
+	file, err := cli.LoadConfig(pflag.CommandLine, map[string]string{
+		"snapshot_prefix": "snapshot-prefix",
+		"utc":             "utc",
+		"parallel":        "parallel-snapshots",
+		"output":          "json",
+	}, cfg, jsonOutput)
+	if err == nil {
+		cfg.Interval = pflag.Arg(0)
+		cfg.KeepGiven = true
+		cfg.Keep, cfg.KeepAge, err = config.ParseKeep(pflag.Arg(1))
+	}
+
+	if err == nil && printConfig {
+		err = file.Effective(*cfg, *jsonOutput).Write(os.Stdout)
+		if err == nil {
+			os.Exit(0)
+		}
+	}
+
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+
+		os.Exit(1)
+	}
+}
+
 func main() {
-	var debug bool
+	var options cli.RunOptions
 
-	var dryRun bool
+	var pool string
 
-	var verbose bool
+	var noWait bool
 
-	pflag.BoolVarP(&debug, "debug", "d", false, "")
-	pflag.BoolVarP(&dryRun, "dry-run", "n", false, "")
-	pflag.BoolVarP(&verbose, "verbose", "v", false, "")
+	var noRecursive bool
+
+	var keepZeroSized bool
+
+	var printConfig bool
+
+	cfg := config.Config{
+		Timestamp:              time.Now(),
+		ShouldDestroyZeroSized: true,
+	}
+
+	mysql := coordinator.NewMySQL(coordinator.DefaultMySQLDSN)
+
+	pflag.BoolVarP(&cfg.Bookmark, "bookmark", "b", false, "")
+	pflag.BoolVarP(&cfg.Debug, "debug", "d", false, "")
+	pflag.BoolVarP(&keepZeroSized, "keep-zero-sized-snapshots", "k", false, "")
+	pflag.BoolVarP(&cfg.DryRun, "dry-run", "n", false, "")
+	cli.ParallelFlag(pflag.CommandLine, &cfg.Parallelism, "parallel-snapshots")
+	pflag.StringVarP(&pool, "pool", "P", "", "")
+	pflag.StringVarP(&cfg.SnapshotPrefix, "snapshot-prefix", "s", "zfs-auto-snap", "")
+	pflag.BoolVarP(&cfg.UseUTC, "utc", "u", false, "")
+	pflag.BoolVarP(&cfg.Verbose, "verbose", "v", false, "")
+	pflag.DurationVar(&options.Timeout, "timeout", 0, "")
+	pflag.BoolVar(&options.JSONOutput, "json", false, "")
+	pflag.DurationVar(&options.LockWait, "lock-wait", lock.WaitForever, "")
+	pflag.BoolVar(&noWait, "no-wait", false, "")
+	pflag.StringVar(&options.MetricsFile, "metrics-file", "", "")
+	pflag.BoolVar(&noRecursive, "no-recursive", false, "")
+	pflag.StringP("config", "c", config.DefaultPath, "")
+	pflag.BoolVar(&printConfig, "print-config", false, "")
+	pflag.StringVar(&mysql.DSN, "mysql-dsn", mysql.DSN, "")
+	pflag.DurationVar(&mysql.LockWaitTimeout, "lock-timeout", mysql.LockWaitTimeout, "")
 	pflag.Usage = usage
 	showVersion := pflag.BoolP("version", "", false, "Print version information and exit")
 	pflag.Parse()
@@ -53,27 +169,31 @@ func main() {
 		version(os.Stdout)
 	}
 
-	if pflag.NArg() < 1 {
+	if keepZeroSized {
+		cfg.ShouldDestroyZeroSized = false
+	}
+
+	if noWait {
+		options.LockWait = 0
+	}
+
+	if pflag.NArg() < 3 { //nolint:mnd
 		usage()
 	}
 
-	dataset := pflag.Arg(0)
-	timestamp := time.Now().Format("2006-01-02T15:04:05")
-	snapshot := fmt.Sprintf("%s@%s", dataset, timestamp)
+	configure(&cfg, &options.JSONOutput, printConfig)
 
-	// Command to be executed inside MySQL FLUSH lock
-	zfsCmd := "zfs snapshot -r " + snapshot
-	sql := fmt.Sprintf(`FLUSH LOGS; FLUSH TABLES WITH READ LOCK; SYSTEM %s; UNLOCK TABLES;`, zfsCmd)
-	mysqlCmd := fmt.Sprintf(`mysql -e "%s"`, sql)
+	dataset := pflag.Arg(2) //nolint:mnd
 
-	if debug || verbose {
-		fmt.Println(mysqlCmd) //nolint:forbidigo
+	// like zfs-auto-snapshot, -P leaves the datasets of the other pools alone
+	if pool != "" && zfs.PoolName(dataset) != pool {
+		os.Exit(0)
 	}
 
-	if !dryRun {
-		cmd := exec.CommandContext(context.Background(), "sh", "-c", mysqlCmd)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		_ = cmd.Run()
-	}
+	client := zfs.NewClient(zfs.CommandExecutor{})
+	client.SetCoordinator("mysql", mysql)
+
+	os.Exit(cli.RunOnce(client, cfg, dataset, options, func(ctx context.Context, cfg config.Config) int {
+		return snapshotMySQL(ctx, client, cfg, dataset, !noRecursive)
+	}))
 }
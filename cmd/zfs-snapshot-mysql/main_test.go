@@ -18,10 +18,31 @@ func Test_usageWriter(t *testing.T) {
 		{
 			name: "simple",
 			args: args{name: "/usr/local/sbin/zfs-snapshot-mysql"},
-			wantWriter: `Usage: /usr/local/sbin/zfs-snapshot-mysql [-dnv] DATASET
+			wantWriter: `Usage: /usr/local/sbin/zfs-snapshot-mysql [-bdknuv] [-p[=n]] [-c file] <INTERVAL> <KEEP> DATASET
+    -b              Bookmark expired snapshots before destroying them.
+    -c file         Read the configuration from file (default /usr/local/etc/zfstools.conf).
     -d              Show debug output.
+    -k              Keep zero-sized snapshots.
     -n              Do a dry-run. Nothing is committed. Only show what would be done.
+    -p[=n]          Run up to n zfs commands at once on the pool, one per CPU for a bare -p (default 1).
+    -P pool         Act only when DATASET is on the specified pool.
+    -s prefix       Name snapshots with prefix (default zfs-auto-snap).
+    -u              Use UTC for snapshots.
     -v              Show what is being done.
+    --timeout dur   Give up and kill running zfs commands after dur (e.g. 10m).
+    --json          Write each action and a summary of the run as JSON lines.
+    --lock-wait dur Give up after dur when other runs on the pool haven't finished.
+    --no-wait       Give up at once when other runs on the pool haven't finished.
+    --metrics-file file
+                    Write metrics of the run to file for the node_exporter textfile collector.
+    --no-recursive  Snapshot only DATASET, not the datasets below it.
+    --print-config  Print the configuration merged from the file and flags, and exit.
+    --mysql-dsn dsn Connect to MySQL with dsn (default as in my.cnf).
+    --lock-timeout dur
+                    Give up when MySQL can't be locked within dur (default 1m).
+    INTERVAL        The interval to snapshot.
+    KEEP            How many snapshots to keep, or how long for (e.g. 36h, 7d).
+    DATASET         The dataset holding MySQL's data, snapshot with those below it.
 `,
 		},
 	}
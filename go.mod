@@ -3,7 +3,11 @@ module zfstools-go
 go 1.24.9
 
 require (
+	github.com/go-sql-driver/mysql v1.9.3
 	github.com/go-test/deep v1.1.1
+	github.com/lib/pq v1.12.3
 	github.com/spf13/pflag v1.0.7
 	golang.org/x/sys v0.35.0
 )
+
+require filippo.io/edwards25519 v1.1.0 // indirect
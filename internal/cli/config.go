@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"github.com/spf13/pflag"
+
+	"zfstools-go/internal/config"
+)
+
+// LoadConfig reads the configuration file named by the config flag and applies it to cfg, and jsonOutput, except
+// for the settings whose flags, named in settingFlags, were given. The file need only exist when the flag was given.
+// A number given after a bare -p, the flag of the parallel setting, is refused rather than taken for an argument.
+func LoadConfig(
+	flags *pflag.FlagSet,
+	settingFlags map[string]string,
+	cfg *config.Config,
+	jsonOutput *bool,
+) (config.File, error) {
+	if name, ok := settingFlags["parallel"]; ok {
+		err := checkParallelArgs(flags, name)
+		if err != nil {
+			return config.File{}, err
+		}
+	}
+
+	path, err := flags.GetString("config")
+	if err != nil {
+		return config.File{}, err //nolint:wrapcheck
+	}
+
+	file, err := config.ReadFile(path, flags.Changed("config"))
+	if err != nil {
+		return config.File{}, err //nolint:wrapcheck
+	}
+
+	overridden := func(setting string) bool {
+		name, ok := settingFlags[setting]
+
+		return ok && flags.Changed(name)
+	}
+
+	file.Apply(cfg, overridden)
+
+	if file.Output != "" && !overridden("output") {
+		*jsonOutput = file.Output == "json"
+	}
+
+	return file, nil
+}
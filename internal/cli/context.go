@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+var ErrSignal = errors.New("received signal")
+
+var ErrTimedOut = errors.New("timed out")
+
+// Context returns a context which is cancelled when SIGINT or SIGTERM is received or, if timeout is
+// greater than zero, once timeout has elapsed. context.Cause() reports which of those happened.
+func Context(timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case sig := <-signals:
+			cancel(fmt.Errorf("%w %s", ErrSignal, sig))
+		case <-ctx.Done():
+		}
+	}()
+
+	stop := func() {
+		signal.Stop(signals)
+		cancel(context.Canceled)
+	}
+
+	if timeout <= 0 {
+		return ctx, stop
+	}
+
+	timeoutCtx, cancelTimeout := context.WithTimeoutCause(ctx, timeout,
+		fmt.Errorf("%w after %s", ErrTimedOut, timeout))
+
+	return timeoutCtx, func() {
+		cancelTimeout()
+		stop()
+	}
+}
+
+// Interrupted reports on writer that op was interrupted and returns true if ctx is done
+func Interrupted(ctx context.Context, writer io.Writer, op string) bool {
+	if ctx.Err() == nil {
+		return false
+	}
+
+	_, _ = fmt.Fprintf(writer, "Interrupted while %s: %v\n", op, context.Cause(ctx))
+
+	return true
+}
+
+// Cause returns why ctx was interrupted, or nil if it was not
+func Cause(ctx context.Context) error {
+	if ctx.Err() == nil {
+		return nil
+	}
+
+	return context.Cause(ctx)
+}
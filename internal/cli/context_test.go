@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestContext_Timeout(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := Context(10 * time.Millisecond)
+	defer cancel()
+
+	<-ctx.Done()
+
+	if !errors.Is(context.Cause(ctx), ErrTimedOut) {
+		t.Errorf("context.Cause() = %v, want %v", context.Cause(ctx), ErrTimedOut)
+	}
+}
+
+func TestInterrupted(t *testing.T) {
+	t.Parallel()
+
+	writer := &bytes.Buffer{}
+
+	if Interrupted(t.Context(), writer, "listing datasets") {
+		t.Errorf("Interrupted() = true for a live context")
+	}
+
+	ctx, cancel := context.WithCancelCause(t.Context())
+	cancel(ErrSignal)
+
+	if !Interrupted(ctx, writer, "listing datasets") {
+		t.Errorf("Interrupted() = false for a cancelled context")
+	}
+
+	want := "Interrupted while listing datasets: received signal\n"
+	if writer.String() != want {
+		t.Errorf("Interrupted() wrote %q, want %q", writer.String(), want)
+	}
+}
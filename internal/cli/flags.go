@@ -0,0 +1,36 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/pflag"
+
+	"zfstools-go/internal/config"
+)
+
+var ErrParallelNumber = errors.New("the number of -p is given as -p=n")
+
+// ParallelFlag adds the flag name, -p for short, setting how many zfs commands are run at once on each pool, one
+// unless given. It was a switch before it took a number, so a bare -p, as in older crontabs, still runs one per CPU
+// and the number is given as -p=n.
+func ParallelFlag(flags *pflag.FlagSet, value *int, name string) {
+	flags.IntVarP(value, name, "p", 1, "")
+	flags.Lookup(name).NoOptDefVal = strconv.Itoa(config.DefaultParallelism())
+}
+
+// checkParallelArgs refuses a number right after the flag name, as in -p 4, which would otherwise be taken for the
+// first argument
+func checkParallelArgs(flags *pflag.FlagSet, name string) error {
+	if !flags.Changed(name) || flags.NArg() == 0 {
+		return nil
+	}
+
+	_, err := strconv.Atoi(flags.Arg(0))
+	if err != nil {
+		return nil //nolint:nilerr
+	}
+
+	return fmt.Errorf("%w or --%s=n, not %s", ErrParallelNumber, name, flags.Arg(0))
+}
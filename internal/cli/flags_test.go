@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/spf13/pflag"
+
+	"zfstools-go/internal/config"
+)
+
+func TestParallelFlag(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		args     []string
+		want     int
+		wantArgs []string
+		wantErr  bool
+	}{
+		{name: "unset", args: []string{"hourly", "24"}, want: 1, wantArgs: []string{"hourly", "24"}},
+		{
+			name:     "bare",
+			args:     []string{"-p", "hourly", "24"},
+			want:     config.DefaultParallelism(),
+			wantArgs: []string{"hourly", "24"},
+		},
+		{name: "short", args: []string{"-p=3", "hourly"}, want: 3, wantArgs: []string{"hourly"}},
+		{name: "long", args: []string{"--parallel=2", "hourly"}, want: 2, wantArgs: []string{"hourly"}},
+		{
+			name:     "combined",
+			args:     []string{"-np", "hourly"},
+			want:     config.DefaultParallelism(),
+			wantArgs: []string{"hourly"},
+		},
+		{
+			name:     "number after bare",
+			args:     []string{"-p", "4", "hourly", "24"},
+			want:     config.DefaultParallelism(),
+			wantArgs: []string{"4", "hourly", "24"},
+			wantErr:  true,
+		},
+		{name: "unset number", args: []string{"4"}, want: 1, wantArgs: []string{"4"}},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			var parallelism int
+
+			flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			flags.BoolP("dry-run", "n", false, "")
+			ParallelFlag(flags, &parallelism, "parallel")
+
+			err := flags.Parse(testCase.args)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+
+			if parallelism != testCase.want {
+				t.Errorf("parallelism = %d, want %d", parallelism, testCase.want)
+			}
+
+			if diff := deep.Equal(flags.Args(), testCase.wantArgs); diff != nil {
+				t.Error(diff)
+			}
+
+			err = checkParallelArgs(flags, "parallel")
+			if (err != nil) != testCase.wantErr {
+				t.Errorf("checkParallelArgs() error = %v, wantErr %v", err, testCase.wantErr)
+			}
+		})
+	}
+}
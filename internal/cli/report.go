@@ -0,0 +1,42 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+)
+
+// Failures returns the individual errors which were joined (by errors.Join) into err
+func Failures(err error) []error {
+	if err == nil {
+		return nil
+	}
+
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return []error{err}
+	}
+
+	var failures []error
+
+	for _, e := range joined.Unwrap() {
+		failures = append(failures, Failures(e)...)
+	}
+
+	return failures
+}
+
+// Failed reports a summary of err, one line per failure, on writer and returns true if there was any error
+func Failed(writer io.Writer, op string, err error) bool {
+	failures := Failures(err)
+	if len(failures) == 0 {
+		return false
+	}
+
+	_, _ = fmt.Fprintf(writer, "Error %s: %d failed\n", op, len(failures))
+
+	for _, failure := range failures {
+		_, _ = fmt.Fprintf(writer, "    %v\n", failure)
+	}
+
+	return true
+}
@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+var (
+	errOne   = errors.New("error destroying snapshot tank/a@1: dataset is busy")
+	errTwo   = errors.New("error destroying snapshot tank/b@1: dataset is busy")
+	errThree = errors.New("error listing snapshots: exit status 1")
+)
+
+func TestFailed(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		err        error
+		name       string
+		wantWriter string
+		want       bool
+	}{
+		{
+			name: "none",
+			err:  nil,
+			want: false,
+		},
+		{
+			name: "single",
+			err:  errThree,
+			want: true,
+			wantWriter: `Error destroying snapshots: 1 failed
+    error listing snapshots: exit status 1
+`,
+		},
+		{
+			name: "nested",
+			err:  errors.Join(errors.Join(errOne, errTwo), fmt.Errorf("cleanup: %w", errThree)),
+			want: true,
+			wantWriter: `Error destroying snapshots: 3 failed
+    error destroying snapshot tank/a@1: dataset is busy
+    error destroying snapshot tank/b@1: dataset is busy
+    cleanup: error listing snapshots: exit status 1
+`,
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			writer := &bytes.Buffer{}
+
+			got := Failed(writer, "destroying snapshots", testCase.err)
+			if got != testCase.want {
+				t.Errorf("Failed() = %v, want %v", got, testCase.want)
+			}
+
+			if writer.String() != testCase.wantWriter {
+				t.Errorf("Failed() wrote %q, want %q", writer.String(), testCase.wantWriter)
+			}
+		})
+	}
+}
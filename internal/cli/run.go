@@ -0,0 +1,98 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"zfstools-go/internal/config"
+	"zfstools-go/internal/lock"
+	"zfstools-go/internal/report"
+	"zfstools-go/internal/zfs"
+	"zfstools-go/internal/zfstools"
+)
+
+// RunOptions are where a run reports to, how long it may take and how long it waits for the other runs on its pools
+type RunOptions struct {
+	MetricsFile string
+	JSONOutput  bool
+	Timeout     time.Duration
+	LockWait    time.Duration
+}
+
+// NewReporters sets cfg.Reporter to report to those asked for, returning them, or nil for those which weren't
+func NewReporters(cfg *config.Config, jsonOutput, writeMetrics bool) (*report.JSON, *report.Metrics) {
+	var events *report.JSON
+
+	var metrics *report.Metrics
+
+	var reporters report.Multi
+
+	if jsonOutput {
+		events = report.NewJSON(os.Stdout)
+		reporters = append(reporters, events)
+	}
+
+	// a dry-run changes nothing, so it has nothing to tell the metrics
+	if writeMetrics && !cfg.DryRun {
+		metrics = report.NewMetrics()
+		reporters = append(reporters, metrics)
+	}
+
+	if len(reporters) > 0 {
+		cfg.Reporter = reporters
+	}
+
+	return events, metrics
+}
+
+// WriteMetrics writes the metrics of the run of interval, if asked for, returning the exit status it ends with
+func WriteMetrics(metrics *report.Metrics, path, interval string, status int) int {
+	if metrics == nil {
+		return status
+	}
+
+	err := metrics.WriteFile(path, interval, status)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error writing metrics: %v\n", err)
+
+		return 1
+	}
+
+	return status
+}
+
+// RunOnce calls run once the other runs on the pools of target, or on every pool when it is empty, are done,
+// returning the exit status. The metrics are written before the pools are unlocked, so that the next run on them
+// reads what this one wrote.
+func RunOnce(
+	client *zfs.Client,
+	cfg config.Config,
+	target string,
+	options RunOptions,
+	run func(ctx context.Context, cfg config.Config) int,
+) int {
+	events, metrics := NewReporters(&cfg, options.JSONOutput, options.MetricsFile != "")
+
+	ctx, cancel := Context(options.Timeout)
+	defer cancel()
+
+	var status int
+
+	poolLock, err := zfstools.LockPools(ctx, client, cfg, lock.DefaultDir, target, options.LockWait)
+	if Failed(os.Stderr, "locking pools", err) {
+		status = WriteMetrics(metrics, options.MetricsFile, cfg.Interval, 1)
+	} else {
+		status = run(ctx, cfg)
+		status = WriteMetrics(metrics, options.MetricsFile, cfg.Interval, status)
+
+		_ = poolLock.Release()
+	}
+
+	if events != nil {
+		events.Finish(cfg.Interval, cfg.DryRun, status, Cause(ctx))
+	}
+
+	return status
+}
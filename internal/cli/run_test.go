@@ -0,0 +1,116 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"zfstools-go/internal/config"
+)
+
+func TestNewReporters(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		jsonOutput   bool
+		writeMetrics bool
+		dryRun       bool
+		wantEvents   bool
+		wantMetrics  bool
+	}{
+		{
+			name: "none",
+		},
+		{
+			name:         "both",
+			jsonOutput:   true,
+			writeMetrics: true,
+			wantEvents:   true,
+			wantMetrics:  true,
+		},
+		{
+			name:         "dryRun",
+			jsonOutput:   true,
+			writeMetrics: true,
+			dryRun:       true,
+			wantEvents:   true,
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := config.Config{DryRun: testCase.dryRun}
+
+			events, metrics := NewReporters(&cfg, testCase.jsonOutput, testCase.writeMetrics)
+			if (events != nil) != testCase.wantEvents {
+				t.Errorf("NewReporters() events = %v, want %v", events != nil, testCase.wantEvents)
+			}
+
+			if (metrics != nil) != testCase.wantMetrics {
+				t.Errorf("NewReporters() metrics = %v, want %v", metrics != nil, testCase.wantMetrics)
+			}
+
+			if (cfg.Reporter != nil) != (testCase.wantEvents || testCase.wantMetrics) {
+				t.Errorf("NewReporters() set Reporter = %v", cfg.Reporter)
+			}
+		})
+	}
+}
+
+func TestWriteMetrics(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		want   int
+	}{
+		{
+			name:   "written",
+			path:   filepath.Join(dir, "zfs-auto-snapshot.prom"),
+			status: 0,
+			want:   0,
+		},
+		{
+			name:   "failedRun",
+			path:   filepath.Join(dir, "failed.prom"),
+			status: 1,
+			want:   1,
+		},
+		{
+			name:   "unwritable",
+			path:   filepath.Join(dir, "missing", "zfs-auto-snapshot.prom"),
+			status: 0,
+			want:   1,
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, metrics := NewReporters(&config.Config{}, false, true)
+
+			got := WriteMetrics(metrics, testCase.path, "hourly", testCase.status)
+			if got != testCase.want {
+				t.Errorf("WriteMetrics() = %d, want %d", got, testCase.want)
+			}
+
+			_, err := os.Stat(testCase.path)
+			if (err == nil) != (testCase.want == testCase.status) {
+				t.Errorf("WriteMetrics() wrote %s: %v", testCase.path, err)
+			}
+		})
+	}
+
+	got := WriteMetrics(nil, filepath.Join(dir, "none.prom"), "hourly", 1)
+	if got != 1 {
+		t.Errorf("WriteMetrics(nil) = %d, want 1", got)
+	}
+}
@@ -1,16 +1,45 @@
 package config
 
-import "time"
+import (
+	"runtime"
+	"time"
+
+	"zfstools-go/internal/report"
+)
+
+// DefaultParallelism is how many zfs commands a bare -p runs at once on each pool, one for each CPU
+func DefaultParallelism() int {
+	return runtime.NumCPU()
+}
 
 type Config struct {
-	Timestamp              time.Time
-	Interval               string
-	SnapshotPrefix         string
-	Keep                   int
-	UseUTC                 bool
-	Verbose                bool
-	Debug                  bool
-	DryRun                 bool
-	UseThreads             bool
+	Timestamp      time.Time
+	Interval       string
+	SnapshotPrefix string
+	// Reporter, when not nil, is told about each snapshot created or destroyed and each failure
+	Reporter report.Reporter
+	// KeepAge, when not zero, keeps the snapshots taken within KeepAge of Timestamp instead of the newest Keep
+	KeepAge time.Duration
+	Keep    int
+	// KeepBookmarks, when not zero, keeps only the newest KeepBookmarks bookmarks of the interval of each dataset
+	KeepBookmarks int
+	UseUTC        bool
+	Verbose       bool
+	Debug         bool
+	DryRun        bool
+	// Parallelism is how many zfs commands are run at once on each pool, 1 or less runs them one after the other
+	Parallelism            int
 	ShouldDestroyZeroSized bool
+	// Bookmark bookmarks expired snapshots before destroying them, so they can still be sent from incrementally
+	Bookmark bool
+	// PoolKeep is, for each pool and interval, the KEEP of its datasets instead of Keep and KeepAge, unless KeepGiven
+	PoolKeep map[string]map[string]string
+	// KeepGiven is whether Keep and KeepAge were given as KEEP on the command line, which then wins over PoolKeep
+	KeepGiven bool
+	// Include and Exclude are patterns, as in path.Match, of the datasets included or excluded along with those below
+	// them. Exclude wins over com.sun:auto-snapshot, which wins over Include.
+	Include []string
+	Exclude []string
+	// Hooks are the hooks of datasets, and those below them, which don't have com.sun:auto-snapshot-hook
+	Hooks map[string]string
 }
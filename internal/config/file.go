@@ -0,0 +1,200 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path"
+)
+
+// DefaultPath is where the configuration file is read from, unless another is given with -c
+const DefaultPath = "/usr/local/etc/zfstools.conf"
+
+var ErrInvalidFile = errors.New("invalid configuration file")
+
+var errInvalidOutput = errors.New("invalid output, want text or json")
+
+var errInvalidParallel = errors.New("invalid parallel, want at least 1")
+
+// File is the configuration file, a JSON object such as
+//
+//	{
+//	  "snapshot_prefix": "zfs-auto-snap",
+//	  "utc": true,
+//	  "parallel": 4,
+//	  "keep": {"hourly": "24", "daily": "7d"},
+//	  "pools": {"backup": {"keep": {"hourly": "48"}}},
+//	  "include": ["tank/home"],
+//	  "exclude": ["tank/home/*/cache"],
+//	  "hooks": {"tank/db": "/usr/local/libexec/flush-db"},
+//	  "output": "json"
+//	}
+//
+// Settings which are left out keep their defaults, those given on the command line override it.
+type File struct {
+	SnapshotPrefix string `json:"snapshot_prefix,omitempty"`
+	UTC            *bool  `json:"utc,omitempty"`
+	// Parallel is how many zfs commands are run at once on each pool, as -p sets it
+	Parallel int `json:"parallel,omitempty"`
+	// Keep is the KEEP of each interval when it isn't given on the command line, or is "-" in the schedule
+	Keep  map[string]string `json:"keep,omitempty"`
+	Pools map[string]Pool   `json:"pools,omitempty"`
+	// Include, Exclude and Hooks are those of Config
+	Include []string          `json:"include,omitempty"`
+	Exclude []string          `json:"exclude,omitempty"`
+	Hooks   map[string]string `json:"hooks,omitempty"`
+	// Output is "json" to write JSON lines, as --json does, or "text"
+	Output string `json:"output,omitempty"`
+}
+
+// Pool is the part of the configuration file about a pool
+type Pool struct {
+	// Keep is the KEEP of each interval for the datasets of the pool, overriding that given for all of them but not
+	// KEEP given on the command line
+	Keep map[string]string `json:"keep,omitempty"`
+}
+
+// ReadFile reads the configuration file at path. A missing file is only an error when required, otherwise it is
+// as good as an empty one.
+func ReadFile(path string, required bool) (File, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		return File{}, nil
+	}
+
+	if err != nil {
+		return File{}, fmt.Errorf("error reading configuration: %w", err)
+	}
+
+	file, err := ParseFile(bytes.NewReader(data))
+	if err != nil {
+		return File{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return file, nil
+}
+
+// ParseFile reads and checks a configuration file
+func ParseFile(reader io.Reader) (File, error) {
+	var file File
+
+	decoder := json.NewDecoder(reader)
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(&file)
+	if err != nil {
+		return File{}, fmt.Errorf("%w: %w", ErrInvalidFile, err)
+	}
+
+	err = file.check()
+	if err != nil {
+		return File{}, fmt.Errorf("%w: %w", ErrInvalidFile, err)
+	}
+
+	return file, nil
+}
+
+// check returns an error about the first setting of f which is wrong, rather than let it be found on a later run
+func (f File) check() error {
+	keeps := []map[string]string{f.Keep}
+	for _, pool := range f.Pools {
+		keeps = append(keeps, pool.Keep)
+	}
+
+	for _, keep := range keeps {
+		for interval, value := range keep {
+			_, _, err := ParseKeep(value)
+			if err != nil {
+				return fmt.Errorf("keep of %s: %w", interval, err)
+			}
+		}
+	}
+
+	for _, pattern := range append(append([]string{}, f.Include...), f.Exclude...) {
+		_, err := path.Match(pattern, "")
+		if err != nil {
+			return fmt.Errorf("pattern %q: %w", pattern, err)
+		}
+	}
+
+	if f.Parallel < 0 {
+		return fmt.Errorf("%w: %d", errInvalidParallel, f.Parallel)
+	}
+
+	if f.Output != "" && f.Output != "text" && f.Output != "json" {
+		return fmt.Errorf("%w: %q", errInvalidOutput, f.Output)
+	}
+
+	return nil
+}
+
+// Apply sets the settings of cfg which f has, except those which overridden reports were given on the command line
+func (f File) Apply(cfg *Config, overridden func(setting string) bool) {
+	if f.SnapshotPrefix != "" && !overridden("snapshot_prefix") {
+		cfg.SnapshotPrefix = f.SnapshotPrefix
+	}
+
+	if f.UTC != nil && !overridden("utc") {
+		cfg.UseUTC = *f.UTC
+	}
+
+	if f.Parallel > 0 && !overridden("parallel") {
+		cfg.Parallelism = f.Parallel
+	}
+
+	for name, pool := range f.Pools {
+		if len(pool.Keep) > 0 {
+			if cfg.PoolKeep == nil {
+				cfg.PoolKeep = map[string]map[string]string{}
+			}
+
+			cfg.PoolKeep[name] = pool.Keep
+		}
+	}
+
+	cfg.Include = append(cfg.Include, f.Include...)
+	cfg.Exclude = append(cfg.Exclude, f.Exclude...)
+
+	if len(f.Hooks) > 0 {
+		cfg.Hooks = maps.Clone(f.Hooks)
+	}
+}
+
+// Effective returns f as it is once merged with cfg, the configuration the command runs with, and whether it writes
+// JSON lines
+func (f File) Effective(cfg Config, jsonOutput bool) File {
+	f.SnapshotPrefix = cfg.SnapshotPrefix
+	f.UTC = &cfg.UseUTC
+	f.Parallel = cfg.Parallelism
+	f.Include = cfg.Include
+	f.Exclude = cfg.Exclude
+	f.Hooks = cfg.Hooks
+	f.Keep = maps.Clone(f.Keep)
+
+	if cfg.Interval != "" {
+		if f.Keep == nil {
+			f.Keep = map[string]string{}
+		}
+
+		f.Keep[cfg.Interval] = FormatKeep(cfg.Keep, cfg.KeepAge)
+	}
+
+	f.Output = "text"
+	if jsonOutput {
+		f.Output = "json"
+	}
+
+	return f
+}
+
+// Write writes f as indented JSON
+func (f File) Write(writer io.Writer) error {
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(f) //nolint:wrapcheck
+}
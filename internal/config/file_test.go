@@ -0,0 +1,129 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+)
+
+func TestParseFile(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		wantErr error
+		name    string
+		file    string
+	}{
+		{name: "empty", file: `{}`},
+		{
+			name: "all",
+			file: `{"snapshot_prefix": "auto", "utc": true, "parallel": 4, "keep": {"hourly": "24"},
+				"pools": {"tank": {"keep": {"daily": "7d"}}}, "include": ["tank/*"], "exclude": ["tank/tmp"],
+				"hooks": {"tank/db": "/hooks/db"}, "output": "json"}`,
+		},
+		{name: "not json", file: `prefix = "auto"`, wantErr: ErrInvalidFile},
+		{name: "unknown setting", file: `{"prefix": "auto"}`, wantErr: ErrInvalidFile},
+		{name: "bad keep", file: `{"keep": {"hourly": "lots"}}`, wantErr: ErrInvalidKeep},
+		{name: "bad pool keep", file: `{"pools": {"tank": {"keep": {"hourly": "-1"}}}}`, wantErr: ErrInvalidKeep},
+		{name: "bad pattern", file: `{"exclude": ["tank/["]}`, wantErr: ErrInvalidFile},
+		{name: "bad output", file: `{"output": "xml"}`, wantErr: ErrInvalidFile},
+		{name: "bad parallel", file: `{"parallel": -1}`, wantErr: ErrInvalidFile},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := ParseFile(strings.NewReader(testCase.file))
+			if !errors.Is(err, testCase.wantErr) {
+				t.Errorf("ParseFile() error = %v, want %v", err, testCase.wantErr)
+			}
+		})
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	t.Parallel()
+
+	missing := filepath.Join(t.TempDir(), "zfstools.conf")
+
+	file, err := ReadFile(missing, false)
+	if err != nil || file.Keep != nil {
+		t.Errorf("ReadFile() = %v, %v for a missing optional file, want an empty one", file, err)
+	}
+
+	_, err = ReadFile(missing, true)
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("ReadFile() error = %v for a missing required file, want %v", err, os.ErrNotExist)
+	}
+}
+
+func TestFile_Apply(t *testing.T) {
+	t.Parallel()
+
+	utc := true
+	file := File{
+		SnapshotPrefix: "auto",
+		UTC:            &utc,
+		Parallel:       4,
+		Pools:          map[string]Pool{"tank": {Keep: map[string]string{"hourly": "48"}}, "old": {}},
+		Exclude:        []string{"tank/tmp"},
+		Hooks:          map[string]string{"tank/db": "/hooks/db"},
+	}
+
+	cfg := Config{SnapshotPrefix: "zfs-auto-snap"}
+
+	// -p was given on the command line
+	file.Apply(&cfg, func(setting string) bool { return setting == "parallel" })
+
+	want := Config{
+		SnapshotPrefix: "auto",
+		UseUTC:         true,
+		PoolKeep:       map[string]map[string]string{"tank": {"hourly": "48"}},
+		Exclude:        []string{"tank/tmp"},
+		Hooks:          map[string]string{"tank/db": "/hooks/db"},
+	}
+
+	if diff := deep.Equal(cfg, want); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestFile_Effective(t *testing.T) {
+	t.Parallel()
+
+	file := File{Keep: map[string]string{"hourly": "24", "daily": "7"}}
+	cfg := Config{SnapshotPrefix: "zfs-auto-snap", Interval: "daily", KeepAge: 36 * time.Hour, Parallelism: 2}
+
+	var out bytes.Buffer
+
+	err := file.Effective(cfg, true).Write(&out)
+	if err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	want := `{
+  "snapshot_prefix": "zfs-auto-snap",
+  "utc": false,
+  "parallel": 2,
+  "keep": {
+    "daily": "1d12h",
+    "hourly": "24"
+  },
+  "output": "json"
+}
+`
+	if out.String() != want {
+		t.Errorf("Write() = %s, want %s", out.String(), want)
+	}
+
+	if file.Keep["daily"] != "7" {
+		t.Errorf("Effective() changed the file's keep to %q", file.Keep["daily"])
+	}
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+var ErrInvalidKeep = errors.New("invalid KEEP, want a count or an age such as 36h or 7d")
+
+// ageUnits are the units an age may be given in, beyond those of time.ParseDuration
+var ageUnits = map[byte]time.Duration{
+	's': time.Second,
+	'm': time.Minute,
+	'h': time.Hour,
+	'd': 24 * time.Hour,
+	'w': 7 * 24 * time.Hour,
+}
+
+// ageUnitOrder are the units of ageUnits, largest first
+var ageUnitOrder = []byte{'w', 'd', 'h', 'm', 's'}
+
+// ParseKeep parses KEEP, which is either how many snapshots to keep or how old they may get, as a number followed
+// by s, m, h, d or w, or several of those such as 1d12h
+func ParseKeep(value string) (int, time.Duration, error) {
+	count, err := strconv.Atoi(value)
+	if err == nil && count >= 0 {
+		return count, 0, nil
+	}
+
+	var age time.Duration
+
+	number := 0
+	digits := 0
+
+	for index := range len(value) {
+		char := value[index]
+
+		if char >= '0' && char <= '9' {
+			number = number*10 + int(char-'0')
+			digits++
+
+			continue
+		}
+
+		unit, ok := ageUnits[char]
+		if !ok || digits == 0 {
+			return 0, 0, fmt.Errorf("%w: %q", ErrInvalidKeep, value)
+		}
+
+		age += time.Duration(number) * unit
+		number = 0
+		digits = 0
+	}
+
+	if digits != 0 || age <= 0 {
+		return 0, 0, fmt.Errorf("%w: %q", ErrInvalidKeep, value)
+	}
+
+	return 0, age, nil
+}
+
+// FormatKeep returns KEEP as ParseKeep takes it, the age when it isn't zero or else the count
+func FormatKeep(count int, age time.Duration) string {
+	if age <= 0 {
+		return strconv.Itoa(count)
+	}
+
+	var keep []byte
+
+	for _, char := range ageUnitOrder {
+		unit := ageUnits[char]
+		if age >= unit {
+			keep = strconv.AppendInt(keep, int64(age/unit), 10) //nolint:mnd
+			keep = append(keep, char)
+			age %= unit
+		}
+	}
+
+	return string(keep)
+}
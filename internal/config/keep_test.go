@@ -0,0 +1,81 @@
+package config
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseKeep(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		wantErr   error
+		value     string
+		wantAge   time.Duration
+		wantCount int
+	}{
+		{value: "24", wantCount: 24},
+		{value: "0", wantCount: 0},
+		{value: "36h", wantAge: 36 * time.Hour},
+		{value: "7d", wantAge: 7 * 24 * time.Hour},
+		{value: "2w", wantAge: 14 * 24 * time.Hour},
+		{value: "1d12h", wantAge: 36 * time.Hour},
+		{value: "90m", wantAge: 90 * time.Minute},
+		{value: "", wantErr: ErrInvalidKeep},
+		{value: "-1", wantErr: ErrInvalidKeep},
+		{value: "7", wantCount: 7},
+		{value: "d", wantErr: ErrInvalidKeep},
+		{value: "7x", wantErr: ErrInvalidKeep},
+		{value: "1d12", wantErr: ErrInvalidKeep},
+		{value: "0h", wantErr: ErrInvalidKeep},
+		{value: "all", wantErr: ErrInvalidKeep},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.value, func(t *testing.T) {
+			t.Parallel()
+
+			count, age, err := ParseKeep(testCase.value)
+			if !errors.Is(err, testCase.wantErr) {
+				t.Fatalf("ParseKeep() error = %v, want %v", err, testCase.wantErr)
+			}
+
+			if count != testCase.wantCount || age != testCase.wantAge {
+				t.Errorf("ParseKeep() = %d, %v, want %d, %v", count, age, testCase.wantCount, testCase.wantAge)
+			}
+		})
+	}
+}
+
+func TestFormatKeep(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		want  string
+		age   time.Duration
+		count int
+	}{
+		{count: 24, want: "24"},
+		{count: 0, want: "0"},
+		{age: 36 * time.Hour, want: "1d12h"},
+		{age: 14 * 24 * time.Hour, want: "2w"},
+		{age: 90 * time.Minute, want: "1h30m"},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.want, func(t *testing.T) {
+			t.Parallel()
+
+			got := FormatKeep(testCase.count, testCase.age)
+			if got != testCase.want {
+				t.Errorf("FormatKeep() = %q, want %q", got, testCase.want)
+			}
+
+			count, age, err := ParseKeep(got)
+			if err != nil || count != testCase.count || age != testCase.age {
+				t.Errorf("ParseKeep(%q) = %d, %v, %v", got, count, age, err)
+			}
+		})
+	}
+}
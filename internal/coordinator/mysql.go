@@ -0,0 +1,349 @@
+package coordinator
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// DefaultMySQLDSN connects as the mysql client would, going by the [client] and [mysql] groups of the option files
+// such as ~/.my.cnf, as root over /tmp/mysql.sock unless they say otherwise
+const DefaultMySQLDSN = ""
+
+// BinlogPositionProperty is the snapshot user property the binary log file and position, as file:position, are
+// stored in
+const BinlogPositionProperty = "com.sun:auto-snapshot-binlog-position"
+
+// GTIDExecutedProperty is the snapshot user property the executed GTID set is stored in, when GTIDs are used
+const GTIDExecutedProperty = "com.sun:auto-snapshot-gtid-executed"
+
+// mysqlLock is how a server is locked while its snapshot is taken, and how the binary log position is read under
+// the lock
+type mysqlLock struct {
+	lock     string
+	unlock   string
+	position string
+}
+
+// flushTablesLock blocks all writes, so the binary log position is exactly that of the snapshot
+var flushTablesLock = mysqlLock{
+	lock:     "FLUSH TABLES WITH READ LOCK",
+	unlock:   "UNLOCK TABLES",
+	position: "SHOW MASTER STATUS",
+}
+
+// flushTablesLogStatusLock is flushTablesLock for servers with performance_schema.log_status, which later versions
+// read the binary log position from instead of SHOW MASTER STATUS
+var flushTablesLogStatusLock = mysqlLock{
+	lock:     flushTablesLock.lock,
+	unlock:   flushTablesLock.unlock,
+	position: "SELECT LOCAL FROM performance_schema.log_status",
+}
+
+// backupLock only blocks DDL and writes to non-transactional tables, InnoDB recovers the snapshot like after a
+// crash. As transactions carry on there is no binary log position of the snapshot, so it is only taken when binary
+// logging and GTIDs are off, and no position is read.
+var backupLock = mysqlLock{
+	lock:   "LOCK INSTANCE FOR BACKUP",
+	unlock: "UNLOCK INSTANCE",
+}
+
+// logStatusVersion is the version of MySQL which brought in performance_schema.log_status, the backup lock came in
+// with 8.0.0
+var logStatusVersion = [3]int{8, 0, 14}
+
+// mysqlLoggingQuery reads whether binary logging is on and the GTID mode
+const mysqlLoggingQuery = "SELECT @@GLOBAL.log_bin AS log_bin, @@GLOBAL.gtid_mode AS gtid_mode"
+
+// hasLogStatus reports whether a server of version, as in VERSION(), has performance_schema.log_status. MariaDB
+// doesn't, nor the backup lock.
+func hasLogStatus(version string) bool {
+	if strings.Contains(version, "MariaDB") {
+		return false
+	}
+
+	var number [3]int
+
+	release, _, _ := strings.Cut(version, "-")
+
+	for index, part := range strings.SplitN(release, ".", len(number)) {
+		value, err := strconv.Atoi(part)
+		if err != nil {
+			return false
+		}
+
+		number[index] = value
+	}
+
+	return slices.Compare(number[:], logStatusVersion[:]) >= 0
+}
+
+// mysqlLockFor returns the lock for a server of version, as in VERSION(), given whether it has binary logging or
+// GTIDs on. The backup lock is only taken where there is no position to record, and where the server could read it
+// from performance_schema.log_status.
+func mysqlLockFor(version string, logged bool) mysqlLock {
+	switch {
+	case !hasLogStatus(version):
+		return flushTablesLock
+	case logged:
+		return flushTablesLogStatusLock
+	default:
+		return backupLock
+	}
+}
+
+// mysqlSession is the one connection a lock is taken and released on, as the server releases it when the
+// session ends
+type mysqlSession interface {
+	version(ctx context.Context) (string, error)
+	exec(ctx context.Context, query string, args ...any) error
+	// queryRow returns the first row of the query's result by column name, or nil when there are no rows
+	queryRow(ctx context.Context, query string) (map[string]string, error)
+	Close() error
+}
+
+// MySQL is a Coordinator for the data directory of a MySQL or MariaDB server
+type MySQL struct {
+	// DSN is the data source name, such as "root@unix(/tmp/mysql.sock)/", or DefaultMySQLDSN to connect as the
+	// option files say
+	DSN string
+	// LockWaitTimeout is how long to wait for the lock, such as behind a long running query, before giving up on
+	// the snapshot
+	LockWaitTimeout time.Duration
+
+	connect     func(ctx context.Context, dsn string) (mysqlSession, error)
+	optionFiles []string
+}
+
+// NewMySQL returns a MySQL Coordinator which connects with dsn
+func NewMySQL(dsn string) *MySQL {
+	return &MySQL{
+		DSN:             dsn,
+		LockWaitTimeout: time.Minute,
+		connect:         connectMySQL,
+		optionFiles:     defaultMySQLOptionFiles(),
+	}
+}
+
+// Snapshot locks the server, calls take and unlocks it, all in one session. Nothing is taken when the lock can't
+// be had within the LockWaitTimeout. The server is unlocked even when take fails, returning the binary log
+// position, when binary logging is on, as properties when it succeeds. Writes are blocked while binary logging or
+// GTIDs are on, so that the position is exactly that of the snapshot.
+func (m *MySQL) Snapshot(ctx context.Context, take func(ctx context.Context) error) (map[string]string, error) {
+	dsn := m.DSN
+	if dsn == DefaultMySQLDSN {
+		options, err := readMySQLOptions(m.optionFiles)
+		if err != nil {
+			return nil, err
+		}
+
+		dsn = mysqlOptionsDSN(options)
+	}
+
+	session, err := m.connect(ctx, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to MySQL: %w", err)
+	}
+
+	defer func() { _ = session.Close() }()
+
+	version, err := session.version(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting MySQL version: %w", err)
+	}
+
+	logged := false
+
+	if hasLogStatus(version) {
+		logged, err = mysqlLogging(ctx, session)
+		if err != nil {
+			return nil, fmt.Errorf("error getting MySQL binary logging: %w", err)
+		}
+	}
+
+	lock := mysqlLockFor(version, logged)
+
+	err = m.lock(ctx, session, lock)
+	if err != nil {
+		return nil, fmt.Errorf("error locking MySQL: %w", err)
+	}
+
+	// the server is unlocked even when interrupted, closing the session would do it too but only once the driver
+	// notices
+	defer func() { _ = session.exec(context.WithoutCancel(ctx), lock.unlock) }()
+
+	properties := map[string]string{}
+
+	if lock.position != "" {
+		row, err := session.queryRow(ctx, lock.position)
+		if err != nil {
+			return nil, fmt.Errorf("error getting MySQL binary log position: %w", err)
+		}
+
+		properties, err = binlogProperties(row)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = take(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return properties, nil
+}
+
+// mysqlLogging reports whether the server has binary logging or GTIDs on, so that the snapshot's position matters
+func mysqlLogging(ctx context.Context, session mysqlSession) (bool, error) {
+	row, err := session.queryRow(ctx, mysqlLoggingQuery)
+	if err != nil {
+		return false, err //nolint:wrapcheck
+	}
+
+	return row["log_bin"] == "1" || (row["gtid_mode"] != "" && row["gtid_mode"] != "OFF"), nil
+}
+
+// lock takes the lock, waiting for it for at most the LockWaitTimeout
+func (m *MySQL) lock(ctx context.Context, session mysqlSession, lock mysqlLock) error {
+	seconds := max(int(m.LockWaitTimeout.Seconds()), 1)
+
+	err := session.exec(ctx, "SET SESSION lock_wait_timeout = ?", seconds)
+	if err != nil {
+		return err
+	}
+
+	// the server gives up on the metadata locks after lock_wait_timeout, the deadline is for anything else it
+	// might wait on
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(seconds)*time.Second)
+	defer cancel()
+
+	return session.exec(ctx, lock.lock)
+}
+
+// binlogProperties returns the properties for a row of SHOW MASTER STATUS or performance_schema.log_status
+func binlogProperties(row map[string]string) (map[string]string, error) {
+	properties := map[string]string{}
+
+	file, position, gtids := row["File"], row["Position"], row["Executed_Gtid_Set"]
+
+	if local, ok := row["LOCAL"]; ok {
+		var status struct {
+			File     string `json:"binary_log_file"`
+			Position int64  `json:"binary_log_position"`
+			GTIDs    string `json:"gtid_executed"`
+		}
+
+		err := json.Unmarshal([]byte(local), &status)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing MySQL log status: %w", err)
+		}
+
+		file, position, gtids = status.File, strconv.FormatInt(status.Position, 10), status.GTIDs
+	}
+
+	// there is no position when binary logging is off
+	if file != "" {
+		properties[BinlogPositionProperty] = file + ":" + position
+	}
+
+	// GTID sets are split over lines when long
+	gtids = strings.ReplaceAll(gtids, "\n", "")
+	if gtids != "" {
+		properties[GTIDExecutedProperty] = gtids
+	}
+
+	return properties, nil
+}
+
+// sqlMySQLSession is a mysqlSession on a database/sql connection
+type sqlMySQLSession struct {
+	db   *sql.DB
+	conn *sql.Conn
+}
+
+func connectMySQL(ctx context.Context, dsn string) (mysqlSession, error) {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	connector, err := mysql.NewConnector(cfg)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	db := sql.OpenDB(connector)
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		_ = db.Close()
+
+		return nil, err //nolint:wrapcheck
+	}
+
+	return &sqlMySQLSession{db: db, conn: conn}, nil
+}
+
+func (s *sqlMySQLSession) version(ctx context.Context) (string, error) {
+	var version string
+
+	err := s.conn.QueryRowContext(ctx, "SELECT VERSION()").Scan(&version)
+
+	return version, err //nolint:wrapcheck
+}
+
+func (s *sqlMySQLSession) exec(ctx context.Context, query string, args ...any) error {
+	_, err := s.conn.ExecContext(ctx, query, args...)
+
+	return err //nolint:wrapcheck
+}
+
+func (s *sqlMySQLSession) queryRow(ctx context.Context, query string) (map[string]string, error) {
+	rows, err := s.conn.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	defer func() { _ = rows.Close() }()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	if !rows.Next() {
+		return nil, rows.Err() //nolint:wrapcheck
+	}
+
+	values := make([]sql.NullString, len(columns))
+	dest := make([]any, len(columns))
+
+	for index := range values {
+		dest[index] = &values[index]
+	}
+
+	err = rows.Scan(dest...)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	row := make(map[string]string, len(columns))
+	for index, column := range columns {
+		row[column] = values[index].String
+	}
+
+	return row, nil
+}
+
+func (s *sqlMySQLSession) Close() error {
+	return errors.Join(s.conn.Close(), s.db.Close())
+}
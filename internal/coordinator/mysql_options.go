@@ -0,0 +1,116 @@
+package coordinator
+
+import (
+	"bufio"
+	"cmp"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// mysqlDefaultSocket is the socket connected to when the option files don't name one, that of the FreeBSD port
+const mysqlDefaultSocket = "/tmp/mysql.sock"
+
+// defaultMySQLOptionFiles returns the option files the mysql client reads, the later ones winning
+func defaultMySQLOptionFiles() []string {
+	files := []string{"/etc/my.cnf", "/etc/mysql/my.cnf", "/usr/local/etc/my.cnf", "/usr/local/etc/mysql/my.cnf"}
+
+	home, err := os.UserHomeDir()
+	if err == nil {
+		files = append(files, filepath.Join(home, ".my.cnf"))
+	}
+
+	return files
+}
+
+// readMySQLOptions returns the options of the [client] and [mysql] groups of the option files which exist, as the
+// mysql client would use them
+func readMySQLOptions(paths []string) (map[string]string, error) {
+	options := map[string]string{}
+
+	for _, path := range paths {
+		err := readMySQLOptionFile(path, options)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return options, nil
+}
+
+// readMySQLOptionFile adds the options of the [client] and [mysql] groups of the file at path, if it exists, to
+// options. Directives such as !include are ignored.
+func readMySQLOptionFile(path string, options map[string]string) error {
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("error reading MySQL options: %w", err)
+	}
+
+	defer func() { _ = file.Close() }()
+
+	inGroup := false
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "!"):
+			continue
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			group := strings.ToLower(strings.TrimSpace(line[1 : len(line)-1]))
+			inGroup = group == "client" || group == "mysql"
+
+			continue
+		case !inGroup:
+			continue
+		}
+
+		name, value, _ := strings.Cut(line, "=")
+		name = strings.ReplaceAll(strings.TrimSpace(name), "_", "-")
+		value = strings.TrimSpace(value)
+
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		} else if index := strings.Index(value, " #"); index >= 0 {
+			value = strings.TrimSpace(value[:index])
+		}
+
+		options[name] = value
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return fmt.Errorf("error reading MySQL options: %w", err)
+	}
+
+	return nil
+}
+
+// mysqlOptionsDSN returns the data source name connecting as the user, with the password, to the socket or host
+// and port of options. Like the mysql client, localhost is reached over the socket, and root over
+// mysqlDefaultSocket is the default.
+func mysqlOptionsDSN(options map[string]string) string {
+	cfg := mysql.NewConfig()
+	cfg.User = cmp.Or(options["user"], "root")
+	cfg.Passwd = options["password"]
+	cfg.Net = "unix"
+	cfg.Addr = cmp.Or(options["socket"], mysqlDefaultSocket)
+
+	if host := options["host"]; host != "" && host != "localhost" {
+		cfg.Net = "tcp"
+		cfg.Addr = net.JoinHostPort(host, cmp.Or(options["port"], "3306"))
+	}
+
+	return cfg.FormatDSN()
+}
@@ -0,0 +1,109 @@
+package coordinator
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_mysqlOptionsDSN(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+
+		err := os.WriteFile(path, []byte(content), 0o600)
+		if err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+
+		return path
+	}
+
+	global := write("my.cnf", `# the server's settings
+[mysqld]
+socket = /var/run/mysqld/mysqld.sock
+user = mysql
+
+[client]
+socket = /var/run/mysql/mysql.sock
+!includedir /etc/mysql/conf.d/
+`)
+	home := write(".my.cnf", `[client]
+user=backup
+password="s3cret #1"
+`)
+	remote := write("remote.cnf", `[mysql]
+host = db.example.com
+port = 3307 # the replica
+`)
+
+	tests := []struct {
+		name  string
+		files []string
+		want  string
+	}{
+		{name: "none", files: nil, want: "root@unix(/tmp/mysql.sock)/"},
+		{name: "missing", files: []string{filepath.Join(dir, "missing.cnf")}, want: "root@unix(/tmp/mysql.sock)/"},
+		{name: "client", files: []string{global}, want: "root@unix(/var/run/mysql/mysql.sock)/"},
+		{
+			name:  "home wins",
+			files: []string{global, home},
+			want:  "backup:s3cret #1@unix(/var/run/mysql/mysql.sock)/",
+		},
+		{name: "host", files: []string{home, remote}, want: "backup:s3cret #1@tcp(db.example.com:3307)/"},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			options, err := readMySQLOptions(testCase.files)
+			if err != nil {
+				t.Fatalf("readMySQLOptions() error = %v", err)
+			}
+
+			if got := mysqlOptionsDSN(options); got != testCase.want {
+				t.Errorf("mysqlOptionsDSN() = %v, want %v", got, testCase.want)
+			}
+		})
+	}
+}
+
+func TestMySQL_SnapshotOptionFiles(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), ".my.cnf")
+
+	err := os.WriteFile(path, []byte("[client]\nuser = backup\nsocket = /var/run/mysql.sock\n"), 0o600)
+	if err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	for _, testCase := range []struct{ dsn, want string }{
+		{dsn: DefaultMySQLDSN, want: "backup@unix(/var/run/mysql.sock)/"},
+		{dsn: "root@tcp(127.0.0.1:3306)/", want: "root@tcp(127.0.0.1:3306)/"},
+	} {
+		var got string
+
+		coordinator := NewMySQL(testCase.dsn)
+		coordinator.optionFiles = []string{path}
+		coordinator.connect = func(_ context.Context, dsn string) (mysqlSession, error) {
+			got = dsn
+
+			return &fakeMySQLSession{serverVersion: "5.7.44"}, nil
+		}
+
+		_, err = coordinator.Snapshot(t.Context(), func(_ context.Context) error { return nil })
+		if err != nil {
+			t.Fatalf("Snapshot() error = %v", err)
+		}
+
+		if got != testCase.want {
+			t.Errorf("Snapshot() connected with %v, want %v", got, testCase.want)
+		}
+	}
+}
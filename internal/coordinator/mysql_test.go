@@ -0,0 +1,269 @@
+package coordinator
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+)
+
+var errLockWaitTimeout = errors.New("lock wait timeout exceeded; try restarting transaction")
+
+// fakeMySQLSession records the statements run on it
+type fakeMySQLSession struct {
+	serverVersion string
+	lockErr       error
+	row           map[string]string
+	logging       map[string]string
+	statements    []string
+	closed        bool
+}
+
+func (f *fakeMySQLSession) version(_ context.Context) (string, error) {
+	return f.serverVersion, nil
+}
+
+func (f *fakeMySQLSession) exec(_ context.Context, query string, _ ...any) error {
+	f.statements = append(f.statements, query)
+
+	if query == flushTablesLock.lock || query == backupLock.lock {
+		return f.lockErr
+	}
+
+	return nil
+}
+
+func (f *fakeMySQLSession) queryRow(_ context.Context, query string) (map[string]string, error) {
+	f.statements = append(f.statements, query)
+
+	if query == mysqlLoggingQuery {
+		return f.logging, nil
+	}
+
+	return f.row, nil
+}
+
+func (f *fakeMySQLSession) Close() error {
+	f.closed = true
+
+	return nil
+}
+
+func TestMySQL_Snapshot(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		session        *fakeMySQLSession
+		takeErr        error
+		wantTaken      bool
+		wantStatements []string
+		wantProperties map[string]string
+		wantErr        error
+	}{
+		{
+			name: "flushTables",
+			session: &fakeMySQLSession{
+				serverVersion: "5.7.44-log",
+				row:           map[string]string{"File": "mysql-bin.000003", "Position": "154", "Executed_Gtid_Set": ""},
+			},
+			wantTaken: true,
+			wantStatements: []string{
+				"SET SESSION lock_wait_timeout = ?",
+				"FLUSH TABLES WITH READ LOCK",
+				"SHOW MASTER STATUS",
+				"UNLOCK TABLES",
+			},
+			wantProperties: map[string]string{BinlogPositionProperty: "mysql-bin.000003:154"},
+		},
+		{
+			name: "mariaDB",
+			session: &fakeMySQLSession{
+				serverVersion: "10.11.6-MariaDB",
+				row:           map[string]string{"File": "mariadb-bin.000012", "Position": "342"},
+			},
+			wantTaken: true,
+			wantStatements: []string{
+				"SET SESSION lock_wait_timeout = ?",
+				"FLUSH TABLES WITH READ LOCK",
+				"SHOW MASTER STATUS",
+				"UNLOCK TABLES",
+			},
+			wantProperties: map[string]string{BinlogPositionProperty: "mariadb-bin.000012:342"},
+		},
+		{
+			name: "flushTablesLogStatus",
+			session: &fakeMySQLSession{
+				serverVersion: "8.0.36",
+				logging:       map[string]string{"log_bin": "1", "gtid_mode": "ON"},
+				row: map[string]string{"LOCAL": `{"gtid_executed": "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5",` +
+					` "binary_log_file": "binlog.000002", "binary_log_position": 1234}`},
+			},
+			wantTaken: true,
+			wantStatements: []string{
+				mysqlLoggingQuery,
+				"SET SESSION lock_wait_timeout = ?",
+				"FLUSH TABLES WITH READ LOCK",
+				"SELECT LOCAL FROM performance_schema.log_status",
+				"UNLOCK TABLES",
+			},
+			wantProperties: map[string]string{
+				BinlogPositionProperty: "binlog.000002:1234",
+				GTIDExecutedProperty:   "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5",
+			},
+		},
+		{
+			name: "gtidsWithoutBinaryLog",
+			session: &fakeMySQLSession{
+				serverVersion: "8.4.0",
+				logging:       map[string]string{"log_bin": "0", "gtid_mode": "ON"},
+				row: map[string]string{"LOCAL": `{"gtid_executed": "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5",` +
+					` "binary_log_file": "", "binary_log_position": 0}`},
+			},
+			wantTaken: true,
+			wantStatements: []string{
+				mysqlLoggingQuery,
+				"SET SESSION lock_wait_timeout = ?",
+				"FLUSH TABLES WITH READ LOCK",
+				"SELECT LOCAL FROM performance_schema.log_status",
+				"UNLOCK TABLES",
+			},
+			wantProperties: map[string]string{GTIDExecutedProperty: "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5"},
+		},
+		{
+			name: "backupLock",
+			session: &fakeMySQLSession{
+				serverVersion: "8.0.36",
+				logging:       map[string]string{"log_bin": "0", "gtid_mode": "OFF"},
+			},
+			wantTaken: true,
+			wantStatements: []string{
+				mysqlLoggingQuery,
+				"SET SESSION lock_wait_timeout = ?",
+				"LOCK INSTANCE FOR BACKUP",
+				"UNLOCK INSTANCE",
+			},
+			wantProperties: map[string]string{},
+		},
+		{
+			name: "beforeLogStatus",
+			session: &fakeMySQLSession{
+				serverVersion: "8.0.13",
+				row:           map[string]string{"File": "binlog.000001", "Position": "155"},
+			},
+			wantTaken: true,
+			wantStatements: []string{
+				"SET SESSION lock_wait_timeout = ?",
+				"FLUSH TABLES WITH READ LOCK",
+				"SHOW MASTER STATUS",
+				"UNLOCK TABLES",
+			},
+			wantProperties: map[string]string{BinlogPositionProperty: "binlog.000001:155"},
+		},
+		{
+			name:      "binaryLogOff",
+			session:   &fakeMySQLSession{serverVersion: "5.7.44"},
+			wantTaken: true,
+			wantStatements: []string{
+				"SET SESSION lock_wait_timeout = ?",
+				"FLUSH TABLES WITH READ LOCK",
+				"SHOW MASTER STATUS",
+				"UNLOCK TABLES",
+			},
+			wantProperties: map[string]string{},
+		},
+		{
+			name: "lockTimedOut",
+			session: &fakeMySQLSession{
+				serverVersion: "8.4.0",
+				logging:       map[string]string{"log_bin": "0", "gtid_mode": "OFF"},
+				lockErr:       errLockWaitTimeout,
+			},
+			wantStatements: []string{
+				mysqlLoggingQuery,
+				"SET SESSION lock_wait_timeout = ?",
+				"LOCK INSTANCE FOR BACKUP",
+			},
+			wantErr: errLockWaitTimeout,
+		},
+		{
+			name: "takeFailed",
+			session: &fakeMySQLSession{
+				serverVersion: "8.0.36",
+				logging:       map[string]string{"log_bin": "0", "gtid_mode": "OFF"},
+			},
+			takeErr:   errSnapshot,
+			wantTaken: true,
+			wantStatements: []string{
+				mysqlLoggingQuery,
+				"SET SESSION lock_wait_timeout = ?",
+				"LOCK INSTANCE FOR BACKUP",
+				"UNLOCK INSTANCE",
+			},
+			wantErr: errSnapshot,
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			coordinator := NewMySQL("")
+			coordinator.LockWaitTimeout = time.Second
+			coordinator.optionFiles = nil
+			coordinator.connect = func(_ context.Context, _ string) (mysqlSession, error) {
+				return testCase.session, nil
+			}
+
+			taken := false
+
+			properties, err := coordinator.Snapshot(t.Context(), func(_ context.Context) error {
+				taken = true
+
+				return testCase.takeErr
+			})
+			if !errors.Is(err, testCase.wantErr) {
+				t.Fatalf("Snapshot() error = %v, want %v", err, testCase.wantErr)
+			}
+
+			if taken != testCase.wantTaken {
+				t.Errorf("Snapshot() taken = %v, want %v", taken, testCase.wantTaken)
+			}
+
+			if diff := deep.Equal(testCase.session.statements, testCase.wantStatements); diff != nil {
+				t.Error(diff)
+			}
+
+			if diff := deep.Equal(properties, testCase.wantProperties); diff != nil {
+				t.Error(diff)
+			}
+
+			if !testCase.session.closed {
+				t.Error("Snapshot() left the session open")
+			}
+		})
+	}
+}
+
+func Test_hasLogStatus(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]bool{
+		"5.7.44-log":      false,
+		"8.0.13":          false,
+		"8.0.14":          true,
+		"8.0.36-0ubuntu1": true,
+		"8.4.0":           true,
+		"9.1.0":           true,
+		"10.11.6-MariaDB": false,
+		"unknown":         false,
+	}
+
+	for version, want := range tests {
+		if got := hasLogStatus(version); got != want {
+			t.Errorf("hasLogStatus(%q) = %v, want %v", version, got, want)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+// Package coordinator makes databases consistent on disk while their datasets are snapshotted
+package coordinator
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+var ErrUnsupportedVersion = errors.New("unsupported server version")
+
+// DefaultPostgresDSN connects to the postgres database, the PG* environment variables fill in the rest
+const DefaultPostgresDSN = "dbname=postgres"
+
+// BackupLabelProperty is the snapshot user property PostgreSQL's backup_label is stored in. It is needed to
+// restore the snapshot: write it to backup_label in the data directory before starting the server.
+const BackupLabelProperty = "com.sun:auto-snapshot-backup-label"
+
+// TablespaceMapProperty is the snapshot user property PostgreSQL's tablespace_map is stored in, when there is one
+const TablespaceMapProperty = "com.sun:auto-snapshot-tablespace-map"
+
+// backupQueries are the statements which start and stop a non-exclusive backup
+type backupQueries struct {
+	start string
+	stop  string
+}
+
+// postgresBackupQueries returns the backup statements for a server of version, as in server_version_num.
+// PostgreSQL 15 renamed pg_start_backup and pg_stop_backup, non-exclusive backups came in with 9.6.
+func postgresBackupQueries(version int) (backupQueries, error) {
+	switch {
+	case version >= 150000: //nolint:mnd
+		return backupQueries{
+			start: "SELECT pg_backup_start($1, true)",
+			stop:  "SELECT labelfile, spcmapfile FROM pg_backup_stop(true)",
+		}, nil
+
+	case version >= 90600: //nolint:mnd
+		return backupQueries{
+			start: "SELECT pg_start_backup($1, true, false)",
+			stop:  "SELECT labelfile, spcmapfile FROM pg_stop_backup(false)",
+		}, nil
+	}
+
+	return backupQueries{}, fmt.Errorf("%w: PostgreSQL %d", ErrUnsupportedVersion, version)
+}
+
+// postgresSession is the one connection a backup is started and stopped on, as a non-exclusive backup is
+// aborted when the session which started it ends
+type postgresSession interface {
+	version(ctx context.Context) (int, error)
+	exec(ctx context.Context, query string, args ...any) error
+	stop(ctx context.Context, query string) (string, string, error)
+	Close() error
+}
+
+// Postgres is a Coordinator for the data directory of a PostgreSQL server
+type Postgres struct {
+	// DSN is the connection string, the PG* environment variables fill in what it leaves out
+	DSN string
+	// Label is the label of the backups
+	Label string
+
+	connect func(ctx context.Context, dsn string) (postgresSession, error)
+}
+
+// NewPostgres returns a Postgres Coordinator which connects with dsn
+func NewPostgres(dsn string) *Postgres {
+	return &Postgres{
+		DSN:     dsn,
+		Label:   "zfs-auto-snapshot",
+		connect: connectPostgres,
+	}
+}
+
+// Snapshot starts a backup, calls take and stops the backup, all in one session. Nothing is taken when the backup
+// can't be started. The backup is stopped even when take fails, returning the backup_label and tablespace_map as
+// properties when it succeeds.
+func (p *Postgres) Snapshot(ctx context.Context, take func(ctx context.Context) error) (map[string]string, error) {
+	session, err := p.connect(ctx, p.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to PostgreSQL: %w", err)
+	}
+
+	defer func() { _ = session.Close() }()
+
+	version, err := session.version(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting PostgreSQL version: %w", err)
+	}
+
+	queries, err := postgresBackupQueries(version)
+	if err != nil {
+		return nil, err
+	}
+
+	err = session.exec(ctx, queries.start, p.Label)
+	if err != nil {
+		return nil, fmt.Errorf("error starting PostgreSQL backup: %w", err)
+	}
+
+	takeErr := take(ctx)
+
+	// the backup is stopped even when interrupted, so it isn't left running until the session ends
+	label, tablespaceMap, err := session.stop(context.WithoutCancel(ctx), queries.stop)
+	if takeErr != nil {
+		return nil, takeErr
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error stopping PostgreSQL backup: %w", err)
+	}
+
+	properties := map[string]string{BackupLabelProperty: label}
+	if tablespaceMap != "" {
+		properties[TablespaceMapProperty] = tablespaceMap
+	}
+
+	return properties, nil
+}
+
+// sqlPostgresSession is a postgresSession on a database/sql connection
+type sqlPostgresSession struct {
+	db   *sql.DB
+	conn *sql.Conn
+}
+
+func connectPostgres(ctx context.Context, dsn string) (postgresSession, error) {
+	connector, err := pq.NewConnector(dsn)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	db := sql.OpenDB(connector)
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		_ = db.Close()
+
+		return nil, err //nolint:wrapcheck
+	}
+
+	return &sqlPostgresSession{db: db, conn: conn}, nil
+}
+
+func (s *sqlPostgresSession) version(ctx context.Context) (int, error) {
+	var version int
+
+	err := s.conn.QueryRowContext(ctx, "SELECT current_setting('server_version_num')::int").Scan(&version)
+
+	return version, err //nolint:wrapcheck
+}
+
+func (s *sqlPostgresSession) exec(ctx context.Context, query string, args ...any) error {
+	_, err := s.conn.ExecContext(ctx, query, args...)
+
+	return err //nolint:wrapcheck
+}
+
+func (s *sqlPostgresSession) stop(ctx context.Context, query string) (string, string, error) {
+	var label, tablespaceMap sql.NullString
+
+	err := s.conn.QueryRowContext(ctx, query).Scan(&label, &tablespaceMap)
+
+	return label.String, tablespaceMap.String, err //nolint:wrapcheck
+}
+
+func (s *sqlPostgresSession) Close() error {
+	return errors.Join(s.conn.Close(), s.db.Close())
+}
@@ -0,0 +1,151 @@
+package coordinator
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+var (
+	errConnection = errors.New("connection refused")
+	errRecovery   = errors.New("recovery is in progress")
+	errSnapshot   = errors.New("zfs snapshot failed")
+)
+
+// fakeSession records the statements run on it
+type fakeSession struct {
+	serverVersion int
+	startErr      error
+	statements    []string
+	closed        bool
+}
+
+func (f *fakeSession) version(_ context.Context) (int, error) {
+	return f.serverVersion, nil
+}
+
+func (f *fakeSession) exec(_ context.Context, query string, _ ...any) error {
+	f.statements = append(f.statements, query)
+
+	return f.startErr
+}
+
+func (f *fakeSession) stop(_ context.Context, query string) (string, string, error) {
+	f.statements = append(f.statements, query)
+
+	return "START WAL LOCATION: 0/2000028\n", "", nil
+}
+
+func (f *fakeSession) Close() error {
+	f.closed = true
+
+	return nil
+}
+
+func TestPostgres_Snapshot(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		session        *fakeSession
+		connectErr     error
+		takeErr        error
+		wantTaken      bool
+		wantStatements []string
+		wantProperties map[string]string
+		wantErr        error
+	}{
+		{
+			name:      "modern",
+			session:   &fakeSession{serverVersion: 160002},
+			wantTaken: true,
+			wantStatements: []string{
+				"SELECT pg_backup_start($1, true)",
+				"SELECT labelfile, spcmapfile FROM pg_backup_stop(true)",
+			},
+			wantProperties: map[string]string{BackupLabelProperty: "START WAL LOCATION: 0/2000028\n"},
+		},
+		{
+			name:      "legacy",
+			session:   &fakeSession{serverVersion: 90624},
+			wantTaken: true,
+			wantStatements: []string{
+				"SELECT pg_start_backup($1, true, false)",
+				"SELECT labelfile, spcmapfile FROM pg_stop_backup(false)",
+			},
+			wantProperties: map[string]string{BackupLabelProperty: "START WAL LOCATION: 0/2000028\n"},
+		},
+		{
+			name:    "unsupported",
+			session: &fakeSession{serverVersion: 90500},
+			wantErr: ErrUnsupportedVersion,
+		},
+		{
+			name:       "connectFailed",
+			session:    &fakeSession{},
+			connectErr: errConnection,
+			wantErr:    errConnection,
+		},
+		{
+			name:           "startFailed",
+			session:        &fakeSession{serverVersion: 170000, startErr: errRecovery},
+			wantStatements: []string{"SELECT pg_backup_start($1, true)"},
+			wantErr:        errRecovery,
+		},
+		{
+			name:      "takeFailed",
+			session:   &fakeSession{serverVersion: 170000},
+			takeErr:   errSnapshot,
+			wantTaken: true,
+			wantStatements: []string{
+				"SELECT pg_backup_start($1, true)",
+				"SELECT labelfile, spcmapfile FROM pg_backup_stop(true)",
+			},
+			wantErr: errSnapshot,
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			postgres := NewPostgres("")
+			postgres.connect = func(_ context.Context, _ string) (postgresSession, error) {
+				if testCase.connectErr != nil {
+					return nil, testCase.connectErr
+				}
+
+				return testCase.session, nil
+			}
+
+			taken := false
+
+			properties, err := postgres.Snapshot(t.Context(), func(_ context.Context) error {
+				taken = true
+
+				return testCase.takeErr
+			})
+			if !errors.Is(err, testCase.wantErr) {
+				t.Fatalf("Snapshot() error = %v, want %v", err, testCase.wantErr)
+			}
+
+			if taken != testCase.wantTaken {
+				t.Errorf("Snapshot() taken = %v, want %v", taken, testCase.wantTaken)
+			}
+
+			if diff := deep.Equal(testCase.session.statements, testCase.wantStatements); diff != nil {
+				t.Error(diff)
+			}
+
+			if diff := deep.Equal(properties, testCase.wantProperties); diff != nil {
+				t.Error(diff)
+			}
+
+			if testCase.connectErr == nil && !testCase.session.closed {
+				t.Error("Snapshot() left the session open")
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+// Package lock keeps the runs of the zfstools commands on a pool from overlapping, with an advisory lock on a file
+// for each pool.
+package lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DefaultDir is where the lock files of the pools are
+const DefaultDir = "/var/run"
+
+// WaitForever is the wait of Acquire which waits for as long as the other runs take
+const WaitForever time.Duration = -1
+
+var ErrLocked = errors.New("locked by another run")
+
+// retryInterval is how often a lock held by another process is tried again
+const retryInterval = 250 * time.Millisecond
+
+// Lock is the lock of one or more pools, held until it is released
+type Lock struct {
+	files []*os.File
+}
+
+// Path returns the lock file of pool in dir
+func Path(dir, pool string) string {
+	return filepath.Join(dir, "zfstools."+pool+".lock")
+}
+
+// Acquire locks the pools, one after the other in order of their names so that runs locking several of them don't
+// deadlock, and writes the PID and command line of this process into their lock files. While another process holds
+// one of them it waits for it, until wait has elapsed or ctx is done, and then fails with ErrLocked naming that
+// process. None of the pools are locked when it fails.
+func Acquire(ctx context.Context, dir string, pools []string, wait time.Duration) (*Lock, error) {
+	lock := &Lock{}
+	deadline := time.Now().Add(wait)
+
+	for _, pool := range slices.Sorted(slices.Values(pools)) {
+		file, err := acquire(ctx, dir, pool, wait, deadline)
+		if err != nil {
+			_ = lock.Release()
+
+			return nil, err
+		}
+
+		lock.files = append(lock.files, file)
+	}
+
+	return lock, nil
+}
+
+// acquire locks the lock file of pool, see Acquire
+func acquire(ctx context.Context, dir, pool string, wait time.Duration, deadline time.Time) (*os.File, error) {
+	file, err := os.OpenFile(Path(dir, pool), os.O_RDWR|os.O_CREATE, 0o644) //nolint:mnd
+	if err != nil {
+		return nil, fmt.Errorf("error locking pool %s: %w", pool, err)
+	}
+
+	for {
+		locked, err := tryLock(file)
+		if err != nil {
+			_ = file.Close()
+
+			return nil, fmt.Errorf("error locking pool %s: %w", pool, err)
+		}
+
+		if locked {
+			break
+		}
+
+		if ctx.Err() != nil || (wait != WaitForever && !time.Now().Before(deadline)) {
+			holder := holder(file)
+			_ = file.Close()
+
+			return nil, fmt.Errorf("%w: pool %s is locked by %s", ErrLocked, pool, holder)
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(retryInterval):
+		}
+	}
+
+	command := append([]string{filepath.Base(os.Args[0])}, os.Args[1:]...)
+	owner := fmt.Sprintf("%d %s\n", os.Getpid(), strings.Join(command, " "))
+
+	err = file.Truncate(0)
+	if err == nil {
+		_, err = file.WriteAt([]byte(owner), 0)
+	}
+
+	if err != nil {
+		_ = file.Close()
+
+		return nil, fmt.Errorf("error locking pool %s: %w", pool, err)
+	}
+
+	return file, nil
+}
+
+// holder returns which process holds the lock of file, as written into it when it was locked
+func holder(file *os.File) string {
+	owner, err := os.ReadFile(file.Name())
+
+	pid, command, _ := strings.Cut(strings.TrimSpace(string(owner)), " ")
+	if err != nil || pid == "" {
+		return "another process"
+	}
+
+	if command == "" {
+		return "process " + pid
+	}
+
+	return fmt.Sprintf("process %s (%s)", pid, command)
+}
+
+// Release unlocks the pools. The lock files are left behind, removing them would let two runs lock different files
+// of the same pool.
+func (l *Lock) Release() error {
+	var errs []error
+
+	for _, file := range slices.Backward(l.files) {
+		errs = append(errs, file.Truncate(0), file.Close())
+	}
+
+	l.files = nil
+
+	return errors.Join(errs...)
+}
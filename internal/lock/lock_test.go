@@ -0,0 +1,64 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAcquire(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	held, err := Acquire(t.Context(), dir, []string{"tank", "backup"}, 0)
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+
+	owner, err := os.ReadFile(Path(dir, "tank"))
+	if err != nil || !strings.HasPrefix(string(owner), fmt.Sprintf("%d ", os.Getpid())) {
+		t.Errorf("lock file = %q, %v, want this process's PID", owner, err)
+	}
+
+	_, err = Acquire(t.Context(), dir, []string{"other", "tank"}, 0)
+	if !errors.Is(err, ErrLocked) || !strings.Contains(err.Error(), fmt.Sprintf("pool tank is locked by process %d (",
+		os.Getpid())) {
+		t.Errorf("Acquire() error = %v, want %v naming this process", err, ErrLocked)
+	}
+
+	// pools locked before the one which couldn't be are released
+	other, err := Acquire(t.Context(), dir, []string{"other"}, 0)
+	if err != nil {
+		t.Fatalf("Acquire() error = %v after a failed lock", err)
+	}
+
+	err = other.Release()
+	if err != nil {
+		t.Errorf("Release() error = %v", err)
+	}
+
+	time.AfterFunc(50*time.Millisecond, func() { _ = held.Release() })
+
+	waited, err := Acquire(t.Context(), dir, []string{"tank"}, WaitForever)
+	if err != nil {
+		t.Fatalf("Acquire() error = %v while waiting", err)
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err = Acquire(ctx, dir, []string{"tank"}, WaitForever)
+	if !errors.Is(err, ErrLocked) {
+		t.Errorf("Acquire() error = %v once ctx is done, want %v", err, ErrLocked)
+	}
+
+	err = waited.Release()
+	if err != nil {
+		t.Errorf("Release() error = %v", err)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package report
+
+import "os"
+
+// lockFile always succeeds where flock isn't available, writers aren't kept from overlapping
+func lockFile(_ *os.File) error {
+	return nil
+}
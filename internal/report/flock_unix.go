@@ -0,0 +1,13 @@
+//go:build unix
+
+package report
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive flock on file, waiting for whoever holds it
+func lockFile(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_EX) //nolint:wrapcheck
+}
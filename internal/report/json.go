@@ -0,0 +1,112 @@
+package report
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// jsonEvent is how an Event is written by JSON
+type jsonEvent struct {
+	Time            string  `json:"time"`
+	Type            string  `json:"event"`
+	Dataset         string  `json:"dataset,omitempty"`
+	Snapshot        string  `json:"snapshot,omitempty"`
+	Interval        string  `json:"interval,omitempty"`
+	Error           string  `json:"error,omitempty"`
+	BytesReclaimed  int64   `json:"bytes_reclaimed,omitempty"`
+	DurationSeconds float64 `json:"duration_seconds,omitempty"`
+	DryRun          bool    `json:"dry_run,omitempty"`
+}
+
+// jsonSummary is the final object written by JSON
+type jsonSummary struct {
+	Time               string  `json:"time"`
+	Type               string  `json:"event"`
+	Interval           string  `json:"interval,omitempty"`
+	Interrupted        string  `json:"interrupted,omitempty"`
+	Created            int     `json:"created"`
+	Destroyed          int     `json:"destroyed"`
+	ZeroSizedDestroyed int     `json:"zero_sized_destroyed"`
+	Excluded           int     `json:"excluded"`
+	Held               int     `json:"held"`
+	Errors             int     `json:"errors"`
+	BytesReclaimed     int64   `json:"bytes_reclaimed"`
+	DurationSeconds    float64 `json:"duration_seconds"`
+	ExitStatus         int     `json:"exit_status"`
+	DryRun             bool    `json:"dry_run,omitempty"`
+}
+
+// JSON is a Reporter which writes each event as a line of JSON, followed by a summary of the run
+type JSON struct {
+	start   time.Time
+	now     func() time.Time
+	encoder *json.Encoder
+	summary Summary
+	mutex   sync.Mutex
+}
+
+// NewJSON returns a JSON Reporter writing to writer, the run is timed from now
+func NewJSON(writer io.Writer) *JSON {
+	return &JSON{
+		start:   time.Now(),
+		now:     time.Now,
+		encoder: json.NewEncoder(writer),
+	}
+}
+
+// Report writes the event, timestamped now if it has no Time
+func (j *JSON) Report(event Event) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if event.Time.IsZero() {
+		event.Time = j.now()
+	}
+
+	j.summary.Add(event)
+
+	_ = j.encoder.Encode(jsonEvent{
+		Time:            event.Time.Format(time.RFC3339Nano),
+		Type:            event.Type,
+		Dataset:         event.Dataset,
+		Snapshot:        event.Snapshot,
+		Interval:        event.Interval,
+		Error:           event.Error,
+		BytesReclaimed:  event.Bytes,
+		DurationSeconds: event.Duration.Seconds(),
+		DryRun:          event.DryRun,
+	})
+}
+
+// Finish writes the summary of the run: the counts of the events reported, the exit status and, when the run was
+// interrupted, why
+func (j *JSON) Finish(interval string, dryRun bool, status int, interrupted error) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	now := j.now()
+
+	summary := jsonSummary{
+		Time:               now.Format(time.RFC3339Nano),
+		Type:               "summary",
+		Interval:           interval,
+		Created:            j.summary.Created,
+		Destroyed:          j.summary.Destroyed,
+		ZeroSizedDestroyed: j.summary.ZeroSizedDestroyed,
+		Excluded:           j.summary.Excluded,
+		Held:               j.summary.Held,
+		Errors:             j.summary.Errors,
+		BytesReclaimed:     j.summary.BytesReclaimed,
+		DurationSeconds:    now.Sub(j.start).Seconds(),
+		ExitStatus:         status,
+		DryRun:             dryRun,
+	}
+
+	if interrupted != nil {
+		summary.Interrupted = interrupted.Error()
+	}
+
+	_ = j.encoder.Encode(summary)
+}
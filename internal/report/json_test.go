@@ -0,0 +1,55 @@
+package report
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+var errInterrupted = errors.New("received signal interrupt")
+
+func TestJSON(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	writer := &bytes.Buffer{}
+
+	events := NewJSON(writer)
+	events.start = start
+	events.now = func() time.Time { return start.Add(90 * time.Second) }
+
+	events.Report(Event{Type: DatasetExcluded, Dataset: "tank/scratch", Interval: "hourly"})
+	events.Report(Event{
+		Type:     SnapshotCreated,
+		Dataset:  "tank/data",
+		Snapshot: "tank/data@zfs-auto-snap_hourly-2025-01-01-00h00",
+		Interval: "hourly",
+		Duration: 250 * time.Millisecond,
+	})
+	events.Report(Event{
+		Time:     start.Add(time.Minute),
+		Type:     SnapshotDestroyed,
+		Dataset:  "tank/data",
+		Snapshot: "tank/data@zfs-auto-snap_hourly-2024-12-31-00h00",
+		Interval: "hourly",
+		Bytes:    4096,
+	})
+	events.Report(Event{Type: Failure, Interval: "hourly", Error: "zfs list: exit status 1"})
+	events.Finish("hourly", false, 1, errInterrupted)
+
+	want := `{"time":"2025-01-01T00:01:30Z","event":"dataset_excluded","dataset":"tank/scratch","interval":"hourly"}
+{"time":"2025-01-01T00:01:30Z","event":"snapshot_created","dataset":"tank/data",` +
+		`"snapshot":"tank/data@zfs-auto-snap_hourly-2025-01-01-00h00","interval":"hourly","duration_seconds":0.25}
+{"time":"2025-01-01T00:01:00Z","event":"snapshot_destroyed","dataset":"tank/data",` +
+		`"snapshot":"tank/data@zfs-auto-snap_hourly-2024-12-31-00h00","interval":"hourly","bytes_reclaimed":4096}
+{"time":"2025-01-01T00:01:30Z","event":"error","interval":"hourly","error":"zfs list: exit status 1"}
+{"time":"2025-01-01T00:01:30Z","event":"summary","interval":"hourly","interrupted":"received signal interrupt",` +
+		`"created":1,"destroyed":1,"zero_sized_destroyed":0,"excluded":1,"held":0,"errors":1,"bytes_reclaimed":4096,` +
+		`"duration_seconds":90,"exit_status":1}
+`
+
+	if writer.String() != want {
+		t.Errorf("JSON wrote\n%s\nwant\n%s", writer.String(), want)
+	}
+}
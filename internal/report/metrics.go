@@ -0,0 +1,286 @@
+package report
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Multi is a Reporter which passes each event on to all of its Reporters
+type Multi []Reporter
+
+func (m Multi) Report(event Event) {
+	for _, reporter := range m {
+		reporter.Report(event)
+	}
+}
+
+// metricFamily describes one of the metrics written by Metrics
+type metricFamily struct {
+	name string
+	help string
+	// timestamp metrics keep their last value, from the previous file, when a run doesn't update them
+	timestamp bool
+}
+
+var metricFamilies = []metricFamily{
+	{name: "zfs_auto_snapshot_snapshots_created", help: "Snapshots created by the last run."},
+	{name: "zfs_auto_snapshot_snapshots_destroyed", help: "Expired snapshots destroyed by the last run."},
+	{name: "zfs_auto_snapshot_zero_sized_destroyed", help: "Zero-sized snapshots destroyed by the last run."},
+	{name: "zfs_auto_snapshot_failures", help: "Snapshots which the last run failed to create or destroy."},
+	{name: "zfs_auto_snapshot_reclaimed_bytes", help: "Space used by the snapshots destroyed by the last run."},
+	{name: "zfs_auto_snapshot_run_duration_seconds", help: "How long the last run took."},
+	{name: "zfs_auto_snapshot_last_run_exit_status", help: "Exit status of the last run."},
+	{name: "zfs_auto_snapshot_last_run_timestamp_seconds", help: "When the last run finished."},
+	{
+		name:      "zfs_auto_snapshot_last_success_timestamp_seconds",
+		help:      "When the last run which had no failures finished.",
+		timestamp: true,
+	},
+	{
+		name:      "zfs_auto_snapshot_last_snapshot_timestamp_seconds",
+		help:      "When a snapshot of the dataset was last created.",
+		timestamp: true,
+	},
+}
+
+var intervalLabel = regexp.MustCompile(`[{,]interval="((?:[^"\\]|\\.)*)"`)
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Metrics is a Reporter which counts events by pool, to be written out for the Prometheus node_exporter
+// textfile collector
+type Metrics struct {
+	start time.Time
+	now   func() time.Time
+	pools map[string]*Summary
+	// lastSnapshot is when each dataset had a snapshot created
+	lastSnapshot map[string]time.Time
+	mutex        sync.Mutex
+}
+
+// NewMetrics returns a Metrics Reporter, the run is timed from now
+func NewMetrics() *Metrics {
+	return &Metrics{
+		start:        time.Now(),
+		now:          time.Now,
+		pools:        map[string]*Summary{},
+		lastSnapshot: map[string]time.Time{},
+	}
+}
+
+// Report counts the event against the pool of its dataset
+func (m *Metrics) Report(event Event) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	pool, _, _ := strings.Cut(event.Dataset, "/")
+
+	if m.pools[pool] == nil {
+		m.pools[pool] = &Summary{}
+	}
+
+	m.pools[pool].Add(event)
+
+	if event.Type == SnapshotCreated {
+		m.lastSnapshot[event.Dataset] = m.now()
+	}
+}
+
+// series returns the name of a metric with its labels, which alternate between name and value
+func series(name string, labels ...string) string {
+	pairs := make([]string, 0, len(labels)/2)
+
+	for index := 0; index+1 < len(labels); index += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, labels[index], labelEscaper.Replace(labels[index+1])))
+	}
+
+	return name + "{" + strings.Join(pairs, ",") + "}"
+}
+
+// readMetrics reads the values of the series in a file written by WriteFile, by metric name
+func readMetrics(path string) (map[string]map[string]string, error) {
+	metrics := map[string]map[string]string{}
+
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return metrics, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error reading metrics: %w", err)
+	}
+
+	defer func() { _ = file.Close() }()
+
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		index := strings.LastIndex(line, " ")
+		if index < 0 {
+			continue
+		}
+
+		name, _, _ := strings.Cut(line[:index], "{")
+
+		if metrics[name] == nil {
+			metrics[name] = map[string]string{}
+		}
+
+		metrics[name][line[:index]] = line[index+1:]
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error reading metrics: %w", err)
+	}
+
+	return metrics, nil
+}
+
+// values returns the series of each metric for this run of interval, which finished with status
+func (m *Metrics) values(interval string, status int) map[string]map[string]string {
+	now := m.now()
+	values := map[string]map[string]string{}
+
+	for _, family := range metricFamilies {
+		values[family.name] = map[string]string{}
+	}
+
+	set := func(name, value string, labels ...string) {
+		values[name][series(name, labels...)] = value
+	}
+
+	for pool, summary := range m.pools {
+		if pool == "" {
+			// failures to list datasets aren't tied to a pool
+			set("zfs_auto_snapshot_failures", strconv.Itoa(summary.Errors), "interval", interval, "pool", pool)
+
+			continue
+		}
+
+		set("zfs_auto_snapshot_snapshots_created", strconv.Itoa(summary.Created), "interval", interval, "pool", pool)
+		set("zfs_auto_snapshot_snapshots_destroyed", strconv.Itoa(summary.Destroyed), "interval", interval, "pool", pool)
+		set("zfs_auto_snapshot_zero_sized_destroyed", strconv.Itoa(summary.ZeroSizedDestroyed),
+			"interval", interval, "pool", pool)
+		set("zfs_auto_snapshot_failures", strconv.Itoa(summary.Errors), "interval", interval, "pool", pool)
+		set("zfs_auto_snapshot_reclaimed_bytes", strconv.FormatInt(summary.BytesReclaimed, 10),
+			"interval", interval, "pool", pool)
+	}
+
+	for dataset, created := range m.lastSnapshot {
+		set("zfs_auto_snapshot_last_snapshot_timestamp_seconds", strconv.FormatInt(created.Unix(), 10),
+			"interval", interval, "dataset", dataset)
+	}
+
+	set("zfs_auto_snapshot_run_duration_seconds", strconv.FormatFloat(now.Sub(m.start).Seconds(), 'f', -1, 64),
+		"interval", interval)
+	set("zfs_auto_snapshot_last_run_exit_status", strconv.Itoa(status), "interval", interval)
+	set("zfs_auto_snapshot_last_run_timestamp_seconds", strconv.FormatInt(now.Unix(), 10), "interval", interval)
+
+	if status == 0 {
+		set("zfs_auto_snapshot_last_success_timestamp_seconds", strconv.FormatInt(now.Unix(), 10), "interval", interval)
+	}
+
+	return values
+}
+
+// WriteFile replaces the file at path with the metrics of this run of interval, which finished with status. The
+// metrics of other intervals in the file are kept, as are the timestamps this run didn't update, so several
+// intervals can share one file. The file is replaced atomically by renaming a temporary file over it, so the
+// collector never reads a partial file. Writers hold a flock on path with a .lock suffix from reading the file to
+// replacing it, so that runs finishing together don't lose each other's metrics.
+func (m *Metrics) WriteFile(path, interval string, status int) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	lock, err := os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE, 0o644) //nolint:mnd
+	if err != nil {
+		return fmt.Errorf("error locking metrics: %w", err)
+	}
+
+	// closing the file releases the flock
+	defer func() { _ = lock.Close() }()
+
+	err = lockFile(lock)
+	if err != nil {
+		return fmt.Errorf("error locking metrics: %w", err)
+	}
+
+	previous, err := readMetrics(path)
+	if err != nil {
+		return err
+	}
+
+	values := m.values(interval, status)
+
+	var out strings.Builder
+
+	for _, family := range metricFamilies {
+		for name, value := range previous[family.name] {
+			match := intervalLabel.FindStringSubmatch(name)
+			otherInterval := match == nil || match[1] != labelEscaper.Replace(interval)
+
+			if _, ok := values[family.name][name]; !ok && (otherInterval || family.timestamp) {
+				values[family.name][name] = value
+			}
+		}
+
+		if len(values[family.name]) == 0 {
+			continue
+		}
+
+		_, _ = fmt.Fprintf(&out, "# HELP %s %s\n# TYPE %s gauge\n", family.name, family.help, family.name)
+
+		for _, name := range slices.Sorted(maps.Keys(values[family.name])) {
+			_, _ = fmt.Fprintf(&out, "%s %s\n", name, values[family.name][name])
+		}
+	}
+
+	return writeFileAtomic(path, out.String())
+}
+
+// writeFileAtomic writes content to a temporary file next to path and renames it over path
+func writeFileAtomic(path, content string) error {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("error writing metrics: %w", err)
+	}
+
+	_, err = file.WriteString(content)
+	if err == nil {
+		err = file.Chmod(0o644) //nolint:mnd
+	}
+
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+
+	if err != nil {
+		_ = os.Remove(file.Name())
+
+		return fmt.Errorf("error writing metrics: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,140 @@
+package report
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMetrics_WriteFile(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "zfs-auto-snapshot.prom")
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	hourly := NewMetrics()
+	hourly.start = start
+	hourly.now = func() time.Time { return start.Add(2 * time.Second) }
+
+	hourly.Report(Event{Type: SnapshotCreated, Dataset: "tank/data", Snapshot: "tank/data@a"})
+	hourly.Report(Event{Type: SnapshotDestroyed, Dataset: "tank/data", Snapshot: "tank/data@b", Bytes: 4096})
+	hourly.Report(Event{Type: ZeroSizedDestroyed, Dataset: "tank/data", Snapshot: "tank/data@c"})
+
+	err := hourly.WriteFile(path, "hourly", 0)
+	if err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	// a failed daily run sharing the file, after an earlier successful one
+	for _, status := range []int{0, 1} {
+		daily := NewMetrics()
+		daily.start = start.Add(time.Hour * time.Duration(status))
+		daily.now = func() time.Time { return daily.start.Add(time.Second) }
+
+		if status != 0 {
+			daily.Report(Event{Type: Failure, Dataset: "tank/data", Snapshot: "tank/data@d"})
+			daily.Report(Event{Type: Failure, Error: "zfs list: exit status 1"})
+		}
+
+		err = daily.WriteFile(path, "daily", status)
+		if err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+
+	want := `# HELP zfs_auto_snapshot_snapshots_created Snapshots created by the last run.
+# TYPE zfs_auto_snapshot_snapshots_created gauge
+zfs_auto_snapshot_snapshots_created{interval="daily",pool="tank"} 0
+zfs_auto_snapshot_snapshots_created{interval="hourly",pool="tank"} 1
+# HELP zfs_auto_snapshot_snapshots_destroyed Expired snapshots destroyed by the last run.
+# TYPE zfs_auto_snapshot_snapshots_destroyed gauge
+zfs_auto_snapshot_snapshots_destroyed{interval="daily",pool="tank"} 0
+zfs_auto_snapshot_snapshots_destroyed{interval="hourly",pool="tank"} 1
+# HELP zfs_auto_snapshot_zero_sized_destroyed Zero-sized snapshots destroyed by the last run.
+# TYPE zfs_auto_snapshot_zero_sized_destroyed gauge
+zfs_auto_snapshot_zero_sized_destroyed{interval="daily",pool="tank"} 0
+zfs_auto_snapshot_zero_sized_destroyed{interval="hourly",pool="tank"} 1
+# HELP zfs_auto_snapshot_failures Snapshots which the last run failed to create or destroy.
+# TYPE zfs_auto_snapshot_failures gauge
+zfs_auto_snapshot_failures{interval="daily",pool=""} 1
+zfs_auto_snapshot_failures{interval="daily",pool="tank"} 1
+zfs_auto_snapshot_failures{interval="hourly",pool="tank"} 0
+# HELP zfs_auto_snapshot_reclaimed_bytes Space used by the snapshots destroyed by the last run.
+# TYPE zfs_auto_snapshot_reclaimed_bytes gauge
+zfs_auto_snapshot_reclaimed_bytes{interval="daily",pool="tank"} 0
+zfs_auto_snapshot_reclaimed_bytes{interval="hourly",pool="tank"} 4096
+# HELP zfs_auto_snapshot_run_duration_seconds How long the last run took.
+# TYPE zfs_auto_snapshot_run_duration_seconds gauge
+zfs_auto_snapshot_run_duration_seconds{interval="daily"} 1
+zfs_auto_snapshot_run_duration_seconds{interval="hourly"} 2
+# HELP zfs_auto_snapshot_last_run_exit_status Exit status of the last run.
+# TYPE zfs_auto_snapshot_last_run_exit_status gauge
+zfs_auto_snapshot_last_run_exit_status{interval="daily"} 1
+zfs_auto_snapshot_last_run_exit_status{interval="hourly"} 0
+# HELP zfs_auto_snapshot_last_run_timestamp_seconds When the last run finished.
+# TYPE zfs_auto_snapshot_last_run_timestamp_seconds gauge
+zfs_auto_snapshot_last_run_timestamp_seconds{interval="daily"} 1735693201
+zfs_auto_snapshot_last_run_timestamp_seconds{interval="hourly"} 1735689602
+# HELP zfs_auto_snapshot_last_success_timestamp_seconds When the last run which had no failures finished.
+# TYPE zfs_auto_snapshot_last_success_timestamp_seconds gauge
+zfs_auto_snapshot_last_success_timestamp_seconds{interval="daily"} 1735689601
+zfs_auto_snapshot_last_success_timestamp_seconds{interval="hourly"} 1735689602
+# HELP zfs_auto_snapshot_last_snapshot_timestamp_seconds When a snapshot of the dataset was last created.
+# TYPE zfs_auto_snapshot_last_snapshot_timestamp_seconds gauge
+zfs_auto_snapshot_last_snapshot_timestamp_seconds{interval="hourly",dataset="tank/data"} 1735689602
+`
+
+	if string(got) != want {
+		t.Errorf("WriteFile() wrote\n%s\nwant\n%s", got, want)
+	}
+
+	leftovers, _ := filepath.Glob(filepath.Join(filepath.Dir(path), ".*"))
+	if len(leftovers) != 0 {
+		t.Errorf("temporary files left behind: %v", leftovers)
+	}
+}
+
+func TestMetrics_WriteFileConcurrently(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "zfs-auto-snapshot.prom")
+
+	var wg sync.WaitGroup
+
+	// each run, of the daemon or of a command, has its own Metrics
+	for i := range 20 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			err := NewMetrics().WriteFile(path, fmt.Sprintf("interval%d", i), 0)
+			if err != nil {
+				t.Errorf("WriteFile() error = %v", err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+
+	for i := range 20 {
+		want := fmt.Sprintf("zfs_auto_snapshot_last_run_exit_status{interval=\"interval%d\"} 0\n", i)
+		if !strings.Contains(string(got), want) {
+			t.Errorf("WriteFile() lost the metrics of interval%d", i)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+// Package report describes what a run of one of the commands did, as a stream of events
+package report
+
+import (
+	"time"
+)
+
+// The types of Event
+const (
+	SnapshotCreated    = "snapshot_created"
+	SnapshotDestroyed  = "snapshot_destroyed"
+	ZeroSizedDestroyed = "zero_sized_destroyed"
+	BookmarkCreated    = "bookmark_created"
+	BookmarkDestroyed  = "bookmark_destroyed"
+	DatasetExcluded    = "dataset_excluded"
+	SnapshotHeld       = "snapshot_held"
+	Failure            = "error"
+)
+
+// Event is one action taken (or, in a dry-run, which would have been taken) on a dataset or snapshot
+type Event struct {
+	Time     time.Time
+	Type     string
+	Dataset  string
+	Snapshot string
+	Interval string
+	Error    string
+	// Bytes is the space reclaimed by destroying the snapshot
+	Bytes int64
+	// Duration is how long the zfs command which did it took
+	Duration time.Duration
+	DryRun   bool
+}
+
+// Reporter receives the events of a run, possibly from several goroutines at once
+type Reporter interface {
+	Report(event Event)
+}
+
+// Summary counts the events of a run
+type Summary struct {
+	Created            int
+	Destroyed          int
+	ZeroSizedDestroyed int
+	Excluded           int
+	Held               int
+	Errors             int
+	BytesReclaimed     int64
+}
+
+// Add counts event in the summary
+func (s *Summary) Add(event Event) {
+	switch event.Type {
+	case SnapshotCreated:
+		s.Created++
+	case SnapshotDestroyed:
+		s.Destroyed++
+		s.BytesReclaimed += event.Bytes
+	case ZeroSizedDestroyed:
+		s.ZeroSizedDestroyed++
+		s.BytesReclaimed += event.Bytes
+	case DatasetExcluded:
+		s.Excluded++
+	case SnapshotHeld:
+		s.Held++
+	case Failure:
+		s.Errors++
+	}
+}
@@ -0,0 +1,193 @@
+// Package schedule parses the schedule zfs-auto-snapshot --daemon follows, and works out when each of its intervals
+// is due.
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCron = errors.New("invalid cron expression")
+
+// searchYears is how far ahead Next looks for a matching time, long enough for the 29th of February
+const searchYears = 5
+
+// cronShortcuts are the expressions the @ shortcuts stand for
+var cronShortcuts = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+}
+
+// cronField is the range of values of a field of a cron expression
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12},
+	{name: "day of week", min: 0, max: 7},
+}
+
+// Cron is a cron expression, "minute hour day-of-month month day-of-week" as in crontab(5), such as "*/15 * * * *".
+// Each field is a list of values, ranges and steps; names of months and days aren't supported. Like cron, when both
+// days are restricted a time matches either of them.
+type Cron struct {
+	expr string
+	// fields are bitsets of the matching values of each field, in the order of cronFields
+	fields [5]uint64
+	// anyDayOfMonth and anyDayOfWeek are whether those fields start with "*", as cron has it
+	anyDayOfMonth bool
+	anyDayOfWeek  bool
+}
+
+// ParseCron parses a cron expression, or one of the shortcuts such as @hourly
+func ParseCron(expr string) (Cron, error) {
+	cron := Cron{expr: expr}
+
+	if shortcut, ok := cronShortcuts[expr]; ok {
+		expr = shortcut
+	}
+
+	values := strings.Fields(expr)
+	if len(values) != len(cronFields) {
+		return Cron{}, fmt.Errorf("%w: %q, want %d fields", ErrInvalidCron, cron.expr, len(cronFields))
+	}
+
+	for i, value := range values {
+		bits, err := parseCronField(value, cronFields[i])
+		if err != nil {
+			return Cron{}, fmt.Errorf("%q: %w", cron.expr, err)
+		}
+
+		cron.fields[i] = bits
+	}
+
+	// Sunday is both 0 and 7
+	if cron.fields[4]&(1<<7) != 0 {
+		cron.fields[4] |= 1
+	}
+
+	cron.anyDayOfMonth = strings.HasPrefix(values[2], "*")
+	cron.anyDayOfWeek = strings.HasPrefix(values[4], "*")
+
+	if cron.Next(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)).IsZero() {
+		return Cron{}, fmt.Errorf("%w: %q never matches", ErrInvalidCron, cron.expr)
+	}
+
+	return cron, nil
+}
+
+// parseCronField parses a field, a comma separated list of *, values or ranges each optionally followed by /step,
+// into a bitset of its values
+func parseCronField(value string, field cronField) (uint64, error) {
+	var bits uint64
+
+	for part := range strings.SplitSeq(value, ",") {
+		span, stepValue, hasStep := strings.Cut(part, "/")
+
+		step := 1
+
+		if hasStep {
+			var err error
+
+			step, err = strconv.Atoi(stepValue)
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("%w: bad step %q in %s", ErrInvalidCron, stepValue, field.name)
+			}
+		}
+
+		low, high := field.min, field.max
+
+		if span != "*" {
+			first, last, isRange := strings.Cut(span, "-")
+
+			var err error
+
+			low, err = strconv.Atoi(first)
+			if err != nil {
+				return 0, fmt.Errorf("%w: bad %s %q", ErrInvalidCron, field.name, first)
+			}
+
+			high = low
+
+			if isRange {
+				high, err = strconv.Atoi(last)
+				if err != nil {
+					return 0, fmt.Errorf("%w: bad %s %q", ErrInvalidCron, field.name, last)
+				}
+			} else if hasStep {
+				// like cron, "5/15" is "5-max/15"
+				high = field.max
+			}
+		}
+
+		if low < field.min || high > field.max || low > high {
+			return 0, fmt.Errorf("%w: %s %q out of range %d-%d", ErrInvalidCron, field.name, span, field.min, field.max)
+		}
+
+		for v := low; v <= high; v += step {
+			bits |= 1 << v
+		}
+	}
+
+	return bits, nil
+}
+
+// String returns the expression as it was given
+func (c Cron) String() string {
+	return c.expr
+}
+
+// matchesDay reports whether the day of t matches the day of month and day of week fields
+func (c Cron) matchesDay(t time.Time) bool {
+	dayOfMonth := c.fields[2]&(1<<t.Day()) != 0
+	dayOfWeek := c.fields[4]&(1<<int(t.Weekday())) != 0
+
+	switch {
+	case c.anyDayOfMonth && c.anyDayOfWeek:
+		return true
+	case c.anyDayOfMonth:
+		return dayOfWeek
+	case c.anyDayOfWeek:
+		return dayOfMonth
+	default:
+		return dayOfMonth || dayOfWeek
+	}
+}
+
+// Next returns the first minute after after which the expression matches, in after's location, or the zero time
+// when there is none
+func (c Cron) Next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(searchYears, 0, 0)
+	location := t.Location()
+
+	for t.Before(limit) {
+		switch {
+		case c.fields[3]&(1<<int(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, location)
+		case !c.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, location)
+		case c.fields[1]&(1<<t.Hour()) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, location)
+		case c.fields[0]&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
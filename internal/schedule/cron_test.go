@@ -0,0 +1,61 @@
+package schedule
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCron_Next(t *testing.T) {
+	t.Parallel()
+
+	// a Wednesday
+	after := time.Date(2025, 1, 1, 10, 7, 30, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{expr: "* * * * *", want: time.Date(2025, 1, 1, 10, 8, 0, 0, time.UTC)},
+		{expr: "*/15 * * * *", want: time.Date(2025, 1, 1, 10, 15, 0, 0, time.UTC)},
+		{expr: "@hourly", want: time.Date(2025, 1, 1, 11, 0, 0, 0, time.UTC)},
+		{expr: "@daily", want: time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{expr: "30 3 * * 1-5", want: time.Date(2025, 1, 2, 3, 30, 0, 0, time.UTC)},
+		{expr: "0 0 * * 7", want: time.Date(2025, 1, 5, 0, 0, 0, 0, time.UTC)},
+		{expr: "@monthly", want: time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 12 29 2 *", want: time.Date(2028, 2, 29, 12, 0, 0, 0, time.UTC)},
+		{expr: "5,50 8-18/2 * * *", want: time.Date(2025, 1, 1, 10, 50, 0, 0, time.UTC)},
+		// either day matches when both are restricted
+		{expr: "0 0 15 * 5", want: time.Date(2025, 1, 3, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.expr, func(t *testing.T) {
+			t.Parallel()
+
+			cron, err := ParseCron(testCase.expr)
+			if err != nil {
+				t.Fatalf("ParseCron() error = %v", err)
+			}
+
+			if got := cron.Next(after); !got.Equal(testCase.want) {
+				t.Errorf("Next() = %v, want %v", got, testCase.want)
+			}
+		})
+	}
+}
+
+func TestParseCron_Invalid(t *testing.T) {
+	t.Parallel()
+
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "*/0 * * * *", "0 0 31 2 *", "5-1 * * * *", "@often"} {
+		t.Run(expr, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := ParseCron(expr)
+			if !errors.Is(err, ErrInvalidCron) {
+				t.Errorf("ParseCron() error = %v, want %v", err, ErrInvalidCron)
+			}
+		})
+	}
+}
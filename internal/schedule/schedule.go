@@ -0,0 +1,182 @@
+package schedule
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"zfstools-go/internal/config"
+)
+
+// DefaultPath is where zfs-auto-snapshot --daemon reads its schedule from, unless told otherwise
+const DefaultPath = "/usr/local/etc/zfs-auto-snapshot.schedule"
+
+var ErrInvalidSchedule = errors.New("invalid schedule")
+
+// defaultCrons are when the intervals of zfs-auto-snapshot are taken when the schedule doesn't say, as in the
+// crontab of the zfstools port
+var defaultCrons = map[string]string{
+	"frequent": "*/15 * * * *",
+	"hourly":   "@hourly",
+	"daily":    "@daily",
+	"weekly":   "@weekly",
+	"monthly":  "@monthly",
+	"yearly":   "@yearly",
+}
+
+// Entry is a line of a schedule: the snapshots of Interval are taken when Cron matches, keeping the newest Keep of
+// them or, with KeepAge, those taken within KeepAge
+type Entry struct {
+	Cron     Cron
+	Interval string
+	KeepAge  time.Duration
+	Keep     int
+	// KeepFromFile is whether the keep is that of the interval in the configuration file, the line's being "-"
+	KeepFromFile bool
+}
+
+// Parse reads a schedule, a line for each interval with its name, its KEEP, as zfs-auto-snapshot takes it, and the
+// cron expression saying when it is taken, which may be left out for the usual intervals:
+//
+//	# interval  keep  minute hour day month weekday
+//	frequent    4     */15   *    *   *     *
+//	hourly      24
+//	daily       7d    0      3    *   *     *
+//	weekly      -
+//
+// A keep of "-" is that of the interval in keep, the keep of the configuration file. Blank lines and those starting
+// with # are ignored.
+func Parse(reader io.Reader, keep map[string]string) ([]Entry, error) {
+	var entries []Entry
+
+	scanner := bufio.NewScanner(reader)
+
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 { //nolint:mnd
+			return nil, fmt.Errorf("%w: line %d: want an interval, a keep and a cron expression", ErrInvalidSchedule,
+				number)
+		}
+
+		entry := Entry{Interval: fields[0], KeepFromFile: fields[1] == "-"}
+
+		value := fields[1]
+		if entry.KeepFromFile {
+			value = keep[entry.Interval]
+		}
+
+		if value == "" {
+			return nil, fmt.Errorf("%w: line %d: no keep for %s in the configuration file", ErrInvalidSchedule, number,
+				entry.Interval)
+		}
+
+		var err error
+
+		entry.Keep, entry.KeepAge, err = config.ParseKeep(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %w", ErrInvalidSchedule, number, err)
+		}
+
+		expr := strings.Join(fields[2:], " ")
+		if expr == "" {
+			expr = defaultCrons[entry.Interval]
+		}
+
+		if expr == "" {
+			return nil, fmt.Errorf("%w: line %d: no cron expression for %s", ErrInvalidSchedule, number,
+				entry.Interval)
+		}
+
+		entry.Cron, err = ParseCron(expr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %w", ErrInvalidSchedule, number, err)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error reading schedule: %w", err)
+	}
+
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%w: nothing is scheduled", ErrInvalidSchedule)
+	}
+
+	return entries, nil
+}
+
+// ParseFile reads the schedule in the file at path, see Parse
+func ParseFile(path string, keep map[string]string) ([]Entry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading schedule: %w", err)
+	}
+
+	defer func() { _ = file.Close() }()
+
+	entries, err := Parse(file, keep)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return entries, nil
+}
+
+// Schedule keeps track of when each of its entries is next due
+type Schedule struct {
+	entries []Entry
+	next    []time.Time
+}
+
+// New returns a schedule of entries, each first due when its cron expression next matches after now
+func New(entries []Entry, now time.Time) *Schedule {
+	schedule := &Schedule{entries: entries, next: make([]time.Time, len(entries))}
+
+	for i, entry := range entries {
+		schedule.next[i] = entry.Cron.Next(now)
+	}
+
+	return schedule
+}
+
+// Next returns when the first of the entries is next due, or the zero time if none of them ever are
+func (s *Schedule) Next() time.Time {
+	var next time.Time
+
+	for _, due := range s.next {
+		if !due.IsZero() && (next.IsZero() || due.Before(next)) {
+			next = due
+		}
+	}
+
+	return next
+}
+
+// Due returns the entries which are due by now, in the order of the schedule, and works out when they are next due
+// after now. An entry which was due several times since it was last taken, because the host was suspended for
+// instance, is returned just once.
+func (s *Schedule) Due(now time.Time) []Entry {
+	var due []Entry
+
+	for i, entry := range s.entries {
+		if s.next[i].IsZero() || s.next[i].After(now) {
+			continue
+		}
+
+		due = append(due, entry)
+		s.next[i] = entry.Cron.Next(now)
+	}
+
+	return due
+}
@@ -0,0 +1,107 @@
+package schedule
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	entries, err := Parse(strings.NewReader(`# interval keep  minute hour day month weekday
+frequent    4     */15   *    *   *     *
+
+hourly      24
+daily       7d    0      3    *   *     *
+weekly      -     0      4    *   *     0
+`), map[string]string{"weekly": "4w", "hourly": "48"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	var got []string
+
+	for _, entry := range entries {
+		got = append(got, strings.Join([]string{entry.Interval, entry.Cron.String()}, " "))
+	}
+
+	want := []string{"frequent */15 * * * *", "hourly @hourly", "daily 0 3 * * *", "weekly 0 4 * * 0"}
+	if diff := deep.Equal(got, want); diff != nil {
+		t.Error(diff)
+	}
+
+	if entries[1].Keep != 24 || entries[2].KeepAge != 7*24*time.Hour || entries[3].KeepAge != 4*7*24*time.Hour {
+		t.Errorf("Parse() keeps = %d, %v, %v", entries[1].Keep, entries[2].KeepAge, entries[3].KeepAge)
+	}
+
+	// the keep of the configuration file is only taken when the line leaves its own out
+	if entries[1].KeepFromFile || !entries[3].KeepFromFile {
+		t.Errorf("Parse() keeps from the file = %v, %v", entries[1].KeepFromFile, entries[3].KeepFromFile)
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	t.Parallel()
+
+	for _, schedule := range []string{
+		"", "# nothing\n", "hourly\n", "hourly many\n", "often 4\n", "hourly 4 * *\n", "daily -\n", "hourly -\n",
+	} {
+		t.Run(schedule, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := Parse(strings.NewReader(schedule), map[string]string{"hourly": "many"})
+			if !errors.Is(err, ErrInvalidSchedule) {
+				t.Errorf("Parse() error = %v, want %v", err, ErrInvalidSchedule)
+			}
+		})
+	}
+}
+
+func TestSchedule_Due(t *testing.T) {
+	t.Parallel()
+
+	entries, err := Parse(strings.NewReader("frequent 4\nhourly 24\ndaily 7\n"), nil)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	start := time.Date(2025, 1, 1, 10, 7, 0, 0, time.UTC)
+	schedule := New(entries, start)
+
+	intervals := func(entries []Entry) []string {
+		var names []string
+
+		for _, entry := range entries {
+			names = append(names, entry.Interval)
+		}
+
+		return names
+	}
+
+	if next := schedule.Next(); !next.Equal(start.Add(8 * time.Minute)) {
+		t.Errorf("Next() = %v", next)
+	}
+
+	if due := schedule.Due(start.Add(7 * time.Minute)); len(due) != 0 {
+		t.Errorf("Due() = %v before anything is due", intervals(due))
+	}
+
+	due := schedule.Due(start.Add(53 * time.Minute))
+	if diff := deep.Equal(intervals(due), []string{"frequent", "hourly"}); diff != nil {
+		t.Error(diff)
+	}
+
+	// after a night suspended, each is taken once to catch up
+	due = schedule.Due(start.Add(20 * time.Hour))
+	if diff := deep.Equal(intervals(due), []string{"frequent", "hourly", "daily"}); diff != nil {
+		t.Error(diff)
+	}
+
+	if next := schedule.Next(); !next.Equal(time.Date(2025, 1, 2, 6, 15, 0, 0, time.UTC)) {
+		t.Errorf("Next() = %v after catching up", next)
+	}
+}
@@ -0,0 +1,97 @@
+package zfs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Bookmark is a bookmark of a snapshot, which an incremental stream can still be sent from once the snapshot is
+// destroyed. Its guid is that of the snapshot.
+type Bookmark struct {
+	Name string
+	GUID string
+}
+
+// BookmarkName returns the name of the bookmark of snapshot, "pool/fs#snap" for "pool/fs@snap"
+func BookmarkName(snapshot string) string {
+	return strings.Replace(snapshot, "@", "#", 1)
+}
+
+// ListBookmarks returns the bookmarks of dataset, or of every dataset when it is empty, optionally recursive,
+// oldest first
+func (c *Client) ListBookmarks(ctx context.Context, dataset string, recursive bool, debug bool) ([]Bookmark, error) {
+	args := []string{"list"}
+
+	if dataset != "" && !recursive {
+		args = append(args, "-d", "1")
+	}
+
+	if recursive {
+		args = append(args, "-r")
+	}
+
+	args = append(args, "-H", "-p", "-t", "bookmark", "-o", "name,guid", "-s", "createtxg")
+
+	if dataset != "" {
+		args = append(args, dataset)
+	}
+
+	if debug {
+		fmt.Println("zfs", strings.Join(args, " ")) //nolint:forbidigo
+	}
+
+	var bookmarks []Bookmark
+
+	err := c.stream(ctx, func(line string) {
+		name, guid, found := strings.Cut(line, "\t")
+		if found {
+			bookmarks = append(bookmarks, Bookmark{Name: name, GUID: guid})
+		}
+	}, "zfs", args...)
+	if err != nil {
+		return nil, fmt.Errorf("error listing bookmarks: %w", err)
+	}
+
+	return bookmarks, nil
+}
+
+// CreateBookmark bookmarks snapshot, naming the bookmark after it (see BookmarkName)
+func (c *Client) CreateBookmark(ctx context.Context, snapshot string, dryRun, debug bool) error {
+	args := []string{"bookmark", snapshot, BookmarkName(snapshot)}
+
+	if debug {
+		fmt.Println("zfs", strings.Join(args, " ")) //nolint:forbidigo
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	err := c.run(ctx, "zfs", args...)
+	if err != nil {
+		return &SnapshotError{Err: err, Op: "bookmarking", Snapshots: []string{snapshot}}
+	}
+
+	return nil
+}
+
+// DestroyBookmark deletes a bookmark
+func (c *Client) DestroyBookmark(ctx context.Context, name string, dryRun, debug bool) error {
+	args := []string{"destroy", name}
+
+	if debug {
+		fmt.Println("zfs", strings.Join(args, " ")) //nolint:forbidigo
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	err := c.run(ctx, "zfs", args...)
+	if err != nil {
+		return fmt.Errorf("error destroying bookmark %s: %w", name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package zfs
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestListBookmarks(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		dataset   string
+		recursive bool
+		output    string
+		wantCall  []string
+		want      []Bookmark
+	}{
+		{
+			name:    "dataset",
+			dataset: "tank/data",
+			output:  "tank/data#a\t123\ntank/data#b\t456\n",
+			wantCall: []string{
+				"zfs", "list", "-d", "1", "-H", "-p", "-t", "bookmark", "-o", "name,guid", "-s", "createtxg", "tank/data",
+			},
+			want: []Bookmark{{Name: "tank/data#a", GUID: "123"}, {Name: "tank/data#b", GUID: "456"}},
+		},
+		{
+			name:      "recursive",
+			dataset:   "tank",
+			recursive: true,
+			output:    "tank/data#a\t123\nbogus\n",
+			wantCall: []string{
+				"zfs", "list", "-r", "-H", "-p", "-t", "bookmark", "-o", "name,guid", "-s", "createtxg", "tank",
+			},
+			want: []Bookmark{{Name: "tank/data#a", GUID: "123"}},
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			executor := &stubExecutor{output: testCase.output}
+			client := NewClient(executor)
+
+			got, err := client.ListBookmarks(t.Context(), testCase.dataset, testCase.recursive, false)
+			if err != nil {
+				t.Fatalf("ListBookmarks() error = %v", err)
+			}
+
+			if diff := deep.Equal(got, testCase.want); diff != nil {
+				t.Error(diff)
+			}
+
+			if diff := deep.Equal(executor.calls, [][]string{testCase.wantCall}); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestCreateBookmark(t *testing.T) {
+	t.Parallel()
+
+	executor := &stubExecutor{}
+	client := NewClient(executor)
+
+	err := client.CreateBookmark(t.Context(), "tank/data@zfs-auto-snap_daily-2025-01-01-00h00", false, false)
+	if err != nil {
+		t.Fatalf("CreateBookmark() error = %v", err)
+	}
+
+	err = client.CreateBookmark(t.Context(), "tank/data@skipped", true, false)
+	if err != nil {
+		t.Fatalf("CreateBookmark() error = %v", err)
+	}
+
+	want := [][]string{{
+		"zfs", "bookmark", "tank/data@zfs-auto-snap_daily-2025-01-01-00h00",
+		"tank/data#zfs-auto-snap_daily-2025-01-01-00h00",
+	}}
+	if diff := deep.Equal(executor.calls, want); diff != nil {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,54 @@
+package zfs
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Client runs zfs and zpool commands through an Executor. Each Client keeps its own cached state, so
+// clients with different executors can be used side by side.
+type Client struct {
+	executor Executor
+
+	coordinators      map[string]Coordinator
+	coordinatorsMutex sync.Mutex
+
+	hookTimeout time.Duration
+
+	// hooksDir is where hooks must be, see SetHooksDir
+	hooksDir string
+
+	// channelPrograms is whether snapshots are created and destroyed by channel programs, see SetChannelPrograms
+	channelPrograms bool
+
+	// features caches which features each pool has, see HasFeature
+	features      map[poolFeature]bool
+	featuresMutex sync.Mutex
+
+	// commandArgMax caches the room for the arguments of a command, see argMax
+	commandArgMax     int
+	commandArgMaxOnce sync.Once
+
+	staleSnapshotSize atomic.Bool
+}
+
+// NewClient returns a Client which runs its commands with executor
+func NewClient(executor Executor) *Client {
+	return &Client{executor: executor}
+}
+
+func (c *Client) run(ctx context.Context, name string, args ...string) error {
+	return commandError(c.executor.Run(ctx, name, args...), name, args...)
+}
+
+func (c *Client) output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	out, err := c.executor.Output(ctx, name, args...)
+
+	return out, commandError(err, name, args...)
+}
+
+func (c *Client) stream(ctx context.Context, onLine func(line string), name string, args ...string) error {
+	return commandError(c.executor.Stream(ctx, onLine, name, args...), name, args...)
+}
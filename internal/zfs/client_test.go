@@ -0,0 +1,43 @@
+package zfs
+
+import (
+	"testing"
+
+	"zfstools-go/internal/zfstoolstest"
+)
+
+// fakeClient returns a Client whose commands are handled by the named mock test function
+func fakeClient(mockFuncName string) *Client {
+	return NewClient(CommandExecutor{CommandContext: zfstoolstest.MakeFakeCommand(mockFuncName)})
+}
+
+func TestNewClient_Independent(t *testing.T) {
+	t.Parallel()
+
+	withBookmarks := &stubExecutor{output: "tank\tfeature@bookmarks\tenabled\n"}
+	withoutBookmarks := &stubExecutor{}
+
+	first := NewClient(withBookmarks)
+	second := NewClient(withoutBookmarks)
+
+	if !first.HasBookmarks(t.Context(), "tank", false) {
+		t.Errorf("expected first client to have bookmarks")
+	}
+
+	if second.HasBookmarks(t.Context(), "tank", false) {
+		t.Errorf("expected second client not to have bookmarks")
+	}
+
+	err := first.DestroySnapshot(t.Context(), "tank/fs@snap", false, false)
+	if err != nil {
+		t.Fatalf("DestroySnapshot() error = %v", err)
+	}
+
+	if !first.staleSnapshotSize.Load() || second.staleSnapshotSize.Load() {
+		t.Errorf("snapshot size staleness leaked between clients")
+	}
+
+	if len(withBookmarks.calls) != 2 || len(withoutBookmarks.calls) != 1 {
+		t.Errorf("commands were not routed to their own executors: %v %v", withBookmarks.calls, withoutBookmarks.calls)
+	}
+}
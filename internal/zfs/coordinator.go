@@ -0,0 +1,83 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+var ErrNoCoordinator = errors.New("no coordinator for database")
+
+// Coordinator makes the data of an application, such as a database, consistent on disk while its snapshot is taken
+type Coordinator interface {
+	// Snapshot calls take, which takes the snapshots, while the application's data is consistent on disk. It
+	// returns user properties, such as where a database's log had got to, to be set on the snapshots.
+	Snapshot(ctx context.Context, take func(ctx context.Context) error) (map[string]string, error)
+}
+
+// SetCoordinator sets the Coordinator used to snapshot datasets whose DB is dbName
+func (c *Client) SetCoordinator(dbName string, coordinator Coordinator) {
+	c.coordinatorsMutex.Lock()
+	defer c.coordinatorsMutex.Unlock()
+
+	if c.coordinators == nil {
+		c.coordinators = map[string]Coordinator{}
+	}
+
+	c.coordinators[dbName] = coordinator
+}
+
+func (c *Client) coordinator(dbName string) (Coordinator, bool) {
+	c.coordinatorsMutex.Lock()
+	defer c.coordinatorsMutex.Unlock()
+
+	coordinator, ok := c.coordinators[dbName]
+
+	return coordinator, ok
+}
+
+// coordinatedSnapshot takes the snapshots with the coordinator for dbName and sets the properties it returns on them
+func (c *Client) coordinatedSnapshot(
+	ctx context.Context,
+	targets []string,
+	recursive bool,
+	dbName string,
+	debug bool,
+) error {
+	coordinator, ok := c.coordinator(dbName)
+	if !ok {
+		return fmt.Errorf("%w %s", ErrNoCoordinator, dbName)
+	}
+
+	args := []string{"snapshot"}
+	if recursive {
+		args = append(args, "-r")
+	}
+
+	args = append(args, targets...)
+
+	properties, err := coordinator.Snapshot(ctx, func(ctx context.Context) error {
+		return c.run(ctx, "zfs", args...)
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", dbName, err)
+	}
+
+	for _, property := range slices.Sorted(maps.Keys(properties)) {
+		setArgs := append([]string{"set", property + "=" + properties[property]}, targets...)
+
+		if debug {
+			fmt.Println("zfs", strings.Join(setArgs, " ")) //nolint:forbidigo
+		}
+
+		err = c.run(ctx, "zfs", setArgs...)
+		if err != nil {
+			return fmt.Errorf("%s: %w", dbName, err)
+		}
+	}
+
+	return nil
+}
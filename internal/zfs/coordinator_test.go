@@ -0,0 +1,88 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+var errNotConsistent = errors.New("not consistent")
+
+// fakeCoordinator takes the snapshots unless it has an error, returning its properties
+type fakeCoordinator struct {
+	err        error
+	properties map[string]string
+}
+
+func (f *fakeCoordinator) Snapshot(
+	ctx context.Context,
+	take func(ctx context.Context) error,
+) (map[string]string, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	err := take(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return f.properties, nil
+}
+
+func TestCreateSnapshot_Coordinator(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		coordinator *fakeCoordinator
+		dryRun      bool
+		wantCalls   [][]string
+		wantErr     error
+	}{
+		{
+			name: "properties",
+			coordinator: &fakeCoordinator{properties: map[string]string{
+				"com.sun:b": "2",
+				"com.sun:a": "1",
+			}},
+			wantCalls: [][]string{
+				{"zfs", "snapshot", "-r", "pool/db@snap"},
+				{"zfs", "set", "com.sun:a=1", "pool/db@snap"},
+				{"zfs", "set", "com.sun:b=2", "pool/db@snap"},
+			},
+		},
+		{
+			name:        "aborted",
+			coordinator: &fakeCoordinator{err: errNotConsistent},
+			wantErr:     errNotConsistent,
+		},
+		{
+			name:        "dryRun",
+			coordinator: &fakeCoordinator{},
+			dryRun:      true,
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			executor := &stubExecutor{}
+			client := NewClient(executor)
+			client.SetCoordinator("postgresql", testCase.coordinator)
+
+			err := client.CreateSnapshot(t.Context(), []string{"pool/db@snap"}, true, "postgresql",
+				testCase.dryRun, false, false)
+			if !errors.Is(err, testCase.wantErr) {
+				t.Fatalf("CreateSnapshot() error = %v, want %v", err, testCase.wantErr)
+			}
+
+			if diff := deep.Equal(executor.calls, testCase.wantCalls); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -1,7 +1,7 @@
 package zfs
 
 import (
-	"bufio"
+	"context"
 	"fmt"
 	"strings"
 )
@@ -10,6 +10,10 @@ type Dataset struct {
 	Name       string
 	Properties map[string]string
 	DB         string
+	// Hooks are run around the dataset's snapshot, including those of the descendants a recursive snapshot takes
+	Hooks []Hook
+	// Group is the consistency group the dataset is in, if any, see GroupProperty
+	Group string
 }
 
 // Equals returns true if the other dataset has the same name
@@ -18,7 +22,7 @@ func (d Dataset) Equals(other Dataset) bool {
 }
 
 // ListDatasets returns a list of ZFS datasets for the pool and properties
-func ListDatasets(pool string, properties []string, debug bool) []Dataset {
+func (c *Client) ListDatasets(ctx context.Context, pool string, properties []string, debug bool) ([]Dataset, error) {
 	var datasets []Dataset
 
 	cmdProperties := append([]string{"name", "type"}, properties...)
@@ -32,25 +36,11 @@ func ListDatasets(pool string, properties []string, debug bool) []Dataset {
 		fmt.Println("zfs " + strings.Join(args, " ")) //nolint:forbidigo
 	}
 
-	cmd := RunZfsFn("zfs", args...)
-
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return []Dataset{}
-	}
-
-	err = cmd.Start()
-	if err != nil {
-		return []Dataset{}
-	}
-
-	scanner := bufio.NewScanner(stdout)
-	for scanner.Scan() {
-		line := scanner.Text()
+	err := c.stream(ctx, func(line string) {
 		values := strings.Split(line, "\t")
 
 		if len(values) < 2 {
-			continue
+			return
 		}
 
 		name := values[0]
@@ -59,6 +49,10 @@ func ListDatasets(pool string, properties []string, debug bool) []Dataset {
 		values = values[1:] // emulate Ruby .shift
 
 		for i, prop := range properties {
+			if i >= len(values) {
+				break
+			}
+
 			value := values[i]
 			if value == "-" {
 				continue
@@ -76,13 +70,17 @@ func ListDatasets(pool string, properties []string, debug bool) []Dataset {
 			}
 		}
 
-		datasets = append(datasets, dataset)
-	}
+		if path := props[HookProperty]; path != "" {
+			dataset.Hooks = []Hook{{Path: path, Dataset: name}}
+		}
+
+		dataset.Group = props[GroupProperty]
 
-	err = cmd.Wait()
+		datasets = append(datasets, dataset)
+	}, "zfs", args...)
 	if err != nil {
-		return []Dataset{}
+		return nil, fmt.Errorf("error listing datasets: %w", err)
 	}
 
-	return datasets
+	return datasets, nil
 }
@@ -24,6 +24,7 @@ func TestListDatasets(t *testing.T) {
 		args        args
 		mockCmdFunc string
 		want        []Dataset
+		wantErr     bool
 	}{
 		{
 			name: "twoDatasets",
@@ -146,13 +147,29 @@ func TestListDatasets(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "error",
+			args: args{
+				pool:       "tank",
+				properties: []string{"com.sun:auto-snapshot"},
+				debug:      false,
+			},
+			mockCmdFunc: "TestListDatasets_error",
+			want:        nil,
+			wantErr:     true,
+		},
 	}
 
 	for _, testCase := range tests {
 		t.Run(testCase.name, func(t *testing.T) {
-			RunZfsFn = zfstoolstest.MakeFakeCommand(testCase.mockCmdFunc)
+			client := fakeClient(testCase.mockCmdFunc)
 
-			got := ListDatasets(testCase.args.pool, testCase.args.properties, testCase.args.debug)
+			got, err := client.ListDatasets(t.Context(), testCase.args.pool, testCase.args.properties, testCase.args.debug)
+			if (err != nil) != testCase.wantErr {
+				t.Errorf("ListDatasets() error = %v, wantErr %v", err, testCase.wantErr)
+
+				return
+			}
 
 			diff := deep.Equal(got, testCase.want)
 			if diff != nil {
@@ -299,3 +316,14 @@ func TestListDatasets_EmptyPoolNameShortLine(_ *testing.T) {
 
 	os.Exit(0)
 }
+
+//nolint:paralleltest
+func TestListDatasets_error(_ *testing.T) {
+	if !zfstoolstest.IsTestEnv() {
+		return
+	}
+
+	_, _ = fmt.Fprintf(os.Stderr, "cannot open 'tank': dataset does not exist\n")
+
+	os.Exit(1)
+}
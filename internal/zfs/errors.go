@@ -0,0 +1,118 @@
+package zfs
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrDatasetBusy = errors.New("dataset is busy")
+
+var ErrHasClones = errors.New("snapshot has dependent clones")
+
+var ErrHeld = errors.New("snapshot is held")
+
+var ErrDoesNotExist = errors.New("dataset does not exist")
+
+var ErrPermissionDenied = errors.New("permission denied")
+
+// stderrKinds maps messages printed by zfs and zpool to the error they represent
+var stderrKinds = []struct {
+	kind    error
+	message string
+}{
+	{kind: ErrHasClones, message: "has dependent clones"},
+	{kind: ErrDatasetBusy, message: "is busy"},
+	{kind: ErrDoesNotExist, message: "does not exist"},
+	{kind: ErrDoesNotExist, message: "could not find any snapshots"},
+	{kind: ErrDoesNotExist, message: "no such pool"},
+	{kind: ErrPermissionDenied, message: "permission denied"},
+	{kind: ErrPermissionDenied, message: "insufficient privileges"},
+	{kind: ErrPermissionDenied, message: "operation not permitted"},
+}
+
+// classify returns the well-known error described by a zfs or zpool message, or nil
+func classify(message string) error {
+	message = strings.ToLower(message)
+
+	for _, known := range stderrKinds {
+		if strings.Contains(message, known.message) {
+			return known.kind
+		}
+	}
+
+	return nil
+}
+
+// CommandError reports a command which failed. errors.Is() matches Kind, one of ErrDatasetBusy, ErrHasClones,
+// ErrHeld, ErrDoesNotExist or ErrPermissionDenied, when the failure was recognized.
+type CommandError struct {
+	Err     error
+	Kind    error
+	Command string
+	Stderr  string
+}
+
+// newCommandError returns a CommandError for the command, classified by what it wrote to stderr
+func newCommandError(err error, stderr string, name string, args ...string) *CommandError {
+	message := stderr
+	if message == "" {
+		message = err.Error()
+	}
+
+	return &CommandError{
+		Err:     err,
+		Kind:    classify(message),
+		Command: strings.Join(append([]string{name}, args...), " "),
+		Stderr:  stderr,
+	}
+}
+
+func (e *CommandError) Error() string {
+	if e.Stderr == "" {
+		return fmt.Sprintf("%s: %v", e.Command, e.Err)
+	}
+
+	return fmt.Sprintf("%s: %v: %s", e.Command, e.Err, e.Stderr)
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+func (e *CommandError) Is(target error) bool {
+	return e.Kind != nil && target == e.Kind //nolint:errorlint
+}
+
+// commandError makes sure err, returned by an Executor for the command, is a CommandError or InterruptedError
+func commandError(err error, name string, args ...string) error {
+	if err == nil {
+		return nil
+	}
+
+	var cmdErr *CommandError
+
+	var interrupted *InterruptedError
+
+	if errors.As(err, &cmdErr) || errors.As(err, &interrupted) {
+		return err
+	}
+
+	return newCommandError(err, "", name, args...)
+}
+
+// SnapshotError reports snapshots which could not be created, destroyed or bookmarked, Op is "creating",
+// "destroying" or "bookmarking"
+type SnapshotError struct {
+	Err       error
+	Op        string
+	Snapshots []string
+}
+
+func (e *SnapshotError) Error() string {
+	return fmt.Sprintf("error %s snapshot %s: %v", e.Op, strings.Join(e.Snapshots, " "), e.Err)
+}
+
+func (e *SnapshotError) Unwrap() error {
+	return e.Err
+}
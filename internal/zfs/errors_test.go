@@ -0,0 +1,101 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestCommandError_Is(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name   string
+		stderr string
+		want   error
+	}{
+		{name: "busy", stderr: "cannot destroy snapshot tank/a@1: dataset is busy", want: ErrDatasetBusy},
+		{
+			name:   "clones",
+			stderr: "cannot destroy 'tank/a@1': snapshot has dependent clones; use '-R' to destroy the following datasets:",
+			want:   ErrHasClones,
+		},
+		{name: "missing", stderr: "cannot open 'tank/gone': dataset does not exist", want: ErrDoesNotExist},
+		{
+			name:   "no snapshots",
+			stderr: "could not find any snapshots to destroy; check snapshot names.",
+			want:   ErrDoesNotExist,
+		},
+		{name: "no pool", stderr: "cannot open 'gone': no such pool", want: ErrDoesNotExist},
+		{name: "permission", stderr: "cannot destroy 'tank/a@1': permission denied", want: ErrPermissionDenied},
+		{name: "unknown", stderr: "internal error: out of memory", want: nil},
+	}
+
+	kinds := []error{ErrDatasetBusy, ErrHasClones, ErrHeld, ErrDoesNotExist, ErrPermissionDenied}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := error(newCommandError(assertError("exit status 1"), testCase.stderr, "zfs", "destroy", "tank/a@1"))
+
+			for _, kind := range kinds {
+				if got := errors.Is(err, kind); got != (kind == testCase.want) { //nolint:errorlint
+					t.Errorf("errors.Is(%v, %v) = %v", err, kind, got)
+				}
+			}
+		})
+	}
+}
+
+//nolint:paralleltest
+func TestClient_CommandError(t *testing.T) {
+	client := NewClient(&stubExecutor{err: assertError("cannot open 'tank/gone': dataset does not exist")})
+
+	_, err := client.ListSnapshots(t.Context(), "tank/gone", false, false)
+
+	var cmdErr *CommandError
+	if !errors.As(err, &cmdErr) {
+		t.Fatalf("ListSnapshots() error = %v, want CommandError", err)
+	}
+
+	if want := "zfs list -d 1 -H -p -t snapshot -o name,used -S name tank/gone"; cmdErr.Command != want {
+		t.Errorf("Command = %q, want %q", cmdErr.Command, want)
+	}
+
+	if !errors.Is(err, ErrDoesNotExist) {
+		t.Errorf("ListSnapshots() error = %v, want ErrDoesNotExist", err)
+	}
+}
+
+// heldExecutor refuses to destroy a snapshot which has one hold
+type heldExecutor struct{}
+
+func (heldExecutor) Run(_ context.Context, name string, args ...string) error {
+	stderr := "cannot destroy snapshot tank/a@1: dataset is busy"
+
+	return newCommandError(assertError("exit status 1"), stderr, name, args...)
+}
+
+func (heldExecutor) Output(_ context.Context, _ string, _ ...string) ([]byte, error) {
+	return []byte("1\n"), nil
+}
+
+func (heldExecutor) Stream(_ context.Context, _ func(line string), _ string, _ ...string) error {
+	return nil
+}
+
+//nolint:paralleltest
+func TestDestroySnapshot_Held(t *testing.T) {
+	client := NewClient(heldExecutor{})
+
+	err := client.DestroySnapshot(t.Context(), "tank/a@1", false, false)
+
+	if !errors.Is(err, ErrHeld) {
+		t.Errorf("DestroySnapshot() error = %v, want ErrHeld", err)
+	}
+
+	if errors.Is(err, ErrDatasetBusy) {
+		t.Errorf("DestroySnapshot() error = %v, want not ErrDatasetBusy", err)
+	}
+}
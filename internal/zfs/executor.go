@@ -0,0 +1,197 @@
+package zfs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// InterruptedError reports a command which was killed because its context was cancelled or timed out
+type InterruptedError struct {
+	Err     error
+	Command string
+}
+
+func (e *InterruptedError) Error() string {
+	return fmt.Sprintf("interrupted %q: %v", e.Command, e.Err)
+}
+
+func (e *InterruptedError) Unwrap() error {
+	return e.Err
+}
+
+// Executor runs the external commands (zfs, zpool, getconf, sh) a Client needs
+type Executor interface {
+	// Run runs the command and waits for it to finish
+	Run(ctx context.Context, name string, args ...string) error
+	// Output runs the command and returns its standard output
+	Output(ctx context.Context, name string, args ...string) ([]byte, error)
+	// Stream runs the command and calls onLine for each line of its standard output
+	Stream(ctx context.Context, onLine func(line string), name string, args ...string) error
+}
+
+// Piper is an Executor which can also pipe the standard output of one command into another, as zfs send is into
+// zfs receive
+type Piper interface {
+	// Pipe runs from with its standard output going to the standard input of to, and waits for both to finish
+	Pipe(ctx context.Context, from, to []string) error
+}
+
+// CommandExecutor is an Executor which runs commands on the local host
+type CommandExecutor struct {
+	// CommandContext builds the command to run, exec.CommandContext is used when nil
+	CommandContext func(ctx context.Context, name string, args ...string) *exec.Cmd
+}
+
+// command builds the command in its own process group, so that the whole group is killed when ctx is done.
+// Unless the command already has somewhere to send it, standard error is captured in stderr.
+func (e CommandExecutor) command(ctx context.Context, stderr *bytes.Buffer, name string, args ...string) *exec.Cmd {
+	var cmd *exec.Cmd
+
+	if e.CommandContext != nil {
+		cmd = e.CommandContext(ctx, name, args...)
+	} else {
+		cmd = exec.CommandContext(ctx, name, args...)
+	}
+
+	if cmd.Stderr == nil {
+		cmd.Stderr = stderr
+	}
+
+	setProcessGroup(cmd)
+
+	return cmd
+}
+
+// wrapError returns a CommandError for err from running the command with what it wrote to stderr, or an
+// InterruptedError when the command was interrupted by ctx
+func wrapError(ctx context.Context, err error, stderr *bytes.Buffer, name string, args ...string) error {
+	if ctx.Err() != nil {
+		return &InterruptedError{
+			Command: strings.Join(append([]string{name}, args...), " "),
+			Err:     context.Cause(ctx),
+		}
+	}
+
+	// keep multi-line zfs messages on one line
+	message := strings.ReplaceAll(strings.TrimSpace(stderr.String()), "\n", "; ")
+
+	return newCommandError(err, message, name, args...)
+}
+
+// Run runs the command and waits for it to finish
+func (e CommandExecutor) Run(ctx context.Context, name string, args ...string) error {
+	var stderr bytes.Buffer
+
+	err := e.command(ctx, &stderr, name, args...).Run()
+	if err != nil {
+		return wrapError(ctx, err, &stderr, name, args...)
+	}
+
+	return nil
+}
+
+// Output runs the command and returns its standard output
+func (e CommandExecutor) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+
+	out, err := e.command(ctx, &stderr, name, args...).Output()
+	if err != nil {
+		return nil, wrapError(ctx, err, &stderr, name, args...)
+	}
+
+	return out, nil
+}
+
+// Stream runs the command and calls onLine for each line of its standard output
+func (e CommandExecutor) Stream(ctx context.Context, onLine func(line string), name string, args ...string) error {
+	var stderr bytes.Buffer
+
+	cmd := e.command(ctx, &stderr, name, args...)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("stdout pipe: %w", err)
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return wrapError(ctx, err, &stderr, name, args...)
+	}
+
+	scanner := bufio.NewScanner(stdout)
+
+	for scanner.Scan() {
+		onLine(scanner.Text())
+	}
+
+	err = cmd.Wait()
+	if err != nil {
+		return wrapError(ctx, err, &stderr, name, args...)
+	}
+
+	return nil
+}
+
+// Pipe runs from with its standard output going to the standard input of to. Each command's error reports its own
+// standard error.
+func (e CommandExecutor) Pipe(ctx context.Context, from, to []string) error {
+	var fromStderr, toStderr bytes.Buffer
+
+	fromCmd := e.command(ctx, &fromStderr, from[0], from[1:]...)
+	toCmd := e.command(ctx, &toStderr, to[0], to[1:]...)
+
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("pipe: %w", err)
+	}
+
+	fromCmd.Stdout = writer
+	toCmd.Stdin = reader
+
+	fromErr := fromCmd.Start()
+	if fromErr != nil {
+		fromErr = wrapError(ctx, fromErr, &fromStderr, from[0], from[1:]...)
+	}
+
+	toErr := toCmd.Start()
+	if toErr != nil {
+		toErr = wrapError(ctx, toErr, &toStderr, to[0], to[1:]...)
+	}
+
+	// the commands have their own copies of the pipe, which breaks when either end exits
+	_ = reader.Close()
+	_ = writer.Close()
+
+	if fromErr != nil || toErr != nil {
+		if fromErr == nil {
+			_ = fromCmd.Process.Kill()
+			_ = fromCmd.Wait()
+		}
+
+		if toErr == nil {
+			_ = toCmd.Wait()
+		}
+
+		return errors.Join(toErr, fromErr)
+	}
+
+	fromErr = fromCmd.Wait()
+	toErr = toCmd.Wait()
+
+	if toErr != nil {
+		toErr = wrapError(ctx, toErr, &toStderr, to[0], to[1:]...)
+	}
+
+	if fromErr != nil {
+		fromErr = wrapError(ctx, fromErr, &fromStderr, from[0], from[1:]...)
+	}
+
+	// when the receiving end fails, the sending end usually only fails because of it
+	return errors.Join(toErr, fromErr)
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package zfs
+
+import "os/exec"
+
+// setProcessGroup is a no-op where process groups are not available, cancellation only kills cmd itself
+func setProcessGroup(_ *exec.Cmd) {}
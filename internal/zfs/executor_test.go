@@ -0,0 +1,144 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	exec "golang.org/x/sys/execabs"
+
+	"zfstools-go/internal/zfstoolstest"
+)
+
+func TestCommandExecutor_Interrupted(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 100*time.Millisecond)
+	defer cancel()
+
+	executor := CommandExecutor{CommandContext: zfstoolstest.MakeFakeCommand("TestCommandExecutor_hang")}
+
+	start := time.Now()
+
+	err := executor.Run(ctx, "zfs", "list", "-H")
+
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("command was not killed when the context was done")
+	}
+
+	var interrupted *InterruptedError
+	if !errors.As(err, &interrupted) {
+		t.Fatalf("Run() error = %v, want InterruptedError", err)
+	}
+
+	if interrupted.Command != "zfs list -H" {
+		t.Errorf("Command = %q, want %q", interrupted.Command, "zfs list -H")
+	}
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Run() error = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestCommandExecutor_Failed(t *testing.T) {
+	t.Parallel()
+
+	executor := CommandExecutor{CommandContext: zfstoolstest.MakeFakeCommand("TestCommandExecutor_fail")}
+
+	err := executor.Run(t.Context(), "zfs", "list")
+
+	var interrupted *InterruptedError
+	if err == nil || errors.As(err, &interrupted) {
+		t.Fatalf("Run() error = %v, want plain failure", err)
+	}
+
+	want := "zfs list: exit status 1: cannot open 'tank/gone': dataset does not exist; second line"
+	if err.Error() != want {
+		t.Errorf("Run() error = %q, want %q", err.Error(), want)
+	}
+
+	if !errors.Is(err, ErrDoesNotExist) {
+		t.Errorf("Run() error = %v, want ErrDoesNotExist", err)
+	}
+}
+
+func TestCommandExecutor_Pipe(t *testing.T) {
+	t.Parallel()
+
+	send := zfstoolstest.MakeFakeCommand("TestCommandExecutor_send")
+	receive := zfstoolstest.MakeFakeCommand("TestCommandExecutor_receive")
+	executor := CommandExecutor{CommandContext: func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		if args[0] == "send" {
+			return send(ctx, name, args...)
+		}
+
+		return receive(ctx, name, args...)
+	}}
+
+	err := executor.Pipe(t.Context(), []string{"zfs", "send", "stream"}, []string{"zfs", "receive", "tank/copy"})
+	if err != nil {
+		t.Errorf("Pipe() error = %v", err)
+	}
+
+	err = executor.Pipe(t.Context(), []string{"zfs", "send", "garbage"}, []string{"zfs", "receive", "tank/copy"})
+
+	want := "zfs receive tank/copy: exit status 1: cannot receive: invalid stream"
+	if err == nil || err.Error() != want {
+		t.Errorf("Pipe() error = %v, want %q", err, want)
+	}
+}
+
+// test helpers from here down
+
+//nolint:paralleltest
+func TestCommandExecutor_hang(_ *testing.T) {
+	if !zfstoolstest.IsTestEnv() {
+		return
+	}
+
+	time.Sleep(time.Minute)
+
+	os.Exit(0)
+}
+
+//nolint:paralleltest
+func TestCommandExecutor_fail(_ *testing.T) {
+	if !zfstoolstest.IsTestEnv() {
+		return
+	}
+
+	_, _ = fmt.Fprintf(os.Stderr, "cannot open 'tank/gone': dataset does not exist\nsecond line\n")
+
+	os.Exit(1)
+}
+
+//nolint:paralleltest
+func TestCommandExecutor_send(_ *testing.T) {
+	if !zfstoolstest.IsTestEnv() {
+		return
+	}
+
+	fmt.Println(os.Args[len(os.Args)-1]) //nolint:forbidigo
+
+	os.Exit(0)
+}
+
+//nolint:paralleltest
+func TestCommandExecutor_receive(_ *testing.T) {
+	if !zfstoolstest.IsTestEnv() {
+		return
+	}
+
+	stream, _ := io.ReadAll(os.Stdin)
+	if string(stream) != "stream\n" {
+		_, _ = fmt.Fprintf(os.Stderr, "cannot receive: invalid stream\n")
+
+		os.Exit(1)
+	}
+
+	os.Exit(0)
+}
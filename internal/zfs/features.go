@@ -1,48 +1,81 @@
 package zfs
 
 import (
-	"sync"
+	"context"
+	"strings"
 )
 
-var listPoolsFn = ListPools
+// poolFeature is a feature, such as "bookmarks", of a pool, or something else a pool may or may not support
+type poolFeature struct {
+	pool    string
+	feature string
+}
 
-var (
-	onceBookmarks sync.Once
-	onceMultiSnap sync.Once
+// PoolName returns the name of the pool a dataset, snapshot or bookmark is in
+func PoolName(name string) string {
+	end := strings.IndexAny(name, "/@#")
+	if end < 0 {
+		return name
+	}
 
-	haveBookmarks bool
-	haveMultiSnap bool
-)
+	return name[:end]
+}
 
-// HasBookmarks checks for support of 'feature@bookmarks'
-func HasBookmarks(debug bool) bool {
-	onceBookmarks.Do(func() {
-		pools, err := listPoolsFn("", []string{"feature@bookmarks"}, debug)
+// HasFeature reports whether feature, such as "bookmarks", is enabled or active on pool. The answer is cached per
+// pool once the pool could be checked, a pool which could not be doesn't have the feature for now.
+func (c *Client) HasFeature(ctx context.Context, pool, feature string, debug bool) bool {
+	return c.cachedFeature(poolFeature{pool: pool, feature: feature}, func() (bool, error) {
+		pools, err := c.ListPools(ctx, pool, []string{"feature@" + feature}, debug)
 		if err != nil {
-			haveBookmarks = false
-
-			return
+			return false, err
 		}
 
-		for _, pool := range pools {
-			if _, ok := pool.Properties["feature@bookmarks"]; ok {
-				haveBookmarks = true
-
-				return
+		for _, p := range pools {
+			state := p.Properties["feature@"+feature]
+			if p.Name == pool && (state == "enabled" || state == "active") {
+				return true, nil
 			}
 		}
 
-		haveBookmarks = false
+		return false, nil
 	})
+}
+
+// cachedFeature returns whether the pool has the feature of key, calling check only when it isn't cached yet. Only
+// the answers of checks which didn't fail are cached, so that a failure such as a timeout is tried again. The lock
+// isn't held while checking, so that a slow pool doesn't hold up the checks of the others.
+func (c *Client) cachedFeature(key poolFeature, check func() (bool, error)) bool {
+	c.featuresMutex.Lock()
+	have, ok := c.features[key]
+	c.featuresMutex.Unlock()
+
+	if ok {
+		return have
+	}
 
-	return haveBookmarks
+	have, err := check()
+	if err != nil {
+		return false
+	}
+
+	c.featuresMutex.Lock()
+	defer c.featuresMutex.Unlock()
+
+	if c.features == nil {
+		c.features = map[poolFeature]bool{}
+	}
+
+	c.features[key] = have
+
+	return have
 }
 
-// HasMultiSnap piggybacks on HasBookmarks
-func HasMultiSnap(debug bool) bool {
-	onceMultiSnap.Do(func() {
-		haveMultiSnap = HasBookmarks(debug)
-	})
+// HasBookmarks checks for support of 'feature@bookmarks' on pool
+func (c *Client) HasBookmarks(ctx context.Context, pool string, debug bool) bool {
+	return c.HasFeature(ctx, pool, "bookmarks", debug)
+}
 
-	return haveMultiSnap
+// HasMultiSnap piggybacks on HasBookmarks
+func (c *Client) HasMultiSnap(ctx context.Context, pool string, debug bool) bool {
+	return c.HasBookmarks(ctx, pool, debug)
 }
@@ -1,61 +1,67 @@
 package zfs
 
 import (
-	"sync"
+	"context"
+	"strings"
 	"testing"
 )
 
-//nolint:paralleltest
-func TestHasBookmarks_True(t *testing.T) {
-	resetFeatures()
+// stubExecutor answers every command with the same output or error and records what was run
+type stubExecutor struct {
+	err    error
+	output string
+	calls  [][]string
+}
+
+func (e *stubExecutor) Run(_ context.Context, name string, args ...string) error {
+	e.calls = append(e.calls, append([]string{name}, args...))
+
+	return e.err
+}
+
+func (e *stubExecutor) Output(_ context.Context, name string, args ...string) ([]byte, error) {
+	e.calls = append(e.calls, append([]string{name}, args...))
 
-	listPoolsFn = func(_ string, _ []string, _ bool) ([]Pool, error) {
-		return []Pool{
-			{Properties: map[string]string{"feature@bookmarks": "enabled"}},
-		}, nil
+	return []byte(e.output), e.err
+}
+
+func (e *stubExecutor) Stream(_ context.Context, onLine func(line string), name string, args ...string) error {
+	e.calls = append(e.calls, append([]string{name}, args...))
+
+	for line := range strings.Lines(e.output) {
+		onLine(strings.TrimSuffix(line, "\n"))
 	}
 
-	if !HasBookmarks(false) {
+	return e.err
+}
+
+//nolint:paralleltest
+func TestHasBookmarks_True(t *testing.T) {
+	client := NewClient(&stubExecutor{output: "tank\tfeature@bookmarks\tenabled\n"})
+
+	if !client.HasBookmarks(t.Context(), "tank", false) {
 		t.Fatal("expected HasBookmarks to return true")
 	}
 }
 
 //nolint:paralleltest
 func TestHasBookmarks_False(t *testing.T) {
-	resetFeatures()
-
-	listPoolsFn = func(_ string, _ []string, _ bool) ([]Pool, error) {
-		return []Pool{
-			{Properties: map[string]string{}},
-		}, nil
-	}
+	client := NewClient(&stubExecutor{})
 
-	if HasBookmarks(false) {
+	if client.HasBookmarks(t.Context(), "tank", false) {
 		t.Fatal("expected HasBookmarks to return false")
 	}
 }
 
 //nolint:paralleltest
 func TestHasBookmarks_Error(t *testing.T) {
-	resetFeatures()
+	client := NewClient(&stubExecutor{err: assertError("simulated failure")})
 
-	listPoolsFn = func(_ string, _ []string, _ bool) ([]Pool, error) {
-		return nil, assertError("simulated failure")
-	}
-
-	if HasBookmarks(false) {
+	if client.HasBookmarks(t.Context(), "tank", false) {
 		t.Fatal("expected HasBookmarks to return false on error")
 	}
 }
 
-func resetFeatures() {
-	haveBookmarks = false
-	haveMultiSnap = false
-	listPoolsFn = ListPools
-	onceBookmarks = sync.Once{}
-	onceMultiSnap = sync.Once{}
-}
-
 type assertError string
 
 func (e assertError) Error() string {
@@ -64,30 +70,95 @@ func (e assertError) Error() string {
 
 //nolint:paralleltest
 func TestHasMultiSnap_True(t *testing.T) {
-	resetFeatures()
+	client := NewClient(&stubExecutor{output: "tank\tfeature@bookmarks\tenabled\n"})
 
-	listPoolsFn = func(_ string, _ []string, _ bool) ([]Pool, error) {
-		return []Pool{
-			{Properties: map[string]string{"feature@bookmarks": "enabled"}},
-		}, nil
-	}
-
-	if !HasMultiSnap(false) {
+	if !client.HasMultiSnap(t.Context(), "tank", false) {
 		t.Fatal("expected HasMultiSnap to return true")
 	}
 }
 
 //nolint:paralleltest
 func TestHasMultiSnap_False(t *testing.T) {
-	resetFeatures()
+	client := NewClient(&stubExecutor{})
 
-	listPoolsFn = func(_ string, _ []string, _ bool) ([]Pool, error) {
-		return []Pool{
-			{Properties: map[string]string{}},
-		}, nil
+	if client.HasMultiSnap(t.Context(), "tank", false) {
+		t.Fatal("expected HasMultiSnap to return false")
 	}
+}
 
-	if HasMultiSnap(false) {
-		t.Fatal("expected HasMultiSnap to return false")
+//nolint:paralleltest
+func TestHasBookmarks_Cached(t *testing.T) {
+	executor := &stubExecutor{output: "tank\tfeature@bookmarks\tenabled\n"}
+	client := NewClient(executor)
+
+	client.HasBookmarks(t.Context(), "tank", false)
+	client.HasMultiSnap(t.Context(), "tank", false)
+
+	if len(executor.calls) != 1 {
+		t.Fatalf("expected 1 zpool call, got %d", len(executor.calls))
+	}
+}
+
+//nolint:paralleltest
+func TestHasBookmarks_ErrorNotCached(t *testing.T) {
+	executor := &stubExecutor{err: assertError("simulated failure")}
+	client := NewClient(executor)
+
+	if client.HasBookmarks(t.Context(), "tank", false) {
+		t.Fatal("expected HasBookmarks to return false on error")
+	}
+
+	executor.err = nil
+	executor.output = "tank\tfeature@bookmarks\tenabled\n"
+
+	if !client.HasBookmarks(t.Context(), "tank", false) {
+		t.Fatal("expected HasBookmarks to check again after an error")
+	}
+}
+
+//nolint:paralleltest
+func TestHasBookmarks_Disabled(t *testing.T) {
+	client := NewClient(&stubExecutor{output: "tank\tfeature@bookmarks\tdisabled\n"})
+
+	if client.HasBookmarks(t.Context(), "tank", false) {
+		t.Fatal("expected HasBookmarks to return false for a disabled feature")
+	}
+}
+
+//nolint:paralleltest
+func TestHasBookmarks_PerPool(t *testing.T) {
+	executor := &stubExecutor{output: "tank\tfeature@bookmarks\tactive\n"}
+	client := NewClient(executor)
+
+	if !client.HasBookmarks(t.Context(), "tank", false) {
+		t.Error("expected tank to have bookmarks")
+	}
+
+	// the answer for tank doesn't carry over to another pool
+	if client.HasBookmarks(t.Context(), "backup", false) {
+		t.Error("expected backup not to have bookmarks")
+	}
+
+	client.HasMultiSnap(t.Context(), "tank", false)
+	client.HasMultiSnap(t.Context(), "backup", false)
+
+	if len(executor.calls) != 2 {
+		t.Fatalf("expected 2 zpool calls, got %d", len(executor.calls))
+	}
+}
+
+func TestPoolName(t *testing.T) {
+	t.Parallel()
+
+	for name, want := range map[string]string{
+		"tank":             "tank",
+		"tank/data":        "tank",
+		"tank@snap":        "tank",
+		"tank/data@snap/x": "tank",
+		"tank/data#mark":   "tank",
+	} {
+		if got := PoolName(name); got != want {
+			t.Errorf("PoolName(%q) = %q, want %q", name, got, want)
+		}
 	}
 }
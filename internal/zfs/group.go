@@ -0,0 +1,93 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// GroupProperty is the user property naming the consistency group a dataset is in. The snapshots of the datasets
+// of a group which are on the same pool are taken by one zfs snapshot command, so they are of the same point in
+// time. ZFS can't take snapshots in different pools at once, those of each pool are taken one after the other.
+const GroupProperty = "com.sun:auto-snapshot-group"
+
+var ErrGroupNotAtomic = errors.New("consistency group can't be snapshot atomically")
+
+// snapshotGroup is the datasets of a consistency group which are on one pool
+type snapshotGroup struct {
+	name     string
+	pool     string
+	datasets []Dataset
+}
+
+// addToGroup adds ds to its consistency group in groups, or to a new one, keeping the groups in the order their
+// first dataset came in
+func addToGroup(groups []*snapshotGroup, ds Dataset) []*snapshotGroup {
+	pool := PoolName(ds.Name)
+
+	i := slices.IndexFunc(groups, func(g *snapshotGroup) bool { return g.name == ds.Group && g.pool == pool })
+	if i < 0 {
+		return append(groups, &snapshotGroup{name: ds.Group, pool: pool, datasets: []Dataset{ds}})
+	}
+
+	groups[i].datasets = append(groups[i].datasets, ds)
+
+	return groups
+}
+
+// createGroupSnapshot takes the snapshots of group with one command, or channel program, between the hooks of its
+// datasets. None of them are taken when that isn't possible: when a dataset needs its database locked or, without a
+// channel program, without multi-snapshot support or when the command would be longer than argMax.
+func (c *Client) createGroupSnapshot(
+	ctx context.Context,
+	group *snapshotGroup,
+	snapshotName string,
+	argMax func() int,
+	recursive, dryRun, verbose, debug bool,
+) error {
+	var snaps []string
+
+	var hooks []Hook
+
+	var locked *Dataset
+
+	length := 0
+
+	for i, ds := range group.datasets {
+		snaps = append(snaps, ds.Name+"@"+snapshotName)
+		hooks = AddHooks(hooks, ds.Hooks)
+		length += len(ds.Name) + len("@") + len(snapshotName) + len(" ")
+
+		if ds.DB != "" && locked == nil {
+			locked = &group.datasets[i]
+		}
+	}
+
+	var err error
+
+	// a channel program takes them all at once, however many there are
+	program := len(snaps) > 1 && c.UsesChannelPrograms(ctx, group.pool, debug)
+
+	switch {
+	case locked != nil:
+		err = fmt.Errorf("%w: %s: %s needs its %s database locked", ErrGroupNotAtomic, group.name, locked.Name, locked.DB)
+	case program:
+	case len(snaps) > 1 && !c.HasMultiSnap(ctx, group.pool, debug):
+		err = fmt.Errorf("%w: %s: feature@bookmarks isn't enabled on %s", ErrGroupNotAtomic, group.name, group.pool)
+	case len(snaps) > 1 && length > argMax():
+		err = fmt.Errorf("%w: %s: its %d snapshots don't fit in one command", ErrGroupNotAtomic, group.name, len(snaps))
+	}
+
+	if err != nil {
+		return &SnapshotError{Err: err, Op: "creating", Snapshots: snaps}
+	}
+
+	return c.withHooks(ctx, hooks, snaps, snapshotName, dryRun, verbose, debug, func(ctx context.Context) error {
+		if program {
+			return c.createSnapshotsProgram(ctx, group.pool, snaps, recursive, dryRun, verbose, debug)
+		}
+
+		return c.CreateSnapshot(ctx, snaps, recursive, "", dryRun, verbose, debug)
+	})
+}
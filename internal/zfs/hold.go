@@ -0,0 +1,156 @@
+package zfs
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HoldExpiresProperty, followed by ":" and the tag of a hold, is the snapshot property holding when the hold
+// expires, in seconds since the epoch
+const HoldExpiresProperty = "com.sun:auto-snapshot-hold-expires"
+
+// Holds returns the tags of the holds on snapshot
+func (c *Client) Holds(ctx context.Context, snapshot string, debug bool) ([]string, error) {
+	args := []string{"holds", "-H", snapshot}
+
+	if debug {
+		fmt.Println("zfs", strings.Join(args, " ")) //nolint:forbidigo
+	}
+
+	var tags []string
+
+	err := c.stream(ctx, func(line string) {
+		fields := strings.Split(line, "\t")
+		if len(fields) >= 2 { //nolint:mnd
+			tags = append(tags, fields[1])
+		}
+	}, "zfs", args...)
+	if err != nil {
+		return nil, fmt.Errorf("error listing holds of %s: %w", snapshot, err)
+	}
+
+	return tags, nil
+}
+
+// Hold places a hold with tag on snapshot, so that it can't be destroyed until the hold is released
+func (c *Client) Hold(ctx context.Context, tag, snapshot string, dryRun, debug bool) error {
+	err := c.holdCommand(ctx, "hold", tag, snapshot, dryRun, debug)
+	if err != nil {
+		return fmt.Errorf("error holding %s: %w", snapshot, err)
+	}
+
+	return nil
+}
+
+// Release releases the hold with tag on snapshot
+func (c *Client) Release(ctx context.Context, tag, snapshot string, dryRun, debug bool) error {
+	err := c.holdCommand(ctx, "release", tag, snapshot, dryRun, debug)
+	if err != nil {
+		return fmt.Errorf("error releasing %s: %w", snapshot, err)
+	}
+
+	return nil
+}
+
+// holdCommand runs zfs hold or zfs release
+func (c *Client) holdCommand(ctx context.Context, command, tag, snapshot string, dryRun, debug bool) error {
+	args := []string{command, tag, snapshot}
+
+	if debug {
+		fmt.Println("zfs", strings.Join(args, " ")) //nolint:forbidigo
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	return c.run(ctx, "zfs", args...)
+}
+
+// HeldSnapshots returns the names of the snapshots of dataset, or of every dataset when it is empty, and of its
+// descendants which have any user holds
+func (c *Client) HeldSnapshots(ctx context.Context, dataset string, debug bool) (map[string]bool, error) {
+	args := []string{"list", "-H", "-p", "-r", "-t", "snapshot", "-o", "name,userrefs"}
+
+	if dataset != "" {
+		args = append(args, dataset)
+	}
+
+	if debug {
+		fmt.Println("zfs", strings.Join(args, " ")) //nolint:forbidigo
+	}
+
+	held := map[string]bool{}
+
+	err := c.stream(ctx, func(line string) {
+		name, refs, _ := strings.Cut(line, "\t")
+
+		count, err := strconv.ParseInt(refs, 10, 64)
+		if err == nil && count > 0 {
+			held[name] = true
+		}
+	}, "zfs", args...)
+	if err != nil {
+		return nil, fmt.Errorf("error listing held snapshots: %w", err)
+	}
+
+	return held, nil
+}
+
+// HoldExpiries returns when the holds on snapshot which expire do so, by tag
+func (c *Client) HoldExpiries(ctx context.Context, snapshot string, debug bool) (map[string]time.Time, error) {
+	args := []string{"get", "-H", "-p", "-s", "local", "-o", "property,value", "all", snapshot}
+
+	if debug {
+		fmt.Println("zfs", strings.Join(args, " ")) //nolint:forbidigo
+	}
+
+	expiries := map[string]time.Time{}
+
+	err := c.stream(ctx, func(line string) {
+		property, value, _ := strings.Cut(line, "\t")
+
+		tag, found := strings.CutPrefix(property, HoldExpiresProperty+":")
+		if !found {
+			return
+		}
+
+		seconds, err := strconv.ParseInt(value, 10, 64)
+		if err == nil {
+			expiries[tag] = time.Unix(seconds, 0)
+		}
+	}, "zfs", args...)
+	if err != nil {
+		return nil, fmt.Errorf("error getting hold expiries of %s: %w", snapshot, err)
+	}
+
+	return expiries, nil
+}
+
+// SetHoldExpiry records when the hold with tag on snapshot expires, or with a zero expires that it doesn't
+func (c *Client) SetHoldExpiry(ctx context.Context, tag, snapshot string, expires time.Time, dryRun, debug bool) error {
+	property := HoldExpiresProperty + ":" + tag
+	args := []string{"inherit", property, snapshot}
+
+	if !expires.IsZero() {
+		args = []string{"set", property + "=" + strconv.FormatInt(expires.Unix(), 10), snapshot}
+	}
+
+	if debug {
+		fmt.Println("zfs", strings.Join(args, " ")) //nolint:forbidigo
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	err := c.run(ctx, "zfs", args...)
+	if err != nil {
+		return fmt.Errorf("error setting hold expiry of %s: %w", snapshot, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package zfs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+)
+
+func TestHeldSnapshots(t *testing.T) {
+	t.Parallel()
+
+	executor := &stubExecutor{output: "tank/data@a\t0\ntank/data@b\t2\ntank/data@c\t-\n"}
+	client := NewClient(executor)
+
+	got, err := client.HeldSnapshots(t.Context(), "tank", false)
+	if err != nil {
+		t.Fatalf("HeldSnapshots() error = %v", err)
+	}
+
+	if diff := deep.Equal(got, map[string]bool{"tank/data@b": true}); diff != nil {
+		t.Error(diff)
+	}
+
+	want := [][]string{{"zfs", "list", "-H", "-p", "-r", "-t", "snapshot", "-o", "name,userrefs", "tank"}}
+	if diff := deep.Equal(executor.calls, want); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestHoldExpiries(t *testing.T) {
+	t.Parallel()
+
+	executor := &stubExecutor{output: "com.sun:auto-snapshot-hold-expires:audit\t1735689600\n" +
+		"com.sun:auto-snapshot-hold-expires:bogus\tsoon\ncom.sun:other\t1\n"}
+	client := NewClient(executor)
+
+	got, err := client.HoldExpiries(t.Context(), "tank/data@a", false)
+	if err != nil {
+		t.Fatalf("HoldExpiries() error = %v", err)
+	}
+
+	if diff := deep.Equal(got, map[string]time.Time{"audit": time.Unix(1735689600, 0)}); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestSetHoldExpiry(t *testing.T) {
+	t.Parallel()
+
+	executor := &stubExecutor{}
+	client := NewClient(executor)
+
+	for _, expires := range []time.Time{time.Unix(1735689600, 0), {}} {
+		err := client.SetHoldExpiry(t.Context(), "audit", "tank/data@a", expires, false, false)
+		if err != nil {
+			t.Fatalf("SetHoldExpiry() error = %v", err)
+		}
+	}
+
+	want := [][]string{
+		{"zfs", "set", "com.sun:auto-snapshot-hold-expires:audit=1735689600", "tank/data@a"},
+		{"zfs", "inherit", "com.sun:auto-snapshot-hold-expires:audit", "tank/data@a"},
+	}
+	if diff := deep.Equal(executor.calls, want); diff != nil {
+		t.Error(diff)
+	}
+}
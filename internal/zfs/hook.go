@@ -0,0 +1,196 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// HookProperty is the user property naming the executable run before and after a dataset's snapshot is taken
+const HookProperty = "com.sun:auto-snapshot-hook"
+
+// DefaultHookTimeout is how long a hook may run for, unless set with SetHookTimeout
+const DefaultHookTimeout = 5 * time.Minute
+
+// DefaultHooksDir is where hooks must be, unless set with SetHooksDir
+const DefaultHooksDir = "/usr/local/etc/zfstools/hooks"
+
+var ErrHookTimeout = errors.New("hook timed out")
+
+var ErrUnsafeHook = errors.New("unsafe hook")
+
+// Hook is an executable run with "pre", before a snapshot of Dataset is taken, and "post", after it, followed by
+// the names of the dataset and snapshot. A snapshot isn't taken when its pre hook fails.
+type Hook struct {
+	Path    string
+	Dataset string
+}
+
+// AddHooks returns hooks with those of other which aren't already in it, by path. Hooks are inherited like other
+// user properties, so a dataset's descendants usually have the same hook as it.
+func AddHooks(hooks []Hook, other []Hook) []Hook {
+	for _, hook := range other {
+		if !slices.ContainsFunc(hooks, func(h Hook) bool { return h.Path == hook.Path }) {
+			hooks = append(slices.Clip(hooks), hook)
+		}
+	}
+
+	return hooks
+}
+
+// SetHookTimeout sets how long a hook may run for before it is killed and counted as failed
+func (c *Client) SetHookTimeout(timeout time.Duration) {
+	c.hookTimeout = timeout
+}
+
+// SetHooksDir sets the directory the hooks must be in. Anyone allowed to set the user properties of a dataset can
+// name a hook, which is run as root, so only the executables an administrator put there are.
+func (c *Client) SetHooksDir(dir string) {
+	c.hooksDir = dir
+}
+
+// checkHook returns an error wrapping ErrUnsafeHook unless path is an executable in the hooks directory, which it and
+// the directories down to it are owned by root, or the user running it, and nobody else may write to
+func (c *Client) checkHook(path string) error {
+	dir := c.hooksDir
+	if dir == "" {
+		dir = DefaultHooksDir
+	}
+
+	dir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return fmt.Errorf("%w %s: %w", ErrUnsafeHook, path, err)
+	}
+
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return fmt.Errorf("%w %s: %w", ErrUnsafeHook, path, err)
+	}
+
+	rel, err := filepath.Rel(dir, resolved)
+	if err != nil || !filepath.IsAbs(path) || rel == ".." || strings.HasPrefix(rel, "../") {
+		return fmt.Errorf("%w %s: not in %s", ErrUnsafeHook, path, dir)
+	}
+
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return fmt.Errorf("%w %s: %w", ErrUnsafeHook, path, err)
+	}
+
+	if !info.Mode().IsRegular() || info.Mode().Perm()&0o111 == 0 {
+		return fmt.Errorf("%w %s: not an executable file", ErrUnsafeHook, path)
+	}
+
+	// whoever may change the hook, or the directories it is in, may run anything
+	for name := resolved; ; name = filepath.Dir(name) {
+		err = checkHookOwner(name)
+		if err != nil {
+			return fmt.Errorf("%w %s: %w", ErrUnsafeHook, path, err)
+		}
+
+		if name == dir {
+			return nil
+		}
+	}
+}
+
+// checkHookOwner returns an error when name is owned by someone other than root or the user running it, who could
+// run anything anyway, or others may write to it
+func checkHookOwner(name string) error {
+	info, err := os.Stat(name)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	if info.Mode().Perm()&0o022 != 0 {
+		return fmt.Errorf("%s is writable by group or others", name) //nolint:err113
+	}
+
+	owner, ok := fileOwner(info)
+	if ok && owner != 0 && int(owner) != os.Geteuid() {
+		return fmt.Errorf("%s is owned by uid %d, not root", name, owner) //nolint:err113
+	}
+
+	return nil
+}
+
+// runHook runs the hook for phase and the snapshot snapshotName of its dataset, killing it after the hook timeout
+func (c *Client) runHook(
+	ctx context.Context,
+	hook Hook,
+	phase, snapshotName string,
+	dryRun, verbose, debug bool,
+) error {
+	args := []string{phase, hook.Dataset, hook.Dataset + "@" + snapshotName}
+
+	err := c.checkHook(hook.Path)
+	if err != nil {
+		return fmt.Errorf("error running %s hook for %s: %w", phase, hook.Dataset, err)
+	}
+
+	if debug || verbose {
+		fmt.Println(hook.Path, strings.Join(args, " ")) //nolint:forbidigo
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	timeout := c.hookTimeout
+	if timeout <= 0 {
+		timeout = DefaultHookTimeout
+	}
+
+	ctx, cancel := context.WithTimeoutCause(ctx, timeout, ErrHookTimeout)
+	defer cancel()
+
+	err = c.run(ctx, hook.Path, args...)
+	if err != nil {
+		return fmt.Errorf("error running %s hook for %s: %w", phase, hook.Dataset, err)
+	}
+
+	return nil
+}
+
+// withHooks calls take, which takes the snapshots targets named snapshotName, between the pre and post hooks.
+// Nothing is taken when a pre hook fails, and the post hooks of those whose pre hook ran are always run, in reverse
+// order. Hooks aren't run in a dry run.
+func (c *Client) withHooks(
+	ctx context.Context,
+	hooks []Hook,
+	targets []string,
+	snapshotName string,
+	dryRun, verbose, debug bool,
+	take func(ctx context.Context) error,
+) error {
+	var errs []error
+
+	ran := 0
+
+	for _, hook := range hooks {
+		err := c.runHook(ctx, hook, "pre", snapshotName, dryRun, verbose, debug)
+		if err != nil {
+			errs = append(errs, &SnapshotError{Err: err, Op: "creating", Snapshots: targets})
+
+			break
+		}
+
+		ran++
+	}
+
+	if len(errs) == 0 {
+		errs = append(errs, take(ctx))
+	}
+
+	// whatever the pre hooks did is undone even when interrupted
+	for _, hook := range slices.Backward(hooks[:ran]) {
+		errs = append(errs, c.runHook(context.WithoutCancel(ctx), hook, "post", snapshotName, dryRun, verbose, debug))
+	}
+
+	return errors.Join(errs...)
+}
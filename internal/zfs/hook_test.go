@@ -0,0 +1,260 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+)
+
+var errHookFailed = errors.New("exit status 1")
+
+// scriptedExecutor records the commands run and fails those in fail. Commands in hang run until they are killed.
+type scriptedExecutor struct {
+	stubExecutor
+
+	fail []string
+	hang []string
+}
+
+func (e *scriptedExecutor) Run(ctx context.Context, name string, args ...string) error {
+	command := strings.Join(append([]string{name}, args...), " ")
+	e.calls = append(e.calls, append([]string{name}, args...))
+
+	if slices.Contains(e.hang, command) {
+		<-ctx.Done()
+
+		return context.Cause(ctx)
+	}
+
+	if slices.Contains(e.fail, command) {
+		return errHookFailed
+	}
+
+	return nil
+}
+
+// hooksClient returns a client running its commands with executor, and hooks from a new hooks directory holding an
+// executable for each of names
+func hooksClient(t *testing.T, executor Executor, names ...string) *Client {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	for _, name := range names {
+		err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"), 0o755) //nolint:gosec
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	client := NewClient(executor)
+	client.SetHooksDir(dir)
+
+	return client
+}
+
+func TestCreateManySnapshots_Hooks(t *testing.T) {
+	t.Parallel()
+
+	hooks := []Hook{
+		{Path: "/hooks/vm", Dataset: "tank/vm"},
+		{Path: "/hooks/redis", Dataset: "tank/vm/redis"},
+	}
+
+	tests := []struct {
+		name      string
+		fail      []string
+		hang      []string
+		dryRun    bool
+		wantCalls [][]string
+		wantErr   error
+	}{
+		{
+			name: "around the snapshot",
+			wantCalls: [][]string{
+				{"/hooks/vm", "pre", "tank/vm", "tank/vm@snap"},
+				{"/hooks/redis", "pre", "tank/vm/redis", "tank/vm/redis@snap"},
+				{"zfs", "snapshot", "-r", "tank/vm@snap"},
+				{"/hooks/redis", "post", "tank/vm/redis", "tank/vm/redis@snap"},
+				{"/hooks/vm", "post", "tank/vm", "tank/vm@snap"},
+			},
+		},
+		{
+			name: "pre hook failed",
+			fail: []string{"/hooks/redis pre tank/vm/redis tank/vm/redis@snap"},
+			wantCalls: [][]string{
+				{"/hooks/vm", "pre", "tank/vm", "tank/vm@snap"},
+				{"/hooks/redis", "pre", "tank/vm/redis", "tank/vm/redis@snap"},
+				{"/hooks/vm", "post", "tank/vm", "tank/vm@snap"},
+			},
+			wantErr: errHookFailed,
+		},
+		{
+			name: "pre hook timed out",
+			hang: []string{"/hooks/vm pre tank/vm tank/vm@snap"},
+			wantCalls: [][]string{
+				{"/hooks/vm", "pre", "tank/vm", "tank/vm@snap"},
+			},
+			wantErr: ErrHookTimeout,
+		},
+		{
+			name: "snapshot failed",
+			fail: []string{"zfs snapshot -r tank/vm@snap"},
+			wantCalls: [][]string{
+				{"/hooks/vm", "pre", "tank/vm", "tank/vm@snap"},
+				{"/hooks/redis", "pre", "tank/vm/redis", "tank/vm/redis@snap"},
+				{"zfs", "snapshot", "-r", "tank/vm@snap"},
+				{"/hooks/redis", "post", "tank/vm/redis", "tank/vm/redis@snap"},
+				{"/hooks/vm", "post", "tank/vm", "tank/vm@snap"},
+			},
+			wantErr: errHookFailed,
+		},
+		{
+			name:   "dryRun",
+			dryRun: true,
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			executor := &scriptedExecutor{}
+			client := hooksClient(t, executor, "vm", "redis")
+			client.SetHookTimeout(10 * time.Millisecond)
+
+			// the hooks are named /hooks/... in the tests, but are in the hooks directory
+			inHooksDir := func(command string) string {
+				return strings.Replace(command, "/hooks", client.hooksDir, 1)
+			}
+
+			for _, command := range testCase.fail {
+				executor.fail = append(executor.fail, inHooksDir(command))
+			}
+
+			for _, command := range testCase.hang {
+				executor.hang = append(executor.hang, inHooksDir(command))
+			}
+
+			hooks := slices.Clone(hooks)
+			for i := range hooks {
+				hooks[i].Path = inHooksDir(hooks[i].Path)
+			}
+
+			err := client.CreateManySnapshots(t.Context(), "snap", []Dataset{{Name: "tank/vm", Hooks: hooks}}, true,
+				testCase.dryRun, false, false, 1)
+			if !errors.Is(err, testCase.wantErr) {
+				t.Fatalf("CreateManySnapshots() error = %v, want %v", err, testCase.wantErr)
+			}
+
+			var snapErr *SnapshotError
+			if err != nil {
+				if !errors.As(err, &snapErr) || !slices.Equal(snapErr.Snapshots, []string{"tank/vm@snap"}) {
+					t.Errorf("CreateManySnapshots() error = %v, want the snapshot reported as not created", err)
+				}
+			}
+
+			calls := executor.calls
+			for _, call := range calls {
+				if strings.HasPrefix(call[0], client.hooksDir) {
+					call[0] = "/hooks/" + filepath.Base(call[0])
+				}
+			}
+
+			if diff := deep.Equal(calls, testCase.wantCalls); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestCreateManySnapshots_UnsafeHooks(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		setup     func(dir string) (string, error)
+		needsRoot bool
+	}{
+		{
+			name: "outside the hooks directory",
+			setup: func(dir string) (string, error) {
+				return filepath.Join(dir, "..", "evil"), nil
+			},
+		},
+		{
+			name: "relative",
+			setup: func(_ string) (string, error) {
+				return "vm", nil
+			},
+		},
+		{
+			name: "writable by others",
+			setup: func(dir string) (string, error) {
+				path := filepath.Join(dir, "vm")
+
+				return path, os.Chmod(path, 0o777) //nolint:gosec
+			},
+		},
+		{
+			name: "owned by someone else",
+			setup: func(dir string) (string, error) {
+				path := filepath.Join(dir, "vm")
+
+				return path, os.Chown(path, 1, -1)
+			},
+			needsRoot: true,
+		},
+		{
+			name: "symlink out of the hooks directory",
+			setup: func(dir string) (string, error) {
+				path := filepath.Join(dir, "link")
+
+				return path, os.Symlink("/bin/sh", path)
+			},
+		},
+		{
+			name: "missing",
+			setup: func(dir string) (string, error) {
+				return filepath.Join(dir, "missing"), nil
+			},
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			if testCase.needsRoot && os.Geteuid() != 0 {
+				t.Skip("only root can give a file away")
+			}
+
+			executor := &scriptedExecutor{}
+			client := hooksClient(t, executor, "vm")
+
+			path, err := testCase.setup(client.hooksDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			datasets := []Dataset{{Name: "tank/vm", Hooks: []Hook{{Path: path, Dataset: "tank/vm"}}}}
+
+			err = client.CreateManySnapshots(t.Context(), "snap", datasets, false, false, false, false, 1)
+			if !errors.Is(err, ErrUnsafeHook) {
+				t.Errorf("CreateManySnapshots() error = %v, want %v", err, ErrUnsafeHook)
+			}
+
+			// neither the hook nor the snapshot is run
+			if len(executor.calls) != 0 {
+				t.Errorf("CreateManySnapshots() ran %v", executor.calls)
+			}
+		})
+	}
+}
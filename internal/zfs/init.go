@@ -1,9 +0,0 @@
-package zfs
-
-import "os/exec"
-
-var RunZfsFn = exec.Command
-
-var runZpoolFn = exec.Command
-
-var ListSnapshotsFn = ListSnapshots
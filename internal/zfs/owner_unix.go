@@ -0,0 +1,18 @@
+//go:build unix
+
+package zfs
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileOwner returns the uid owning the file of info
+func fileOwner(info os.FileInfo) (uint32, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+
+	return stat.Uid, true
+}
@@ -0,0 +1,55 @@
+package zfs
+
+import "sync"
+
+// ForEachInPools calls fn with each of items, those of each pool, going by the dataset or snapshot names nameOf
+// returns, in order and at most parallelism at a time. The items of different pools are done side by side, so that
+// a slow pool doesn't hold up the others. With a parallelism of 1 or less they are all done one after the other.
+func ForEachInPools[T any](items []T, nameOf func(T) string, parallelism int, fn func(T)) {
+	if parallelism <= 1 {
+		for _, item := range items {
+			fn(item)
+		}
+
+		return
+	}
+
+	pools := map[string][]T{}
+
+	var order []string
+
+	for _, item := range items {
+		pool := PoolName(nameOf(item))
+		if _, ok := pools[pool]; !ok {
+			order = append(order, pool)
+		}
+
+		pools[pool] = append(pools[pool], item)
+	}
+
+	var waitGroup sync.WaitGroup
+
+	for _, pool := range order {
+		queue := make(chan T, len(pools[pool]))
+
+		for _, item := range pools[pool] {
+			queue <- item
+		}
+
+		close(queue)
+
+		for range min(parallelism, len(pools[pool])) {
+			waitGroup.Add(1)
+
+			go func() {
+				defer waitGroup.Done()
+
+				for item := range queue {
+					fn(item)
+				}
+			}()
+		}
+	}
+
+	waitGroup.Wait()
+}
@@ -0,0 +1,65 @@
+package zfs
+
+import (
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+)
+
+func TestForEachInPools(t *testing.T) {
+	t.Parallel()
+
+	names := []string{"tank/a@1", "tank/b@1", "tank/c@1", "tank/d@1", "tank/e@1", "backup/a@1", "backup/b@1"}
+
+	tests := []struct {
+		name        string
+		parallelism int
+		want        map[string]int
+	}{
+		{name: "serial", parallelism: 1, want: map[string]int{"tank": 1, "backup": 1}},
+		{name: "unset", parallelism: 0, want: map[string]int{"tank": 1, "backup": 1}},
+		{name: "bounded", parallelism: 3, want: map[string]int{"tank": 3, "backup": 2}},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			var mutex sync.Mutex
+
+			running := map[string]int{}
+			most := map[string]int{}
+
+			var done []string
+
+			ForEachInPools(names, func(name string) string { return name }, testCase.parallelism, func(name string) {
+				pool := PoolName(name)
+
+				mutex.Lock()
+				running[pool]++
+				most[pool] = max(most[pool], running[pool])
+				mutex.Unlock()
+
+				time.Sleep(20 * time.Millisecond)
+
+				mutex.Lock()
+				running[pool]--
+				done = append(done, name)
+				mutex.Unlock()
+			})
+
+			if diff := deep.Equal(most, testCase.want); diff != nil {
+				t.Error(diff)
+			}
+
+			slices.Sort(done)
+
+			if !slices.Equal(done, slices.Sorted(slices.Values(names))) {
+				t.Errorf("ForEachInPools() did %v, want each of %v once", done, names)
+			}
+		})
+	}
+}
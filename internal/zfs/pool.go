@@ -1,7 +1,7 @@
 package zfs
 
 import (
-	"bufio"
+	"context"
 	"fmt"
 	"maps"
 	"slices"
@@ -14,7 +14,7 @@ type Pool struct {
 }
 
 // ListPools returns zfs pool(s), all pools or just the one specified by name arg
-func ListPools(name string, cmdProps []string, debug bool) ([]Pool, error) {
+func (c *Client) ListPools(ctx context.Context, name string, cmdProps []string, debug bool) ([]Pool, error) {
 	if len(cmdProps) == 0 {
 		cmdProps = []string{"all"}
 	}
@@ -37,28 +37,13 @@ func ListPools(name string, cmdProps []string, debug bool) ([]Pool, error) {
 		fmt.Printf("\n") //nolint:forbidigo
 	}
 
-	cmd := runZpoolFn("zpool", args...)
-
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return nil, fmt.Errorf("stdout pipe: %w", err)
-	}
-
-	err = cmd.Start()
-	if err != nil {
-		return nil, fmt.Errorf("zpool start: %w", err)
-	}
-
 	poolProps := map[string]map[string]string{}
 
-	scanner := bufio.NewScanner(stdout)
-
-	for scanner.Scan() {
-		line := scanner.Text()
+	err := c.stream(ctx, func(line string) {
 		values := strings.Split(line, "\t")
 
 		if len(values) < 3 {
-			continue
+			return
 		}
 
 		poolName, propName, propValue := values[0], values[1], values[2]
@@ -69,11 +54,9 @@ func ListPools(name string, cmdProps []string, debug bool) ([]Pool, error) {
 		}
 
 		poolProps[poolName][propName] = propValue
-	}
-
-	err = cmd.Wait()
+	}, "zpool", args...)
 	if err != nil {
-		return nil, fmt.Errorf("zpool wait: %w", err)
+		return nil, fmt.Errorf("zpool get: %w", err)
 	}
 
 	pools := make([]Pool, 0, 1)
@@ -118,9 +118,9 @@ func TestListPools(t *testing.T) {
 
 	for _, testCase := range tests {
 		t.Run(testCase.name, func(t *testing.T) {
-			runZpoolFn = zfstoolstest.MakeFakeCommand(testCase.mockCmdFunc)
+			client := fakeClient(testCase.mockCmdFunc)
 
-			got, err := ListPools(testCase.args.name, testCase.args.cmdProps, testCase.args.debug)
+			got, err := client.ListPools(t.Context(), testCase.args.name, testCase.args.cmdProps, testCase.args.debug)
 			if (err != nil) != testCase.wantErr {
 				t.Errorf("ListPools() error = %v, wantErr %v", err, testCase.wantErr)
 
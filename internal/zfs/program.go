@@ -0,0 +1,268 @@
+package zfs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// probeProgram checks that the channel programs of a pool can create and destroy snapshots, which they can since
+// OpenZFS 0.8
+const probeProgram = `return zfs.check.snapshot ~= nil and zfs.check.destroy ~= nil
+`
+
+// snapshotProgram creates all the snapshots, in one transaction group, or none of them when any of them can't be.
+// Each target is the dataset and the name of the snapshot, and whether its descendants are snapshot too.
+const snapshotProgram = `local targets = {
+%s}
+
+local snapshots = {}
+
+local function add(dataset, name, recursive)
+	table.insert(snapshots, dataset .. "@" .. name)
+	if recursive then
+		for child in zfs.list.children(dataset) do
+			add(child, name, true)
+		end
+	end
+end
+
+for _, target in ipairs(targets) do
+	add(target[1], target[2], target[3])
+end
+
+local failed = {}
+for _, snapshot in ipairs(snapshots) do
+	local err = zfs.check.snapshot(snapshot)
+	if err ~= 0 then
+		failed[snapshot] = err
+	end
+end
+
+if next(failed) == nil then
+	for _, snapshot in ipairs(snapshots) do
+		local err = zfs.sync.snapshot(snapshot)
+		if err ~= 0 then
+			failed[snapshot] = err
+		end
+	end
+end
+
+return {failed = failed}
+`
+
+// destroyProgram destroys, deferred like zfs destroy -d, all the snapshots which can be, in one transaction group
+const destroyProgram = `local snapshots = {
+%s}
+
+local failed = {}
+local destroy = {}
+for _, snapshot in ipairs(snapshots) do
+	local err = zfs.check.destroy{snapshot, defer = true}
+	if err ~= 0 then
+		failed[snapshot] = err
+	else
+		table.insert(destroy, snapshot)
+	end
+end
+
+for _, snapshot in ipairs(destroy) do
+	local err = zfs.sync.destroy{snapshot, defer = true}
+	if err ~= 0 then
+		failed[snapshot] = err
+	end
+end
+
+return {failed = failed}
+`
+
+// programResult is what the snapshot and destroy programs return, the errno of each snapshot which failed
+type programResult struct {
+	Return struct {
+		Failed map[string]int `json:"failed"`
+	} `json:"return"`
+}
+
+// errnoKinds are the well-known errors of the errnos a channel program returns
+var errnoKinds = map[syscall.Errno]error{
+	syscall.EPERM:  ErrPermissionDenied,
+	syscall.EACCES: ErrPermissionDenied,
+	syscall.ENOENT: ErrDoesNotExist,
+	syscall.EBUSY:  ErrDatasetBusy,
+}
+
+// errnoError returns the error for an errno returned by a channel program, matching its well-known error if any
+func errnoError(errno int) error {
+	err := syscall.Errno(errno)
+
+	if kind, ok := errnoKinds[err]; ok {
+		return fmt.Errorf("%w: %w", kind, err)
+	}
+
+	return err
+}
+
+// luaString quotes s as a Lua string. Dataset and snapshot names are printable ASCII, whose Go quoting is also Lua's.
+func luaString(s string) string {
+	return strconv.Quote(s)
+}
+
+// SetChannelPrograms sets whether snapshots are created and expired ones destroyed by channel programs, run with
+// zfs program, on the pools which support them
+func (c *Client) SetChannelPrograms(use bool) {
+	c.channelPrograms = use
+}
+
+// UsesChannelPrograms reports whether the snapshots of pool are created and destroyed by channel programs: when
+// they are turned on with SetChannelPrograms and the pool supports them
+func (c *Client) UsesChannelPrograms(ctx context.Context, pool string, debug bool) bool {
+	return c.channelPrograms && c.HasChannelPrograms(ctx, pool, debug)
+}
+
+// HasChannelPrograms reports whether the channel programs of pool can create and destroy snapshots, by running a
+// read-only one. The answer is cached per pool. A zfs which fails to run it, being too old or not run as root,
+// doesn't support them, while a check which was interrupted is tried again.
+func (c *Client) HasChannelPrograms(ctx context.Context, pool string, debug bool) bool {
+	return c.cachedFeature(poolFeature{pool: pool, feature: "channel programs"}, func() (bool, error) {
+		var result struct {
+			Return bool `json:"return"`
+		}
+
+		err := c.runProgram(ctx, pool, probeProgram, true, false, debug, &result)
+		if ctx.Err() != nil {
+			return false, context.Cause(ctx)
+		}
+
+		return err == nil && result.Return, nil
+	})
+}
+
+// runProgram runs the channel program script on pool, read-only with readOnly, and decodes its JSON output into
+// result. Nothing is run in a dry run.
+func (c *Client) runProgram(ctx context.Context, pool, script string, readOnly, dryRun, debug bool, result any) error {
+	args := []string{"program", "-j"}
+
+	if readOnly {
+		args = append(args, "-n")
+	}
+
+	args = append(args, pool)
+
+	if debug {
+		fmt.Println("zfs", strings.Join(args, " "), "<<EOF") //nolint:forbidigo
+		fmt.Print(script, "EOF\n")                           //nolint:forbidigo
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	file, err := os.CreateTemp("", "zfstools-*.lua")
+	if err != nil {
+		return fmt.Errorf("error writing channel program: %w", err)
+	}
+
+	defer func() { _ = os.Remove(file.Name()) }()
+
+	_, err = file.WriteString(script)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return fmt.Errorf("error writing channel program: %w", err)
+	}
+
+	out, err := c.output(ctx, "zfs", append(args, file.Name())...)
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(out, result)
+	if err != nil {
+		return fmt.Errorf("error decoding channel program output: %w", err)
+	}
+
+	return nil
+}
+
+// createSnapshotsProgram creates the snapshots, all in pool, with one channel program, so that either all of them
+// are taken at once or none of them are
+func (c *Client) createSnapshotsProgram(
+	ctx context.Context,
+	pool string,
+	snaps []string,
+	recursive, dryRun, verbose, debug bool,
+) error {
+	if verbose {
+		fmt.Println("zfs program", pool, "snapshot", strings.Join(snaps, " ")) //nolint:forbidigo
+	}
+
+	var targets strings.Builder
+
+	for _, snap := range snaps {
+		dataset, name, _ := strings.Cut(snap, "@")
+		fmt.Fprintf(&targets, "\t{%s, %s, %t},\n", luaString(dataset), luaString(name), recursive)
+	}
+
+	var result programResult
+
+	err := c.runProgram(ctx, pool, fmt.Sprintf(snapshotProgram, targets.String()), false, dryRun, debug, &result)
+	if err != nil {
+		return &SnapshotError{Err: err, Op: "creating", Snapshots: snaps}
+	}
+
+	if len(result.Return.Failed) == 0 {
+		return nil
+	}
+
+	var errs []error
+
+	for _, snap := range slices.Sorted(maps.Keys(result.Return.Failed)) {
+		errs = append(errs, fmt.Errorf("%s: %w", snap, errnoError(result.Return.Failed[snap])))
+	}
+
+	// none of them were taken
+	return &SnapshotError{Err: errors.Join(errs...), Op: "creating", Snapshots: snaps}
+}
+
+// DestroySnapshotsProgram destroys the snapshots, all in pool, with one channel program. Like DestroySnapshot, a
+// held snapshot is destroyed once it is released. It returns the joined errors of the snapshots which could not be
+// destroyed.
+func (c *Client) DestroySnapshotsProgram(ctx context.Context, pool string, names []string, dryRun, debug bool) error {
+	if len(names) == 0 {
+		return nil
+	}
+
+	c.staleSnapshotSize.Store(true)
+
+	var snapshots strings.Builder
+
+	for _, name := range names {
+		fmt.Fprintf(&snapshots, "\t%s,\n", luaString(name))
+	}
+
+	var result programResult
+
+	err := c.runProgram(ctx, pool, fmt.Sprintf(destroyProgram, snapshots.String()), false, dryRun, debug, &result)
+	if err != nil {
+		return &SnapshotError{Err: err, Op: "destroying", Snapshots: names}
+	}
+
+	var errs []error
+
+	for _, name := range names {
+		if errno, ok := result.Return.Failed[name]; ok {
+			errs = append(errs, &SnapshotError{Err: errnoError(errno), Op: "destroying", Snapshots: []string{name}})
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,196 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+var errNoProgram = errors.New("unrecognized command 'program'")
+
+// programExecutor answers zfs program with probe, when run read-only, or result, and records the scripts it is given.
+// Without a probe it fails, like a zfs without channel programs.
+type programExecutor struct {
+	stubExecutor
+
+	probe   string
+	result  string
+	scripts []string
+}
+
+func (e *programExecutor) Output(_ context.Context, name string, args ...string) ([]byte, error) {
+	e.calls = append(e.calls, append([]string{name}, args...))
+
+	if name != "zfs" || len(args) == 0 || args[0] != "program" {
+		return nil, nil
+	}
+
+	if e.probe == "" {
+		return nil, errNoProgram
+	}
+
+	script, err := os.ReadFile(args[len(args)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	e.scripts = append(e.scripts, string(script))
+
+	if slices.Contains(args, "-n") {
+		return []byte(e.probe), nil
+	}
+
+	return []byte(e.result), nil
+}
+
+// commands returns the commands run by e, without the paths of the scripts given to zfs program
+func (e *programExecutor) commands() [][]string {
+	var commands [][]string
+
+	for _, call := range e.calls {
+		if call[1] == "program" {
+			call = call[:len(call)-1]
+		}
+
+		commands = append(commands, call)
+	}
+
+	return commands
+}
+
+func TestHasChannelPrograms(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		probe string
+		want  bool
+	}{
+		{name: "supported", probe: `{"return": true}`, want: true},
+		{name: "too old", probe: `{"return": false}`},
+		{name: "unsupported"},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			executor := &programExecutor{probe: testCase.probe}
+			client := NewClient(executor)
+
+			for range 2 {
+				if got := client.HasChannelPrograms(t.Context(), "tank", false); got != testCase.want {
+					t.Errorf("HasChannelPrograms() = %v, want %v", got, testCase.want)
+				}
+			}
+
+			want := [][]string{{"zfs", "program", "-j", "-n", "tank"}}
+			if diff := deep.Equal(executor.commands(), want); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestCreateManySnapshots_ChannelProgram(t *testing.T) {
+	t.Parallel()
+
+	datasets := []Dataset{{Name: "tank/a"}, {Name: "tank/b"}}
+
+	tests := []struct {
+		name      string
+		probe     string
+		result    string
+		wantCalls [][]string
+		wantErr   error
+	}{
+		{
+			name:   "created",
+			probe:  `{"return": true}`,
+			result: `{"return": {"failed": {}}}`,
+			wantCalls: [][]string{
+				{"zfs", "program", "-j", "-n", "tank"},
+				{"zfs", "program", "-j", "tank"},
+			},
+		},
+		{
+			name:   "none created",
+			probe:  `{"return": true}`,
+			result: `{"return": {"failed": {"tank/b/child@snap": 16}}}`,
+			wantCalls: [][]string{
+				{"zfs", "program", "-j", "-n", "tank"},
+				{"zfs", "program", "-j", "tank"},
+			},
+			wantErr: ErrDatasetBusy,
+		},
+		{
+			name: "fallback",
+			wantCalls: [][]string{
+				{"zfs", "program", "-j", "-n", "tank"},
+				{"zpool", "get", "-H", "-p", "-o", "name,property,value", "feature@bookmarks", "tank"},
+				{"zfs", "snapshot", "-r", "tank/a@snap"},
+				{"zfs", "snapshot", "-r", "tank/b@snap"},
+			},
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			executor := &programExecutor{probe: testCase.probe, result: testCase.result}
+			client := NewClient(executor)
+			client.SetChannelPrograms(true)
+
+			err := client.CreateManySnapshots(t.Context(), "snap", datasets, true, false, false, false, 1)
+			if !errors.Is(err, testCase.wantErr) {
+				t.Fatalf("CreateManySnapshots() error = %v, want %v", err, testCase.wantErr)
+			}
+
+			var snapErr *SnapshotError
+			if err != nil && (!errors.As(err, &snapErr) || len(snapErr.Snapshots) != 2) {
+				t.Errorf("CreateManySnapshots() error = %v, want both snapshots failed", err)
+			}
+
+			if diff := deep.Equal(executor.commands(), testCase.wantCalls); diff != nil {
+				t.Error(diff)
+			}
+
+			if testCase.probe != "" && !strings.Contains(executor.scripts[1], "\t{\"tank/a\", \"snap\", true},\n"+
+				"\t{\"tank/b\", \"snap\", true},\n}") {
+				t.Errorf("snapshot program doesn't take the targets:\n%s", executor.scripts[1])
+			}
+		})
+	}
+}
+
+func TestDestroySnapshotsProgram(t *testing.T) {
+	t.Parallel()
+
+	executor := &programExecutor{probe: `{"return": true}`, result: `{"return": {"failed": {"tank/a@old": 2}}}`}
+	client := NewClient(executor)
+
+	err := client.DestroySnapshotsProgram(t.Context(), "tank", []string{"tank/a@old", "tank/b@old"}, false, false)
+	if !errors.Is(err, ErrDoesNotExist) {
+		t.Fatalf("DestroySnapshotsProgram() error = %v, want %v", err, ErrDoesNotExist)
+	}
+
+	var snapErr *SnapshotError
+	if !errors.As(err, &snapErr) || !slices.Equal(snapErr.Snapshots, []string{"tank/a@old"}) {
+		t.Errorf("DestroySnapshotsProgram() error = %v, want only tank/a@old failed", err)
+	}
+
+	if !strings.Contains(executor.scripts[0], "\t\"tank/a@old\",\n\t\"tank/b@old\",\n}") {
+		t.Errorf("destroy program doesn't take the snapshots:\n%s", executor.scripts[0])
+	}
+
+	err = client.DestroySnapshotsProgram(t.Context(), "tank", []string{"tank/a@old"}, true, false)
+	if err != nil || len(executor.calls) != 1 {
+		t.Errorf("DestroySnapshotsProgram() ran %v in a dry run, error = %v", executor.calls[1:], err)
+	}
+}
@@ -0,0 +1,131 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrPipeUnsupported = errors.New("executor can't pipe commands")
+
+// Replica is a snapshot with its guid, which is the same wherever the snapshot is received
+type Replica struct {
+	Name string
+	GUID string
+}
+
+// remoteCommand returns the command line running zfs with args through remote, such as "ssh backup", or locally
+// when remote is empty
+func remoteCommand(remote []string, args ...string) []string {
+	return append(append(append([]string{}, remote...), "zfs"), args...)
+}
+
+// runRemote runs zfs with args through remote
+func (c *Client) runRemote(ctx context.Context, remote []string, args ...string) error {
+	command := remoteCommand(remote, args...)
+
+	return c.run(ctx, command[0], command[1:]...)
+}
+
+// ListReplicas returns the snapshots of dataset, through remote, oldest first
+func (c *Client) ListReplicas(ctx context.Context, remote []string, dataset string, debug bool) ([]Replica, error) {
+	command := remoteCommand(remote, "list", "-H", "-p", "-t", "snapshot", "-o", "name,guid", "-s", "createtxg",
+		"-d", "1", dataset)
+
+	if debug {
+		fmt.Println(strings.Join(command, " ")) //nolint:forbidigo
+	}
+
+	var replicas []Replica
+
+	err := c.stream(ctx, func(line string) {
+		name, guid, found := strings.Cut(line, "\t")
+		if found {
+			replicas = append(replicas, Replica{Name: name, GUID: guid})
+		}
+	}, command[0], command[1:]...)
+	if err != nil {
+		return nil, fmt.Errorf("error listing snapshots of %s: %w", dataset, err)
+	}
+
+	return replicas, nil
+}
+
+// CreateParents creates, through remote, the datasets above dataset which don't exist yet
+func (c *Client) CreateParents(ctx context.Context, remote []string, dataset string, dryRun, debug bool) error {
+	parent, _, found := cutLast(dataset, "/")
+	if !found {
+		return nil
+	}
+
+	command := remoteCommand(remote, "create", "-p", parent)
+
+	if debug {
+		fmt.Println(strings.Join(command, " ")) //nolint:forbidigo
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	err := c.run(ctx, command[0], command[1:]...)
+	if err != nil {
+		return fmt.Errorf("error creating %s: %w", parent, err)
+	}
+
+	return nil
+}
+
+// Send sends snapshot, incrementally from base unless it is empty, and receives it as target through remote. The
+// intermediate snapshots are sent too, unless base is a bookmark. The target isn't mounted.
+func (c *Client) Send(
+	ctx context.Context,
+	base, snapshot string,
+	remote []string,
+	target string,
+	dryRun, verbose, debug bool,
+) error {
+	send := []string{"zfs", "send"}
+
+	switch {
+	case strings.Contains(base, "#"):
+		// the snapshots between a bookmark and snapshot can't be sent, only the difference
+		send = append(send, "-i", base)
+	case base != "":
+		send = append(send, "-I", base)
+	}
+
+	send = append(send, snapshot)
+	receive := remoteCommand(remote, "receive", "-u", target)
+
+	if debug || verbose {
+		fmt.Println(strings.Join(send, " "), "|", strings.Join(receive, " ")) //nolint:forbidigo
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	piper, ok := c.executor.(Piper)
+	if !ok {
+		return ErrPipeUnsupported
+	}
+
+	err := piper.Pipe(ctx, send, receive)
+	if err != nil {
+		return fmt.Errorf("error sending %s: %w", snapshot, commandError(err, send[0], send[1:]...))
+	}
+
+	return nil
+}
+
+// cutLast slices s around the last instance of sep
+func cutLast(s, sep string) (string, string, bool) {
+	index := strings.LastIndex(s, sep)
+	if index < 0 {
+		return s, "", false
+	}
+
+	return s[:index], s[index+len(sep):], true
+}
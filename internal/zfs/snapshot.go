@@ -1,39 +1,36 @@
 package zfs
 
 import (
-	"bufio"
+	"context"
 	"errors"
 	"fmt"
+	"maps"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
-var staleSnapshotSize = false
-
 var ErrEmptySnapshotName = errors.New("empty snapshot name")
 
 var ErrInvalidSnapshotName = errors.New("invalid snapshot name")
 
 var ErrNoDatasets = errors.New("no dataset(s) specified")
 
-var ErrOneSnapshotOfManyErrored = errors.New("some snapshots failed to create")
-
 type Snapshot struct {
 	Name string
 	Used int64
 }
 
 // GetUsed returns the used size of the snapshot (refreshes if stale)
-func (s *Snapshot) GetUsed(debug bool) int64 {
-	if s.Used == 0 || staleSnapshotSize {
+func (s *Snapshot) GetUsed(ctx context.Context, client *Client, debug bool) int64 {
+	if s.Used == 0 || client.staleSnapshotSize.Load() {
 		if debug {
 			fmt.Println("zfs get -Hp -o value used", s.Name) //nolint:forbidigo
 		}
 
-		cmd := RunZfsFn("zfs", "get", "-Hp", "-o", "value", "used", s.Name)
-
-		out, err := cmd.Output()
+		out, err := client.output(ctx, "zfs", "get", "-Hp", "-o", "value", "used", s.Name)
 		if err != nil {
 			return 0
 		}
@@ -48,12 +45,31 @@ func (s *Snapshot) GetUsed(debug bool) int64 {
 }
 
 // IsZero reports if the snapshot is effectively empty
-func (s *Snapshot) IsZero(debug bool) bool {
-	return s.GetUsed(debug) == 0
+func (s *Snapshot) IsZero(ctx context.Context, client *Client, debug bool) bool {
+	return s.GetUsed(ctx, client, debug) == 0
+}
+
+// GetCreation returns when the snapshot was created
+func (s *Snapshot) GetCreation(ctx context.Context, client *Client, debug bool) (time.Time, error) {
+	if debug {
+		fmt.Println("zfs get -Hp -o value creation", s.Name) //nolint:forbidigo
+	}
+
+	out, err := client.output(ctx, "zfs", "get", "-Hp", "-o", "value", "creation", s.Name)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error getting creation of %s: %w", s.Name, err)
+	}
+
+	seconds, err := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error getting creation of %s: %w", s.Name, err)
+	}
+
+	return time.Unix(seconds, 0), nil
 }
 
 // ListSnapshots returns all snapshots, optionally recursive
-func ListSnapshots(dataset string, recursive bool, debug bool) ([]Snapshot, error) {
+func (c *Client) ListSnapshots(ctx context.Context, dataset string, recursive bool, debug bool) ([]Snapshot, error) {
 	args := []string{"list"}
 
 	if dataset != "" && !recursive {
@@ -74,43 +90,23 @@ func ListSnapshots(dataset string, recursive bool, debug bool) ([]Snapshot, erro
 		fmt.Println("zfs", strings.Join(args, " ")) //nolint:forbidigo
 	}
 
-	cmd := RunZfsFn("zfs", args...)
-
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return nil, fmt.Errorf("error creating StdoutPipe: %w", err)
-	}
-
-	err = cmd.Start()
-	if err != nil {
-		return nil, fmt.Errorf("error starting command: %w", err)
-	}
-
-	var snapshots []Snapshot
-
-	snapshots = []Snapshot{}
+	snapshots := []Snapshot{}
 
-	scanner := bufio.NewScanner(stdout)
-
-	for scanner.Scan() {
-		parts := strings.Split(scanner.Text(), "\t")
+	err := c.stream(ctx, func(line string) {
+		parts := strings.Split(line, "\t")
 		if len(parts) != 2 {
-			continue
+			return
 		}
 
-		var size int64
-
-		size, err = strconv.ParseInt(parts[1], 10, 64)
+		size, err := strconv.ParseInt(parts[1], 10, 64)
 		if err != nil {
-			continue
+			return
 		}
 
 		snapshots = append(snapshots, Snapshot{Name: parts[0], Used: size})
-	}
-
-	err = cmd.Wait()
+	}, "zfs", args...)
 	if err != nil {
-		return nil, fmt.Errorf("error waiting on command: %w", err)
+		return nil, fmt.Errorf("error listing snapshots: %w", err)
 	}
 
 	return snapshots, nil
@@ -118,7 +114,13 @@ func ListSnapshots(dataset string, recursive bool, debug bool) ([]Snapshot, erro
 
 // CreateSnapshot creates a single snapshot or a group of snapshots. targets is a slice of snapshot
 // names such as "pool/fs@snapname" -- they MUST include the snapshot name
-func CreateSnapshot(targets []string, recursive bool, dbName string, dryRun, verbose, debug bool) error {
+func (c *Client) CreateSnapshot(
+	ctx context.Context,
+	targets []string,
+	recursive bool,
+	dbName string,
+	dryRun, verbose, debug bool,
+) error {
 	if len(targets) < 1 {
 		return ErrEmptySnapshotName
 	}
@@ -129,40 +131,35 @@ func CreateSnapshot(targets []string, recursive bool, dbName string, dryRun, ver
 		}
 	}
 
-	base := []string{"zfs", "snapshot"}
+	args := []string{"snapshot"}
 	if recursive {
-		base = append(base, "-r")
+		args = append(args, "-r")
 	}
 
-	cmdLine := base
-	cmdLine = append(cmdLine, targets...)
-
-	cmdStr := strings.Join(cmdLine, " ")
-
-	switch dbName {
-	case "mysql":
-		sql := fmt.Sprintf(`
-FLUSH LOGS;
-FLUSH TABLES WITH READ LOCK;
-SYSTEM %s;
-UNLOCK TABLES;`, cmdStr)
-		cmdStr = fmt.Sprintf(`mysql -e "%s"`, strings.ReplaceAll(sql, "\n", " "))
-
-	case "postgresql":
-		cmdStr = fmt.Sprintf(`(psql -c "SELECT PG_START_BACKUP('zfs-auto-snapshot');" postgres ; %s ) ; psql -c "SELECT PG_STOP_BACKUP();" postgres`, cmdStr) //nolint:lll
-	}
+	args = append(args, targets...)
 
 	if debug || verbose {
-		fmt.Println(cmdStr) //nolint:forbidigo
+		fmt.Println("zfs", strings.Join(args, " ")) //nolint:forbidigo
 	}
 
-	var err error
+	if dryRun {
+		return nil
+	}
 
-	if !dryRun {
-		err = RunZfsFn("sh", "-c", cmdStr).Run()
+	// the database is made consistent on disk by its coordinator while the snapshots are taken
+	if dbName != "" {
+		err := c.coordinatedSnapshot(ctx, targets, recursive, dbName, debug)
 		if err != nil {
-			return fmt.Errorf("error creating snapshot: %w", err)
+			return &SnapshotError{Err: err, Op: "creating", Snapshots: targets}
 		}
+
+		return nil
+	}
+
+	// zfs is run directly, each snapshot its own argument, so no name is ever split or expanded by a shell
+	err := c.run(ctx, "zfs", args...)
+	if err != nil {
+		return &SnapshotError{Err: err, Op: "creating", Snapshots: targets}
 	}
 
 	return nil
@@ -170,8 +167,9 @@ UNLOCK TABLES;`, cmdStr)
 
 // CreateManySnapshots handles parallel and multi-snapshot creation - datasets is a slice of datasets to snapshot,
 // either recursively or not, with the same snapshot name specified in snapshotName. the dataset.Name MUST NOT
-// include the snapshot name.
-func CreateManySnapshots(snapshotName string, datasets []Dataset, recursive bool, dryRun, verbose, debug, useThreads bool) error { //nolint:lll,gocognit,cyclop,funlen
+// include the snapshot name. Those of pools which can't take several at once are taken parallelism at a time on each
+// pool. Every snapshot is attempted, the errors of those which failed are joined.
+func (c *Client) CreateManySnapshots(ctx context.Context, snapshotName string, datasets []Dataset, recursive bool, dryRun, verbose, debug bool, parallelism int) error { //nolint:lll,cyclop,funlen
 	if snapshotName == "" {
 		return ErrEmptySnapshotName
 	}
@@ -186,123 +184,144 @@ func CreateManySnapshots(snapshotName string, datasets []Dataset, recursive bool
 		}
 	}
 
-	// Split out DB datasets
+	// Split out consistency groups, DB datasets and those with hooks
+	var groups []*snapshotGroup
+
 	var dbDatasets []Dataset
 
 	var regular []Dataset
 
 	for _, ds := range datasets {
-		if ds.DB != "" {
+		switch {
+		case ds.Group != "":
+			groups = addToGroup(groups, ds)
+		case ds.DB != "" || len(ds.Hooks) > 0:
 			dbDatasets = append(dbDatasets, ds)
-		} else {
+		default:
 			regular = append(regular, ds)
 		}
 	}
 
-	if len(dbDatasets) > 0 {
-		_ = CreateManySnapshots(snapshotName, dbDatasets, recursive, dryRun, verbose, debug, useThreads)
-	}
+	var errs []error
 
-	var err error
+	argMax := func() int { return min(c.argMax(ctx), maxArgLen) }
 
-	var atLeastOneErr bool
+	// each group is taken as a whole, before anything else so that those of a group in different pools are as close
+	// together as they can be
+	for _, group := range groups {
+		err := c.createGroupSnapshot(ctx, group, snapshotName, argMax, recursive, dryRun, verbose, debug)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
 
-	// If multi-snapshot is supported, use pooled batching
-	if HasMultiSnap(debug) { //nolint:nestif
-		var snapshots []string
+	// DB datasets need their database locked around the snapshot, and those with hooks their hooks run, so they are
+	// done one at a time
+	for _, ds := range dbDatasets {
+		targets := []string{ds.Name + "@" + snapshotName}
 
-		maxLen := 0
+		err := c.withHooks(ctx, ds.Hooks, targets, snapshotName, dryRun, verbose, debug, func(ctx context.Context) error {
+			return c.CreateSnapshot(ctx, targets, recursive, ds.DB, dryRun, verbose, debug)
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
 
-		for _, ds := range regular {
-			snap := fmt.Sprintf("%s@%s", ds.Name, snapshotName)
+	if len(regular) == 0 {
+		return errors.Join(errs...)
+	}
 
-			snapshots = append(snapshots, snap)
+	// group by pool, a multi-snapshot can't span pools and each pool may or may not support them
+	pools := map[string][]string{}
 
-			if len(snap) > maxLen {
-				maxLen = len(snap)
-			}
-		}
+	for _, ds := range regular {
+		pool := PoolName(ds.Name)
+		pools[pool] = append(pools[pool], ds.Name+"@"+snapshotName)
+	}
 
-		argMax := getArgMax()
-		argMax -= 1024 // safety slack
-		chunkSize := argMax / maxLen
+	var singles []string
 
-		// group by pool
-		pools := make(map[string][]string)
+	for _, pool := range slices.Sorted(maps.Keys(pools)) {
+		if c.UsesChannelPrograms(ctx, pool, debug) {
+			err := c.createSnapshotsProgram(ctx, pool, pools[pool], recursive, dryRun, verbose, debug)
+			if err != nil {
+				errs = append(errs, err)
+			}
 
-		for _, snap := range snapshots {
-			parts := strings.SplitN(snap, "@", 2)
-			pool := strings.SplitN(parts[0], "/", 2)[0]
-			pools[pool] = append(pools[pool], snap)
+			continue
 		}
 
-		for _, snaps := range pools {
-			for index := 0; index < len(snaps); index += chunkSize {
-				end := index + chunkSize
-
-				if end > len(snaps) {
-					end = len(snaps)
-				}
-
-				// continue trying all the snapshots, but note the error
-				err = CreateSnapshot(snaps[index:end], recursive, "", dryRun, verbose, debug)
-				if err != nil {
-					if !atLeastOneErr {
-						atLeastOneErr = true
-					}
-				}
-			}
-		}
+		if !c.HasMultiSnap(ctx, pool, debug) {
+			singles = append(singles, pools[pool]...)
 
-		if atLeastOneErr {
-			return ErrOneSnapshotOfManyErrored
+			continue
 		}
 
-		return nil
+		errs = append(errs, c.createSnapshotBatches(ctx, pools[pool], argMax(), recursive, dryRun, verbose, debug)...)
 	}
 
-	// fallback: serial or threaded single snapshot
-	var waitGroup sync.WaitGroup
+	// fallback, for the pools which can't take several at once: single snapshots, parallelism at a time on each pool
+	var errsMutex sync.Mutex
 
-	for _, ds := range regular {
-		snap := fmt.Sprintf("%s@%s", ds.Name, snapshotName)
-		dbName := ds.DB
+	ForEachInPools(singles, func(name string) string { return name }, parallelism, func(name string) {
+		err := c.CreateSnapshot(ctx, []string{name}, recursive, "", dryRun, verbose, debug)
+		if err != nil {
+			errsMutex.Lock()
+			errs = append(errs, err)
+			errsMutex.Unlock()
+		}
+	})
 
-		waitGroup.Add(1)
+	return errors.Join(errs...)
+}
 
-		go func(name, db string) {
-			defer waitGroup.Done()
+// createSnapshotBatches creates the snapshots, all in one pool, several at a time in batches which fit in argMax,
+// returning the errors of the batches which failed
+func (c *Client) createSnapshotBatches(
+	ctx context.Context,
+	snaps []string,
+	argMax int,
+	recursive, dryRun, verbose, debug bool,
+) []error {
+	maxLen := 0
+
+	for _, snap := range snaps {
+		maxLen = max(maxLen, len(snap))
+	}
 
-			err = CreateSnapshot([]string{name}, recursive, db, dryRun, verbose, debug)
-			if err != nil {
-				if !atLeastOneErr {
-					atLeastOneErr = true
-				}
-			}
-		}(snap, dbName)
+	chunkSize := max(argMax/maxLen, 1)
 
-		if !useThreads {
-			waitGroup.Wait()
+	var errs []error
+
+	for chunk := range slices.Chunk(snaps, chunkSize) {
+		// continue trying all the snapshots, but note the error
+		err := c.CreateSnapshot(ctx, chunk, recursive, "", dryRun, verbose, debug)
+		if err != nil {
+			errs = append(errs, err)
 		}
 	}
 
-	waitGroup.Wait()
+	return errs
+}
 
-	if atLeastOneErr {
-		return ErrOneSnapshotOfManyErrored
-	}
+// argMax returns how long the arguments of a command may be, getting ARG_MAX the first time it is called
+func (c *Client) argMax(ctx context.Context) int {
+	c.commandArgMaxOnce.Do(func() {
+		c.commandArgMax = c.getArgMax(ctx) - 1024 // safety slack
+	})
 
-	return nil
+	return c.commandArgMax
 }
 
-func getArgMax() int {
+func (c *Client) getArgMax(ctx context.Context) int {
 	var err error
 
 	var out []byte
 
 	var val int64
 
-	out, err = RunZfsFn("getconf", "ARG_MAX").Output()
+	out, err = c.output(ctx, "getconf", "ARG_MAX")
 	if err != nil {
 		return 4096 // conservative fallback
 	}
@@ -316,8 +335,8 @@ func getArgMax() int {
 }
 
 // DestroySnapshot deletes a snapshot (and marks usage as stale)
-func DestroySnapshot(name string, dryRun, debug bool) error {
-	staleSnapshotSize = true
+func (c *Client) DestroySnapshot(ctx context.Context, name string, dryRun, debug bool) error {
+	c.staleSnapshotSize.Store(true)
 	args := []string{"destroy", "-d"}
 
 	args = append(args, name)
@@ -329,11 +348,132 @@ func DestroySnapshot(name string, dryRun, debug bool) error {
 	var err error
 
 	if !dryRun {
-		err = RunZfsFn("zfs", args...).Run()
+		err = c.run(ctx, "zfs", args...)
 		if err != nil {
-			return fmt.Errorf("error creating snapshot: %w", err)
+			// zfs says a held snapshot is busy, tell the two apart
+			var cmdErr *CommandError
+			if errors.As(err, &cmdErr) && cmdErr.Kind == ErrDatasetBusy && c.isHeld(ctx, name) { //nolint:errorlint
+				cmdErr.Kind = ErrHeld
+			}
+
+			return &SnapshotError{Err: err, Op: "destroying", Snapshots: []string{name}}
 		}
 	}
 
 	return nil
 }
+
+// maxArgLen is the longest single argument Linux passes to a command (MAX_ARG_STRLEN), less its terminating NUL. The
+// snapshots of a batch destroy are all in one argument, and the batches and consistency groups of snapshots created
+// together are kept within it too.
+const maxArgLen = 128*1024 - 1
+
+// DestroySnapshots deletes the snapshots, naming those of the same dataset which follow each other together as in
+// zfs destroy -d pool/fs@a,b,c, in batches which fit in ARG_MAX. Like DestroySnapshot, a held snapshot is destroyed
+// once it is released. zfs destroys a batch as a whole or not at all, so the snapshots of one which fails are tried
+// again one at a time to tell which of them can't be destroyed, and the joined errors of those are returned. Pools
+// without multi-snapshot support get one zfs destroy per snapshot.
+func (c *Client) DestroySnapshots(ctx context.Context, names []string, dryRun, debug bool) error {
+	if len(names) == 0 {
+		return nil
+	}
+
+	var errs []error
+
+	if len(names) == 1 || !c.HasMultiSnap(ctx, PoolName(names[0]), debug) {
+		for _, name := range names {
+			errs = append(errs, c.DestroySnapshot(ctx, name, dryRun, debug))
+		}
+
+		return errors.Join(errs...)
+	}
+
+	for _, batch := range destroyBatches(names, min(c.argMax(ctx), maxArgLen)) {
+		if len(batch) == 1 {
+			errs = append(errs, c.DestroySnapshot(ctx, batch[0], dryRun, debug))
+
+			continue
+		}
+
+		err := c.destroySnapshotBatch(ctx, batch, dryRun, debug)
+		if err == nil {
+			continue
+		}
+
+		// once interrupted there is no point in trying them one at a time
+		if ctx.Err() != nil {
+			errs = append(errs, &SnapshotError{Err: err, Op: "destroying", Snapshots: batch})
+
+			continue
+		}
+
+		for _, name := range batch {
+			errs = append(errs, c.DestroySnapshot(ctx, name, dryRun, debug))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// destroyBatches splits the snapshots into batches of the same dataset, each of which named as dataset@a,b,c is no
+// longer than argMax
+func destroyBatches(names []string, argMax int) [][]string {
+	var batches [][]string
+
+	var dataset string
+
+	length := 0
+
+	for _, name := range names {
+		nameDataset, snapshot, _ := strings.Cut(name, "@")
+
+		if len(batches) == 0 || nameDataset != dataset || length+1+len(snapshot) > argMax {
+			batches = append(batches, nil)
+			dataset = nameDataset
+			length = len(name)
+		} else {
+			length += 1 + len(snapshot)
+		}
+
+		batches[len(batches)-1] = append(batches[len(batches)-1], name)
+	}
+
+	return batches
+}
+
+// destroySnapshotBatch destroys the snapshots, all of the same dataset, with one zfs destroy
+func (c *Client) destroySnapshotBatch(ctx context.Context, batch []string, dryRun, debug bool) error {
+	c.staleSnapshotSize.Store(true)
+
+	dataset, _, _ := strings.Cut(batch[0], "@")
+	snapshots := make([]string, 0, len(batch))
+
+	for _, name := range batch {
+		_, snapshot, _ := strings.Cut(name, "@")
+		snapshots = append(snapshots, snapshot)
+	}
+
+	args := []string{"destroy", "-d", dataset + "@" + strings.Join(snapshots, ",")}
+
+	if debug {
+		fmt.Println("zfs", strings.Join(args, " ")) //nolint:forbidigo
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	return c.run(ctx, "zfs", args...)
+}
+
+// isHeld reports whether the snapshot has any user holds
+func (c *Client) isHeld(ctx context.Context, name string) bool {
+	out, err := c.output(ctx, "zfs", "get", "-Hp", "-o", "value", "userrefs", name)
+	if err != nil {
+		return false
+	}
+
+	refs, err := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+
+	return err == nil && refs > 0
+}
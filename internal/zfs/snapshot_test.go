@@ -1,8 +1,10 @@
 package zfs
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/go-test/deep"
@@ -53,15 +55,15 @@ func TestSnapshot_GetUsed(t *testing.T) {
 
 	for _, testCase := range tests {
 		t.Run(testCase.name, func(t *testing.T) {
-			staleSnapshotSize = testCase.stale
-			RunZfsFn = zfstoolstest.MakeFakeCommand(testCase.mockCmdFunc)
+			client := fakeClient(testCase.mockCmdFunc)
+			client.staleSnapshotSize.Store(testCase.stale)
 
 			s := &Snapshot{
 				Name: testCase.fields.Name,
 				Used: testCase.fields.Used,
 			}
 
-			got := s.GetUsed(testCase.args.debug)
+			got := s.GetUsed(t.Context(), client, testCase.args.debug)
 			if got != testCase.want {
 				t.Errorf("GetUsed() = %v, want %v", got, testCase.want)
 			}
@@ -111,15 +113,14 @@ func TestSnapshot_IsZero(t *testing.T) {
 
 	for _, testCase := range tests {
 		t.Run(testCase.name, func(t *testing.T) {
-			staleSnapshotSize = false
-			RunZfsFn = zfstoolstest.MakeFakeCommand(testCase.mockCmdFunc)
+			client := fakeClient(testCase.mockCmdFunc)
 
 			s := &Snapshot{
 				Name: testCase.fields.Name,
 				Used: testCase.fields.Used,
 			}
 
-			got := s.IsZero(testCase.args.debug)
+			got := s.IsZero(t.Context(), client, testCase.args.debug)
 			if got != testCase.want {
 				t.Errorf("IsZero() = %v, want %v", got, testCase.want)
 			}
@@ -265,9 +266,9 @@ func TestListSnapshots(t *testing.T) {
 
 	for _, testCase := range tests {
 		t.Run(testCase.name, func(t *testing.T) {
-			RunZfsFn = zfstoolstest.MakeFakeCommand(testCase.mockCmdFunc)
+			client := fakeClient(testCase.mockCmdFunc)
 
-			got, err := ListSnapshots(testCase.args.dataset, testCase.args.recursive, testCase.args.debug)
+			got, err := client.ListSnapshots(t.Context(), testCase.args.dataset, testCase.args.recursive, testCase.args.debug)
 
 			if (err != nil) != testCase.wantErr {
 				t.Errorf("ListSnapshots() error = %v, wantErr %v", err, testCase.wantErr)
@@ -392,8 +393,8 @@ func TestCreateSnapshot(t *testing.T) {
 			wantErr: false,
 		},
 		{
-			name:        "mySQLsingle",
-			mockCmdFunc: "TestCreateSnapshot_mySQLsingle",
+			name:        "mySQLwithoutCoordinator",
+			mockCmdFunc: "TestCreateSnapshot_none", // shouldn't be called
 			args: args{
 				targets:   []string{"pool/fs@snap"},
 				recursive: false,
@@ -402,11 +403,11 @@ func TestCreateSnapshot(t *testing.T) {
 				verbose:   false,
 				debug:     false,
 			},
-			wantErr: false,
+			wantErr: true,
 		},
 		{
-			name:        "postgreSQLsingle",
-			mockCmdFunc: "TestCreateSnapshot_postgreSQLsingle",
+			name:        "postgreSQLwithoutCoordinator",
+			mockCmdFunc: "TestCreateSnapshot_none", // shouldn't be called
 			args: args{
 				targets:   []string{"pool/fs@snap"},
 				recursive: false,
@@ -415,7 +416,7 @@ func TestCreateSnapshot(t *testing.T) {
 				verbose:   false,
 				debug:     false,
 			},
-			wantErr: false,
+			wantErr: true,
 		},
 		{
 			name:        "dryRun",
@@ -447,9 +448,9 @@ func TestCreateSnapshot(t *testing.T) {
 
 	for _, testCase := range tests {
 		t.Run(testCase.name, func(t *testing.T) {
-			RunZfsFn = zfstoolstest.MakeFakeCommand(testCase.mockCmdFunc)
+			client := fakeClient(testCase.mockCmdFunc)
 
-			err := CreateSnapshot(testCase.args.targets, testCase.args.recursive, testCase.args.dbName,
+			err := client.CreateSnapshot(t.Context(), testCase.args.targets, testCase.args.recursive, testCase.args.dbName,
 				testCase.args.dryRun, testCase.args.verbose, testCase.args.debug)
 
 			if (err != nil) != testCase.wantErr {
@@ -470,7 +471,7 @@ func TestCreateManySnapshots(t *testing.T) {
 		dryRun       bool
 		verbose      bool
 		debug        bool
-		useThreads   bool
+		parallelism  int
 	}
 
 	tests := []struct {
@@ -489,11 +490,10 @@ func TestCreateManySnapshots(t *testing.T) {
 					{Name: "pool/fs1"},
 					{Name: "pool/fs2"},
 				},
-				recursive:  false,
-				dryRun:     false,
-				verbose:    false,
-				debug:      false,
-				useThreads: false,
+				recursive: false,
+				dryRun:    false,
+				verbose:   false,
+				debug:     false,
 			},
 			wantErr: true,
 		},
@@ -507,7 +507,6 @@ func TestCreateManySnapshots(t *testing.T) {
 				dryRun:       false,
 				verbose:      false,
 				debug:        false,
-				useThreads:   false,
 			},
 			wantErr: true,
 		},
@@ -520,11 +519,10 @@ func TestCreateManySnapshots(t *testing.T) {
 					{Name: "pool/fs1"},
 					{Name: ""},
 				},
-				recursive:  false,
-				dryRun:     false,
-				verbose:    false,
-				debug:      false,
-				useThreads: false,
+				recursive: false,
+				dryRun:    false,
+				verbose:   false,
+				debug:     false,
 			},
 			wantErr: true,
 		},
@@ -537,11 +535,10 @@ func TestCreateManySnapshots(t *testing.T) {
 					{Name: "pool/fs1"},
 					{Name: "pool/fs2@snapname"},
 				},
-				recursive:  false,
-				dryRun:     false,
-				verbose:    false,
-				debug:      false,
-				useThreads: false,
+				recursive: false,
+				dryRun:    false,
+				verbose:   false,
+				debug:     false,
 			},
 			wantErr: true,
 		},
@@ -555,11 +552,10 @@ func TestCreateManySnapshots(t *testing.T) {
 					{Name: "pool/fs1"},
 					{Name: "pool/fs2"},
 				},
-				recursive:  false,
-				dryRun:     false,
-				verbose:    false,
-				debug:      false,
-				useThreads: false,
+				recursive: false,
+				dryRun:    false,
+				verbose:   false,
+				debug:     false,
 			},
 			wantErr: false,
 		},
@@ -573,11 +569,10 @@ func TestCreateManySnapshots(t *testing.T) {
 					{Name: "pool/fs1"},
 					{Name: "pool/fs2"},
 				},
-				recursive:  false,
-				dryRun:     false,
-				verbose:    false,
-				debug:      false,
-				useThreads: false,
+				recursive: false,
+				dryRun:    false,
+				verbose:   false,
+				debug:     false,
 			},
 			wantErr: false,
 		},
@@ -591,11 +586,10 @@ func TestCreateManySnapshots(t *testing.T) {
 					{Name: "pool/fs1"},
 					{Name: "pool/fs2"},
 				},
-				recursive:  false,
-				dryRun:     false,
-				verbose:    false,
-				debug:      false,
-				useThreads: false,
+				recursive: false,
+				dryRun:    false,
+				verbose:   false,
+				debug:     false,
 			},
 			wantErr: true,
 		},
@@ -609,35 +603,25 @@ func TestCreateManySnapshots(t *testing.T) {
 					{Name: "pool/fs1"},
 					{Name: "pool/fs2"},
 				},
-				recursive:  false,
-				dryRun:     false,
-				verbose:    false,
-				debug:      false,
-				useThreads: false,
+				recursive: false,
+				dryRun:    false,
+				verbose:   false,
+				debug:     false,
 			},
 			wantErr: true,
 		},
 	}
 
 	for _, testCase := range tests {
-		RunZfsFn = zfstoolstest.MakeFakeCommand(testCase.mockCmdFunc)
-		// ensure we control for bookmark feature support detection
-		runZpoolFn = zfstoolstest.MakeFakeCommand(testCase.mockCmdFunc)
-
 		t.Run(testCase.name, func(t *testing.T) {
-			// bookmark/multisnap support may have been detected already (on or off), but make sure we force it to
-			// what we need for this test case
-			if testCase.bookmarks {
-				haveBookmarks = true
-				haveMultiSnap = true
-			} else {
-				haveBookmarks = false
-				haveMultiSnap = false
-			}
+			client := fakeClient(testCase.mockCmdFunc)
+
+			// force bookmark/multisnap support to what we need for this test case
+			client.features = map[poolFeature]bool{{pool: "pool", feature: "bookmarks"}: testCase.bookmarks}
 
-			err := CreateManySnapshots(testCase.args.snapshotName, testCase.args.datasets,
+			err := client.CreateManySnapshots(t.Context(), testCase.args.snapshotName, testCase.args.datasets,
 				testCase.args.recursive, testCase.args.dryRun, testCase.args.verbose,
-				testCase.args.debug, testCase.args.useThreads)
+				testCase.args.debug, testCase.args.parallelism)
 
 			if (err != nil) != testCase.wantErr {
 				t.Errorf("CreateManySnapshots() error = %v, wantErr %v", err, testCase.wantErr)
@@ -673,10 +657,10 @@ func Test_getArgMax(t *testing.T) {
 	}
 
 	for _, testCase := range tests {
-		RunZfsFn = zfstoolstest.MakeFakeCommand(testCase.mockCmdFunc)
-
 		t.Run(testCase.name, func(t *testing.T) {
-			got := getArgMax()
+			client := fakeClient(testCase.mockCmdFunc)
+
+			got := client.getArgMax(t.Context())
 			if got != testCase.want {
 				t.Errorf("getArgMax() = %v, want %v", got, testCase.want)
 			}
@@ -732,21 +716,122 @@ func TestDestroySnapshot(t *testing.T) {
 
 	for _, testCase := range tests {
 		t.Run(testCase.name, func(t *testing.T) {
-			staleSnapshotSize = false
-			RunZfsFn = zfstoolstest.MakeFakeCommand(testCase.mockCmdFunc)
+			client := fakeClient(testCase.mockCmdFunc)
 
-			err := DestroySnapshot(testCase.args.name, testCase.args.dryRun, testCase.args.debug)
+			err := client.DestroySnapshot(t.Context(), testCase.args.name, testCase.args.dryRun, testCase.args.debug)
 			if (err != nil) != testCase.wantErr {
 				t.Errorf("DestroySnapshot() error = %v, wantErr %v", err, testCase.wantErr)
 			}
 
-			if staleSnapshotSize != true {
+			if !client.staleSnapshotSize.Load() {
 				t.Errorf("staleSnapshotSize not updated")
 			}
 		})
 	}
 }
 
+func TestDestroySnapshots(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		names        []string
+		features     string
+		fail         []string
+		dryRun       bool
+		wantDestroys []string
+		wantFailed   []string
+	}{
+		{
+			name:     "batched per dataset",
+			names:    []string{"tank/a@3", "tank/a@2", "tank/a@1", "tank/b@1"},
+			features: "tank\tfeature@bookmarks\tenabled\n",
+			wantDestroys: []string{
+				"zfs destroy -d tank/a@3,2,1",
+				"zfs destroy -d tank/b@1",
+			},
+		},
+		{
+			name:     "failed batch",
+			names:    []string{"tank/a@2", "tank/a@1"},
+			features: "tank\tfeature@bookmarks\tenabled\n",
+			fail:     []string{"zfs destroy -d tank/a@2,1", "zfs destroy -d tank/a@1"},
+			wantDestroys: []string{
+				"zfs destroy -d tank/a@2,1",
+				"zfs destroy -d tank/a@2",
+				"zfs destroy -d tank/a@1",
+			},
+			wantFailed: []string{"tank/a@1"},
+		},
+		{
+			name:  "without multi-snapshot support",
+			names: []string{"tank/a@2", "tank/a@1"},
+			wantDestroys: []string{
+				"zfs destroy -d tank/a@2",
+				"zfs destroy -d tank/a@1",
+			},
+		},
+		{
+			name:     "dry run",
+			names:    []string{"tank/a@2", "tank/a@1"},
+			features: "tank\tfeature@bookmarks\tenabled\n",
+			dryRun:   true,
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			executor := &scriptedExecutor{stubExecutor: stubExecutor{output: testCase.features}, fail: testCase.fail}
+			client := NewClient(executor)
+
+			err := client.DestroySnapshots(t.Context(), testCase.names, testCase.dryRun, false)
+
+			var failed []string
+
+			var snapErr *SnapshotError
+			if errors.As(err, &snapErr) {
+				failed = snapErr.Snapshots
+			}
+
+			if diff := deep.Equal(failed, testCase.wantFailed); diff != nil {
+				t.Errorf("DestroySnapshots() error = %v: %v", err, diff)
+			}
+
+			var destroys []string
+
+			for _, call := range executor.calls {
+				if call[0] == "zfs" && call[1] == "destroy" {
+					destroys = append(destroys, strings.Join(call, " "))
+				}
+			}
+
+			if diff := deep.Equal(destroys, testCase.wantDestroys); diff != nil {
+				t.Error(diff)
+			}
+
+			if !client.staleSnapshotSize.Load() && !testCase.dryRun {
+				t.Errorf("staleSnapshotSize not updated")
+			}
+		})
+	}
+}
+
+func Test_destroyBatches(t *testing.T) {
+	t.Parallel()
+
+	names := []string{"tank/a@1", "tank/a@2", "tank/a@3", "tank/b@1", "tank/a@4"}
+
+	// tank/a@1,2 is 10 long
+	got := destroyBatches(names, 10)
+	want := [][]string{{"tank/a@1", "tank/a@2"}, {"tank/a@3"}, {"tank/b@1"}, {"tank/a@4"}}
+
+	if diff := deep.Equal(got, want); diff != nil {
+		t.Error(diff)
+	}
+}
+
 // test helpers from here down
 
 //nolint:paralleltest
@@ -1103,9 +1188,9 @@ func TestCreateSnapshot_single(_ *testing.T) {
 	cmdWithArgs := os.Args[3:]
 
 	expectedCmdWithArgs := []string{
-		"sh",
-		"-c",
-		"zfs snapshot pool/fs@snap",
+		"zfs",
+		"snapshot",
+		"pool/fs@snap",
 	}
 
 	if deep.Equal(cmdWithArgs, expectedCmdWithArgs) != nil {
@@ -1124,9 +1209,10 @@ func TestCreateSnapshot_multiple(_ *testing.T) {
 	cmdWithArgs := os.Args[3:]
 
 	expectedCmdWithArgs := []string{
-		"sh",
-		"-c",
-		"zfs snapshot pool/fs1@snap pool1/fs2@snap",
+		"zfs",
+		"snapshot",
+		"pool/fs1@snap",
+		"pool1/fs2@snap",
 	}
 
 	if deep.Equal(cmdWithArgs, expectedCmdWithArgs) != nil {
@@ -1145,9 +1231,10 @@ func TestCreateSnapshot_singleRecursive(_ *testing.T) {
 	cmdWithArgs := os.Args[3:]
 
 	expectedCmdWithArgs := []string{
-		"sh",
-		"-c",
-		"zfs snapshot -r pool/fs@snap",
+		"zfs",
+		"snapshot",
+		"-r",
+		"pool/fs@snap",
 	}
 
 	if deep.Equal(cmdWithArgs, expectedCmdWithArgs) != nil {
@@ -1166,51 +1253,11 @@ func TestCreateSnapshot_multipleRecursive(_ *testing.T) {
 	cmdWithArgs := os.Args[3:]
 
 	expectedCmdWithArgs := []string{
-		"sh",
-		"-c",
-		"zfs snapshot -r pool/fs1@snap pool1/fs2@snap",
-	}
-
-	if deep.Equal(cmdWithArgs, expectedCmdWithArgs) != nil {
-		os.Exit(1)
-	}
-
-	os.Exit(0)
-}
-
-//nolint:paralleltest
-func TestCreateSnapshot_mySQLsingle(_ *testing.T) {
-	if !zfstoolstest.IsTestEnv() {
-		return
-	}
-
-	cmdWithArgs := os.Args[3:]
-
-	expectedCmdWithArgs := []string{
-		"sh",
-		"-c",
-		"mysql -e \" FLUSH LOGS; FLUSH TABLES WITH READ LOCK; SYSTEM zfs snapshot pool/fs@snap; UNLOCK TABLES;\"",
-	}
-
-	if deep.Equal(cmdWithArgs, expectedCmdWithArgs) != nil {
-		os.Exit(1)
-	}
-
-	os.Exit(0)
-}
-
-//nolint:paralleltest
-func TestCreateSnapshot_postgreSQLsingle(_ *testing.T) {
-	if !zfstoolstest.IsTestEnv() {
-		return
-	}
-
-	cmdWithArgs := os.Args[3:]
-
-	expectedCmdWithArgs := []string{
-		"sh",
-		"-c",
-		"(psql -c \"SELECT PG_START_BACKUP('zfs-auto-snapshot');\" postgres ; zfs snapshot pool/fs@snap ) ; psql -c \"SELECT PG_STOP_BACKUP();\" postgres", //nolint:lll
+		"zfs",
+		"snapshot",
+		"-r",
+		"pool/fs1@snap",
+		"pool1/fs2@snap",
 	}
 
 	if deep.Equal(cmdWithArgs, expectedCmdWithArgs) != nil {
@@ -1246,9 +1293,10 @@ func TestCreateManySnapshots_simpleWithBookmarks(_ *testing.T) {
 	}
 
 	expectedCmdWithArgs := []string{
-		"sh",
-		"-c",
-		"zfs snapshot pool/fs1@auto-2025-01-01 pool/fs2@auto-2025-01-01",
+		"zfs",
+		"snapshot",
+		"pool/fs1@auto-2025-01-01",
+		"pool/fs2@auto-2025-01-01",
 	}
 
 	if deep.Equal(cmdWithArgs, expectedCmdWithArgs) != nil {
@@ -1274,15 +1322,15 @@ func TestCreateManySnapshots_simpleWithoutBookmarks(_ *testing.T) {
 	}
 
 	expectedFirstCmdWithArgs := []string{
-		"sh",
-		"-c",
-		"zfs snapshot pool/fs1@auto-2025-01-01",
+		"zfs",
+		"snapshot",
+		"pool/fs1@auto-2025-01-01",
 	}
 
 	expectedSecondCmdWithArgs := []string{
-		"sh",
-		"-c",
-		"zfs snapshot pool/fs2@auto-2025-01-01",
+		"zfs",
+		"snapshot",
+		"pool/fs2@auto-2025-01-01",
 	}
 
 	if deep.Equal(cmdWithArgs, expectedFirstCmdWithArgs) == nil ||
@@ -1310,9 +1358,10 @@ func TestCreateManySnapshots_oneSnapshotOfManyErroredWithBookmarks(_ *testing.T)
 	}
 
 	expectedCmdWithArgs := []string{
-		"sh",
-		"-c",
-		"zfs snapshot pool/fs1@auto-2025-01-01 pool/fs2@auto-2025-01-01",
+		"zfs",
+		"snapshot",
+		"pool/fs1@auto-2025-01-01",
+		"pool/fs2@auto-2025-01-01",
 	}
 
 	if deep.Equal(cmdWithArgs, expectedCmdWithArgs) != nil {
@@ -1338,16 +1387,16 @@ func TestCreateManySnapshots_oneSnapshotOfManyErroredWithoutBookmarks(_ *testing
 	}
 
 	expectedFirstCmdWithArgs := []string{
-		"sh",
-		"-c",
-		"zfs snapshot pool/fs1@auto-2025-01-01",
+		"zfs",
+		"snapshot",
+		"pool/fs1@auto-2025-01-01",
 	}
 
 	if deep.Equal(cmdWithArgs, expectedFirstCmdWithArgs) == nil {
 		os.Exit(0)
 	}
 
-	// second command will be `sh -c zfs snapshot pool/fs2@auto-2025-01-01`, which we let fail
+	// second command will be `zfs snapshot pool/fs2@auto-2025-01-01`, which we let fail
 
 	os.Exit(1)
 }
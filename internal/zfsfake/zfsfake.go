@@ -0,0 +1,1084 @@
+// Package zfsfake is an in-memory, stateful stand-in for the zfs and zpool commands. A *ZFS satisfies the
+// zfs.Executor interface, so a zfs.Client can be pointed at it for tests or to simulate a run.
+package zfsfake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrUnsupported = errors.New("unsupported command")
+
+// ExitError is returned for a command which failed, Stderr is what zfs would have printed
+type ExitError struct {
+	Stderr string
+}
+
+func (e *ExitError) Error() string {
+	return e.Stderr
+}
+
+func failf(format string, args ...any) error {
+	return &ExitError{Stderr: fmt.Sprintf(format, args...)}
+}
+
+type pool struct {
+	properties map[string]string
+}
+
+type dataset struct {
+	properties map[string]string
+	name       string
+	kind       string
+	creation   int64
+}
+
+type snapshot struct {
+	holds map[string]bool
+	// properties are the user properties set on the snapshot itself
+	properties   map[string]string
+	name         string
+	used         int64
+	createTxg    int64
+	creation     int64
+	guid         int64
+	deferDestroy bool
+}
+
+// ZFS holds the state of the fake pools, datasets and snapshots
+type ZFS struct {
+	pools     map[string]*pool
+	datasets  map[string]*dataset
+	snapshots map[string]*snapshot
+	// bookmarks keep the createtxg, creation and guid of the snapshot they were made from
+	bookmarks map[string]*snapshot
+	now       func() time.Time
+	commands  [][]string
+	txg       int64
+	guid      int64
+	argMax    int
+	mu        sync.Mutex
+}
+
+// New returns an empty fake
+func New() *ZFS {
+	return &ZFS{
+		pools:     map[string]*pool{},
+		datasets:  map[string]*dataset{},
+		snapshots: map[string]*snapshot{},
+		bookmarks: map[string]*snapshot{},
+		now:       time.Now,
+		argMax:    262144,
+	}
+}
+
+// SetClock sets the function used to stamp the creation time of new datasets and snapshots
+func (z *ZFS) SetClock(now func() time.Time) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	z.now = now
+}
+
+// SetArgMax sets the value reported by "getconf ARG_MAX"
+func (z *ZFS) SetArgMax(argMax int) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	z.argMax = argMax
+}
+
+// AddPool adds a pool, and its root filesystem, with the named features active
+func (z *ZFS) AddPool(name string, features ...string) error {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	if _, ok := z.pools[name]; ok {
+		return failf("cannot create '%s': pool already exists", name)
+	}
+
+	props := map[string]string{"health": "ONLINE"}
+	for _, feature := range features {
+		props["feature@"+feature] = "active"
+	}
+
+	z.pools[name] = &pool{properties: props}
+	z.datasets[name] = &dataset{
+		name:       name,
+		kind:       "filesystem",
+		properties: map[string]string{"mounted": "yes"},
+		creation:   z.now().Unix(),
+	}
+
+	return nil
+}
+
+// SetPoolProperty sets (or with an empty value, removes) a pool property such as "feature@bookmarks"
+func (z *ZFS) SetPoolProperty(name, property, value string) error {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	p, ok := z.pools[name]
+	if !ok {
+		return failf("cannot open '%s': no such pool", name)
+	}
+
+	if value == "" {
+		delete(p.properties, property)
+	} else {
+		p.properties[property] = value
+	}
+
+	return nil
+}
+
+// AddFilesystem adds a mounted filesystem with the given local properties, its parent must exist
+func (z *ZFS) AddFilesystem(name string, properties map[string]string) error {
+	return z.addDataset(name, "filesystem", properties)
+}
+
+// AddVolume adds a volume with the given local properties, its parent must exist
+func (z *ZFS) AddVolume(name string, properties map[string]string) error {
+	return z.addDataset(name, "volume", properties)
+}
+
+func (z *ZFS) addDataset(name, kind string, properties map[string]string) error {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	if _, ok := z.datasets[name]; ok {
+		return failf("cannot create '%s': dataset already exists", name)
+	}
+
+	if !strings.Contains(name, "/") || strings.Contains(name, "@") {
+		return failf("cannot create '%s': invalid dataset name", name)
+	}
+
+	parent := name[:strings.LastIndex(name, "/")]
+	if _, ok := z.datasets[parent]; !ok {
+		return failf("cannot create '%s': parent does not exist", name)
+	}
+
+	props := map[string]string{}
+	if kind == "filesystem" {
+		props["mounted"] = "yes"
+	}
+
+	maps.Copy(props, properties)
+
+	z.datasets[name] = &dataset{name: name, kind: kind, properties: props, creation: z.now().Unix()}
+
+	return nil
+}
+
+// SetProperty sets a local property on a dataset or snapshot, an empty value clears it (like zfs inherit)
+func (z *ZFS) SetProperty(name, property, value string) error {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	ds, ok := z.datasets[name]
+	if !ok {
+		return failf("cannot open '%s': dataset does not exist", name)
+	}
+
+	if value == "" {
+		delete(ds.properties, property)
+	} else {
+		ds.properties[property] = value
+	}
+
+	return nil
+}
+
+// AddSnapshot adds an existing snapshot with the given used size
+func (z *ZFS) AddSnapshot(name string, used int64) error {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	err := z.createSnapshots([]string{name}, false)
+	if err != nil {
+		return err
+	}
+
+	z.snapshots[name].used = used
+
+	return nil
+}
+
+// SetUsed sets the used size of a snapshot
+func (z *ZFS) SetUsed(name string, used int64) error {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	snap, ok := z.snapshots[name]
+	if !ok {
+		return failf("cannot open '%s': dataset does not exist", name)
+	}
+
+	snap.used = used
+
+	return nil
+}
+
+// Write simulates writing to a dataset: the overwritten blocks become unique to its newest snapshot, whose
+// used size grows by size
+func (z *ZFS) Write(name string, size int64) error {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	if _, ok := z.datasets[name]; !ok {
+		return failf("cannot open '%s': dataset does not exist", name)
+	}
+
+	snaps := z.snapshotsOf(name)
+	if len(snaps) > 0 {
+		snaps[len(snaps)-1].used += size
+	}
+
+	return nil
+}
+
+// Hold places a hold with tag on a snapshot
+func (z *ZFS) Hold(name, tag string) error {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	return z.hold(name, tag)
+}
+
+func (z *ZFS) hold(name, tag string) error {
+	snap, ok := z.snapshots[name]
+	if !ok {
+		return failf("cannot hold snapshot '%s': dataset does not exist", name)
+	}
+
+	if snap.holds[tag] {
+		return failf("cannot hold snapshot '%s': tag already exists on this dataset", name)
+	}
+
+	snap.holds[tag] = true
+
+	return nil
+}
+
+// Release removes the hold tag from a snapshot, destroying it if a deferred destroy was pending
+func (z *ZFS) Release(name, tag string) error {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	return z.release(name, tag)
+}
+
+func (z *ZFS) release(name, tag string) error {
+	snap, ok := z.snapshots[name]
+	if !ok || !snap.holds[tag] {
+		return failf("cannot release hold from snapshot '%s': no such tag on this dataset", name)
+	}
+
+	delete(snap.holds, tag)
+
+	if snap.deferDestroy && len(snap.holds) == 0 {
+		delete(z.snapshots, name)
+	}
+
+	return nil
+}
+
+// Exists reports whether the named dataset, snapshot or bookmark exists
+func (z *ZFS) Exists(name string) bool {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	_, isDataset := z.datasets[name]
+	_, isSnapshot := z.snapshots[name]
+	_, isBookmark := z.bookmarks[name]
+
+	return isDataset || isSnapshot || isBookmark
+}
+
+// Snapshots returns the full names of the snapshots of a dataset, oldest first
+func (z *ZFS) Snapshots(name string) []string {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	var names []string
+
+	for _, snap := range z.snapshotsOf(name) {
+		names = append(names, snap.name)
+	}
+
+	return names
+}
+
+// Bookmarks returns the full names of the bookmarks of a dataset, oldest first
+func (z *ZFS) Bookmarks(name string) []string {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	var names []string
+
+	for _, bookmark := range z.bookmarks {
+		if strings.HasPrefix(bookmark.name, name+"#") {
+			names = append(names, bookmark.name)
+		}
+	}
+
+	slices.SortFunc(names, func(a, b string) int {
+		return int(z.bookmarks[a].createTxg - z.bookmarks[b].createTxg)
+	})
+
+	return names
+}
+
+// Commands returns every command run so far, as name followed by args
+func (z *ZFS) Commands() [][]string {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	return slices.Clone(z.commands)
+}
+
+// Run runs the command and discards its output
+func (z *ZFS) Run(ctx context.Context, name string, args ...string) error {
+	_, err := z.Output(ctx, name, args...)
+
+	return err
+}
+
+// Output runs the command and returns its standard output
+func (z *ZFS) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	err := ctx.Err()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, context.Cause(ctx))
+	}
+
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	z.commands = append(z.commands, append([]string{name}, args...))
+
+	out, err := z.exec(name, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(out), nil
+}
+
+// Stream runs the command and calls onLine for each line of its standard output
+func (z *ZFS) Stream(ctx context.Context, onLine func(line string), name string, args ...string) error {
+	out, err := z.Output(ctx, name, args...)
+	if err != nil {
+		return err
+	}
+
+	for line := range strings.Lines(string(out)) {
+		onLine(strings.TrimSuffix(line, "\n"))
+	}
+
+	return nil
+}
+
+func (z *ZFS) exec(name string, args []string) (string, error) {
+	switch name {
+	case "getconf":
+		if len(args) == 1 && args[0] == "ARG_MAX" {
+			return strconv.Itoa(z.argMax) + "\n", nil
+		}
+	case "zpool":
+		if len(args) > 0 && args[0] == "get" {
+			return z.zpoolGet(args[1:])
+		}
+	case "zfs":
+		if len(args) == 0 {
+			break
+		}
+
+		switch args[0] {
+		case "list":
+			return z.zfsList(args[1:])
+		case "get":
+			return z.zfsGet(args[1:])
+		case "snapshot":
+			return "", z.zfsSnapshot(args[1:])
+		case "destroy":
+			return "", z.zfsDestroy(args[1:])
+		case "bookmark":
+			return "", z.zfsBookmark(args[1:])
+		case "hold":
+			return "", z.zfsHold(args[1:], z.hold)
+		case "release":
+			return "", z.zfsHold(args[1:], z.release)
+		case "holds":
+			return z.zfsHolds(args[1:])
+		case "set":
+			return "", z.zfsSet(args[1:])
+		case "inherit":
+			return "", z.zfsInherit(args[1:])
+		}
+	}
+
+	return "", fmt.Errorf("%w: %s %s", ErrUnsupported, name, strings.Join(args, " "))
+}
+
+// snapshotsOf returns the snapshots of a dataset, oldest first
+func (z *ZFS) snapshotsOf(name string) []*snapshot {
+	var snaps []*snapshot
+
+	for _, snap := range z.snapshots {
+		if strings.HasPrefix(snap.name, name+"@") {
+			snaps = append(snaps, snap)
+		}
+	}
+
+	slices.SortFunc(snaps, func(a, b *snapshot) int {
+		return int(a.createTxg - b.createTxg)
+	})
+
+	return snaps
+}
+
+// property returns the value of a property of a dataset or snapshot, and whether it is set. User properties
+// (those containing a colon) are inherited from the parent datasets.
+func (z *ZFS) property(name, property string) (string, bool) {
+	if bookmark, ok := z.bookmarks[name]; ok {
+		switch property {
+		case "name":
+			return bookmark.name, true
+		case "type":
+			return "bookmark", true
+		case "createtxg":
+			return strconv.FormatInt(bookmark.createTxg, 10), true
+		case "creation":
+			return strconv.FormatInt(bookmark.creation, 10), true
+		case "guid":
+			return strconv.FormatInt(bookmark.guid, 10), true
+		}
+
+		return "", false
+	}
+
+	if snap, ok := z.snapshots[name]; ok {
+		switch property {
+		case "name":
+			return snap.name, true
+		case "type":
+			return "snapshot", true
+		case "used":
+			return strconv.FormatInt(snap.used, 10), true
+		case "createtxg":
+			return strconv.FormatInt(snap.createTxg, 10), true
+		case "creation":
+			return strconv.FormatInt(snap.creation, 10), true
+		case "guid":
+			return strconv.FormatInt(snap.guid, 10), true
+		case "userrefs":
+			return strconv.Itoa(len(snap.holds)), true
+		case "defer_destroy":
+			if snap.deferDestroy {
+				return "on", true
+			}
+
+			return "off", true
+		}
+
+		if !strings.Contains(property, ":") {
+			return "", false
+		}
+
+		if value, ok := snap.properties[property]; ok {
+			return value, true
+		}
+
+		// snapshots inherit user properties from their dataset
+		name = name[:strings.Index(name, "@")]
+	}
+
+	ds, ok := z.datasets[name]
+	if !ok {
+		return "", false
+	}
+
+	switch property {
+	case "name":
+		return ds.name, true
+	case "type":
+		return ds.kind, true
+	case "creation":
+		return strconv.FormatInt(ds.creation, 10), true
+	}
+
+	value, ok := ds.properties[property]
+	if ok || !strings.Contains(property, ":") || !strings.Contains(name, "/") {
+		return value, ok
+	}
+
+	return z.property(name[:strings.LastIndex(name, "/")], property)
+}
+
+// depth returns how many levels below root name is, snapshots and bookmarks counting as one level below their
+// dataset
+func depth(root, name string) int {
+	if root == "" {
+		return 0
+	}
+
+	rel := strings.TrimPrefix(name, root)
+	levels := strings.Count(rel, "/")
+
+	if strings.ContainsAny(rel, "@#") {
+		levels++
+	}
+
+	return levels
+}
+
+// under reports whether name is root, a descendant of it or one of their snapshots or bookmarks
+func under(root, name string) bool {
+	return root == "" || name == root || strings.HasPrefix(name, root+"/") || strings.HasPrefix(name, root+"@") ||
+		strings.HasPrefix(name, root+"#")
+}
+
+type listOptions struct {
+	types     []string
+	fields    []string
+	sortKeys  []string
+	targets   []string
+	maxDepth  int
+	recursive bool
+	parsable  bool
+}
+
+//nolint:cyclop
+func parseListOptions(args []string) (listOptions, error) {
+	opts := listOptions{
+		types:    []string{"filesystem", "volume"},
+		fields:   []string{"name", "used", "avail", "refer", "mountpoint"},
+		maxDepth: -1,
+	}
+
+	for index := 0; index < len(args); index++ {
+		arg := args[index]
+
+		if !strings.HasPrefix(arg, "-") {
+			opts.targets = append(opts.targets, args[index:]...)
+
+			break
+		}
+
+		var value string
+
+		if slices.Contains([]string{"-t", "-o", "-s", "-S", "-d"}, arg) {
+			index++
+			if index >= len(args) {
+				return opts, failf("missing argument for '%s' option", arg)
+			}
+
+			value = args[index]
+		}
+
+		switch arg {
+		case "-H":
+		case "-p":
+			opts.parsable = true
+		case "-r":
+			opts.recursive = true
+		case "-t":
+			opts.types = strings.Split(value, ",")
+		case "-o":
+			opts.fields = strings.Split(value, ",")
+		case "-s":
+			opts.sortKeys = append(opts.sortKeys, "+"+value)
+		case "-S":
+			opts.sortKeys = append(opts.sortKeys, "-"+value)
+		case "-d":
+			maxDepth, err := strconv.Atoi(value)
+			if err != nil {
+				return opts, failf("invalid depth '%s'", value)
+			}
+
+			opts.maxDepth = maxDepth
+		default:
+			return opts, failf("invalid option '%s'", arg)
+		}
+	}
+
+	if opts.maxDepth < 0 && !opts.recursive && len(opts.targets) > 0 {
+		opts.maxDepth = 0
+	}
+
+	return opts, nil
+}
+
+//nolint:gocognit,cyclop,funlen
+func (z *ZFS) zfsList(args []string) (string, error) {
+	opts, err := parseListOptions(args)
+	if err != nil {
+		return "", err
+	}
+
+	roots := opts.targets
+	if len(roots) == 0 {
+		roots = []string{""}
+	}
+
+	for _, root := range roots {
+		if root != "" && z.datasets[root] == nil && z.snapshots[root] == nil {
+			return "", failf("cannot open '%s': dataset does not exist", root)
+		}
+	}
+
+	var names []string
+
+	candidates := slices.Collect(maps.Keys(z.datasets))
+	candidates = append(candidates, slices.Collect(maps.Keys(z.snapshots))...)
+	candidates = append(candidates, slices.Collect(maps.Keys(z.bookmarks))...)
+
+	for _, name := range candidates {
+		kind, _ := z.property(name, "type")
+		if !slices.Contains(opts.types, kind) && !slices.Contains(opts.types, "all") {
+			continue
+		}
+
+		for _, root := range roots {
+			if !under(root, name) {
+				continue
+			}
+
+			if opts.maxDepth >= 0 && depth(root, name) > opts.maxDepth {
+				continue
+			}
+
+			names = append(names, name)
+
+			break
+		}
+	}
+
+	slices.SortFunc(names, func(a, b string) int {
+		for _, key := range opts.sortKeys {
+			compared := z.compare(a, b, key[1:])
+			if key[0] == '-' {
+				compared = -compared
+			}
+
+			if compared != 0 {
+				return compared
+			}
+		}
+
+		// default order: datasets by name with each dataset's snapshots following it, oldest first
+		datasetA, _, _ := strings.Cut(strings.Replace(a, "#", "@", 1), "@")
+		datasetB, _, _ := strings.Cut(strings.Replace(b, "#", "@", 1), "@")
+
+		if datasetA != datasetB {
+			return strings.Compare(datasetA, datasetB)
+		}
+
+		return z.compare(a, b, "createtxg")
+	})
+
+	var out strings.Builder
+
+	for _, name := range names {
+		values := make([]string, 0, len(opts.fields))
+
+		for _, field := range opts.fields {
+			value, ok := z.property(name, field)
+			if !ok {
+				value = "-"
+			}
+
+			values = append(values, value)
+		}
+
+		out.WriteString(strings.Join(values, "\t") + "\n")
+	}
+
+	return out.String(), nil
+}
+
+// compare orders two datasets or snapshots by the value of property, numerically where possible
+func (z *ZFS) compare(a, b, property string) int {
+	valueA, _ := z.property(a, property)
+	valueB, _ := z.property(b, property)
+
+	numberA, errA := strconv.ParseInt(valueA, 10, 64)
+	numberB, errB := strconv.ParseInt(valueB, 10, 64)
+
+	if errA == nil && errB == nil {
+		return int(numberA - numberB)
+	}
+
+	return strings.Compare(valueA, valueB)
+}
+
+// localProperties returns the properties set on a dataset or snapshot itself
+func (z *ZFS) localProperties(name string) map[string]string {
+	if snap, ok := z.snapshots[name]; ok {
+		return snap.properties
+	}
+
+	return z.datasets[name].properties
+}
+
+//nolint:cyclop
+func (z *ZFS) zfsGet(args []string) (string, error) {
+	fields := []string{"name", "property", "value", "source"}
+	localOnly := false
+
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		switch args[0] {
+		case "-H", "-p", "-Hp":
+		case "-o", "-s":
+			if len(args) < 2 {
+				return "", failf("missing argument for '%s' option", args[0])
+			}
+
+			if args[0] == "-o" {
+				fields = strings.Split(args[1], ",")
+			} else {
+				localOnly = args[1] == "local"
+			}
+
+			args = args[1:]
+		default:
+			return "", failf("invalid option '%s'", args[0])
+		}
+
+		args = args[1:]
+	}
+
+	if len(args) < 2 {
+		return "", failf("missing property argument")
+	}
+
+	var out strings.Builder
+
+	for _, name := range args[1:] {
+		if z.datasets[name] == nil && z.snapshots[name] == nil {
+			return "", failf("cannot open '%s': dataset does not exist", name)
+		}
+
+		properties := strings.Split(args[0], ",")
+		if args[0] == "all" {
+			// only the local properties are known to the fake
+			properties = slices.Sorted(maps.Keys(z.localProperties(name)))
+		}
+
+		for _, property := range properties {
+			if _, ok := z.localProperties(name)[property]; localOnly && !ok {
+				continue
+			}
+
+			value, ok := z.property(name, property)
+			if !ok {
+				value = "-"
+			}
+
+			columns := map[string]string{"name": name, "property": property, "value": value, "source": "-"}
+			values := make([]string, 0, len(fields))
+
+			for _, field := range fields {
+				values = append(values, columns[field])
+			}
+
+			out.WriteString(strings.Join(values, "\t") + "\n")
+		}
+	}
+
+	return out.String(), nil
+}
+
+func (z *ZFS) zfsSnapshot(args []string) error {
+	recursive := false
+
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		if args[0] != "-r" {
+			return failf("invalid option '%s'", args[0])
+		}
+
+		recursive = true
+		args = args[1:]
+	}
+
+	if len(args) == 0 {
+		return failf("missing snapshot argument")
+	}
+
+	return z.createSnapshots(args, recursive)
+}
+
+// createSnapshots creates all the snapshots in one transaction group, or none of them
+func (z *ZFS) createSnapshots(names []string, recursive bool) error {
+	var all []string
+
+	pools := map[string]bool{}
+
+	for _, name := range names {
+		datasetName, snapName, found := strings.Cut(name, "@")
+		if !found || snapName == "" || strings.ContainsAny(snapName, "@/") {
+			return failf("cannot create snapshot '%s': invalid character in snapshot name", name)
+		}
+
+		if _, ok := z.datasets[datasetName]; !ok {
+			return failf("cannot open '%s': dataset does not exist", datasetName)
+		}
+
+		poolName, _, _ := strings.Cut(datasetName, "/")
+		pools[poolName] = true
+
+		for _, child := range slices.Sorted(maps.Keys(z.datasets)) {
+			if child == datasetName || (recursive && strings.HasPrefix(child, datasetName+"/")) {
+				all = append(all, child+"@"+snapName)
+			}
+		}
+	}
+
+	if len(pools) > 1 {
+		return failf("cannot create snapshots: all snapshots must be in the same pool")
+	}
+
+	for index, name := range all {
+		if _, ok := z.snapshots[name]; ok || slices.Contains(all[:index], name) {
+			return failf("cannot create snapshot '%s': dataset already exists", name)
+		}
+	}
+
+	z.txg++
+
+	for _, name := range all {
+		z.guid++
+		z.snapshots[name] = &snapshot{
+			name:       name,
+			createTxg:  z.txg,
+			creation:   z.now().Unix(),
+			guid:       z.guid,
+			holds:      map[string]bool{},
+			properties: map[string]string{},
+		}
+	}
+
+	return nil
+}
+
+func (z *ZFS) zfsDestroy(args []string) error {
+	deferred := false
+
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		if args[0] != "-d" {
+			return failf("invalid option '%s'", args[0])
+		}
+
+		deferred = true
+		args = args[1:]
+	}
+
+	if len(args) != 1 {
+		return failf("wrong number of arguments")
+	}
+
+	if _, ok := z.bookmarks[args[0]]; ok {
+		delete(z.bookmarks, args[0])
+
+		return nil
+	}
+
+	datasetName, snapList, found := strings.Cut(args[0], "@")
+	if !found {
+		return fmt.Errorf("%w: destroying datasets", ErrUnsupported)
+	}
+
+	var snaps []*snapshot
+
+	for _, snapName := range strings.Split(snapList, ",") {
+		snap, ok := z.snapshots[datasetName+"@"+snapName]
+		if !ok {
+			continue
+		}
+
+		if len(snap.holds) > 0 && !deferred {
+			return failf("cannot destroy snapshot %s: dataset is busy", snap.name)
+		}
+
+		snaps = append(snaps, snap)
+	}
+
+	if len(snaps) == 0 {
+		return failf("could not find any snapshots to destroy; check snapshot names.")
+	}
+
+	for _, snap := range snaps {
+		if len(snap.holds) > 0 {
+			snap.deferDestroy = true
+
+			continue
+		}
+
+		delete(z.snapshots, snap.name)
+	}
+
+	return nil
+}
+
+func (z *ZFS) zfsBookmark(args []string) error {
+	if len(args) != 2 { //nolint:mnd
+		return failf("wrong number of arguments")
+	}
+
+	snap, ok := z.snapshots[args[0]]
+	if !ok {
+		return failf("cannot bookmark '%s': dataset does not exist", args[0])
+	}
+
+	datasetName, _, _ := strings.Cut(args[0], "@")
+
+	bookmarkDataset, bookmarkName, found := strings.Cut(args[1], "#")
+	if !found || bookmarkName == "" || bookmarkDataset != datasetName {
+		return failf("cannot create bookmark '%s': invalid bookmark name", args[1])
+	}
+
+	if _, ok := z.bookmarks[args[1]]; ok {
+		return failf("cannot create bookmark '%s': bookmark exists", args[1])
+	}
+
+	z.bookmarks[args[1]] = &snapshot{
+		name:      args[1],
+		createTxg: snap.createTxg,
+		creation:  snap.creation,
+		guid:      snap.guid,
+	}
+
+	return nil
+}
+
+// zfsHold runs zfs hold or zfs release, by way of apply
+func (z *ZFS) zfsHold(args []string, apply func(name, tag string) error) error {
+	if len(args) < 2 { //nolint:mnd
+		return failf("missing tag or snapshot argument")
+	}
+
+	for _, name := range args[1:] {
+		err := apply(name, args[0])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (z *ZFS) zfsHolds(args []string) (string, error) {
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		if args[0] != "-H" {
+			return "", failf("invalid option '%s'", args[0])
+		}
+
+		args = args[1:]
+	}
+
+	var out strings.Builder
+
+	for _, name := range args {
+		snap, ok := z.snapshots[name]
+		if !ok {
+			return "", failf("cannot open '%s': dataset does not exist", name)
+		}
+
+		for _, tag := range slices.Sorted(maps.Keys(snap.holds)) {
+			out.WriteString(name + "\t" + tag + "\t" + time.Unix(snap.creation, 0).Format(time.ANSIC) + "\n")
+		}
+	}
+
+	return out.String(), nil
+}
+
+func (z *ZFS) zfsSet(args []string) error {
+	if len(args) < 2 { //nolint:mnd
+		return failf("missing property=value or dataset argument")
+	}
+
+	property, value, found := strings.Cut(args[0], "=")
+	if !found {
+		return failf("missing '=' for property=value argument")
+	}
+
+	for _, name := range args[1:] {
+		if z.datasets[name] == nil && z.snapshots[name] == nil {
+			return failf("cannot open '%s': dataset does not exist", name)
+		}
+
+		if z.snapshots[name] != nil && !strings.Contains(property, ":") {
+			return failf("cannot set property for '%s': this property can not be modified for snapshots", name)
+		}
+
+		z.localProperties(name)[property] = value
+	}
+
+	return nil
+}
+
+func (z *ZFS) zfsInherit(args []string) error {
+	if len(args) < 2 { //nolint:mnd
+		return failf("missing property or dataset argument")
+	}
+
+	for _, name := range args[1:] {
+		if z.datasets[name] == nil && z.snapshots[name] == nil {
+			return failf("cannot open '%s': dataset does not exist", name)
+		}
+
+		delete(z.localProperties(name), args[0])
+	}
+
+	return nil
+}
+
+func (z *ZFS) zpoolGet(args []string) (string, error) {
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		if args[0] == "-o" {
+			// only the name,property,value form is emitted
+			args = args[1:]
+		}
+
+		args = args[1:]
+	}
+
+	if len(args) == 0 {
+		return "", failf("missing property argument")
+	}
+
+	names := args[1:]
+	if len(names) == 0 {
+		names = slices.Sorted(maps.Keys(z.pools))
+	}
+
+	var out strings.Builder
+
+	for _, name := range names {
+		p, ok := z.pools[name]
+		if !ok {
+			return "", failf("cannot open '%s': no such pool", name)
+		}
+
+		properties := strings.Split(args[0], ",")
+		if args[0] == "all" {
+			properties = slices.Sorted(maps.Keys(p.properties))
+		}
+
+		for _, property := range properties {
+			if value, ok := p.properties[property]; ok {
+				out.WriteString(name + "\t" + property + "\t" + value + "\n")
+			}
+		}
+	}
+
+	return out.String(), nil
+}
@@ -0,0 +1,181 @@
+package zfsfake
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-test/deep"
+
+	"zfstools-go/internal/zfs"
+)
+
+func newFake(t *testing.T) *ZFS {
+	t.Helper()
+
+	fake := New()
+
+	for _, err := range []error{
+		fake.AddPool("tank", "bookmarks"),
+		fake.AddFilesystem("tank/home", map[string]string{"com.sun:auto-snapshot": "true"}),
+		fake.AddFilesystem("tank/home/user", nil),
+		fake.AddVolume("tank/vol", map[string]string{"com.sun:auto-snapshot": "false"}),
+	} {
+		if err != nil {
+			t.Fatalf("setting up fake: %v", err)
+		}
+	}
+
+	return fake
+}
+
+func TestZFS_ListDatasets(t *testing.T) {
+	t.Parallel()
+
+	client := zfs.NewClient(newFake(t))
+
+	got, err := client.ListDatasets(t.Context(), "tank", []string{"com.sun:auto-snapshot", "mounted"}, false)
+	if err != nil {
+		t.Fatalf("ListDatasets() error = %v", err)
+	}
+
+	want := []zfs.Dataset{
+		{Name: "tank", Properties: map[string]string{"type": "filesystem", "mounted": "yes"}},
+		{Name: "tank/home", Properties: map[string]string{
+			"type": "filesystem", "com.sun:auto-snapshot": "true", "mounted": "yes",
+		}},
+		{Name: "tank/home/user", Properties: map[string]string{
+			"type": "filesystem", "com.sun:auto-snapshot": "true", "mounted": "yes",
+		}},
+		{Name: "tank/vol", Properties: map[string]string{"type": "volume", "com.sun:auto-snapshot": "false"}},
+	}
+
+	diff := deep.Equal(got, want)
+	if diff != nil {
+		t.Errorf("compare failed: %v", diff)
+	}
+}
+
+func TestZFS_SnapshotLifecycle(t *testing.T) {
+	t.Parallel()
+
+	fake := newFake(t)
+	client := zfs.NewClient(fake)
+
+	err := client.CreateSnapshot(t.Context(), []string{"tank/home@a"}, true, "", false, false, false)
+	if err != nil {
+		t.Fatalf("CreateSnapshot() error = %v", err)
+	}
+
+	err = client.CreateSnapshot(t.Context(), []string{"tank/home@b"}, false, "", false, false, false)
+	if err != nil {
+		t.Fatalf("CreateSnapshot() error = %v", err)
+	}
+
+	err = client.CreateSnapshot(t.Context(), []string{"tank/home@b"}, false, "", false, false, false)
+	if err == nil {
+		t.Errorf("expected an error creating an existing snapshot")
+	}
+
+	err = fake.Write("tank/home", 4096)
+	if err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	got, err := client.ListSnapshots(t.Context(), "tank", true, false)
+	if err != nil {
+		t.Fatalf("ListSnapshots() error = %v", err)
+	}
+
+	want := []zfs.Snapshot{
+		{Name: "tank/home@b", Used: 4096},
+		{Name: "tank/home@a", Used: 0},
+		{Name: "tank/home/user@a", Used: 0},
+	}
+
+	diff := deep.Equal(got, want)
+	if diff != nil {
+		t.Errorf("compare failed: %v", diff)
+	}
+
+	err = fake.Hold("tank/home@a", "keep")
+	if err != nil {
+		t.Fatalf("Hold() error = %v", err)
+	}
+
+	err = client.DestroySnapshot(t.Context(), "tank/home@a", false, false)
+	if err != nil {
+		t.Fatalf("DestroySnapshot() error = %v", err)
+	}
+
+	if !fake.Exists("tank/home@a") {
+		t.Errorf("held snapshot was destroyed instead of deferred")
+	}
+
+	err = fake.Release("tank/home@a", "keep")
+	if err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+
+	if fake.Exists("tank/home@a") {
+		t.Errorf("deferred destroy did not happen on release")
+	}
+
+	diff = deep.Equal(fake.Snapshots("tank/home"), []string{"tank/home@b"})
+	if diff != nil {
+		t.Errorf("compare failed: %v", diff)
+	}
+}
+
+func TestZFS_GetUsed(t *testing.T) {
+	t.Parallel()
+
+	fake := newFake(t)
+
+	err := fake.AddSnapshot("tank/home@a", 8192)
+	if err != nil {
+		t.Fatalf("AddSnapshot() error = %v", err)
+	}
+
+	client := zfs.NewClient(fake)
+	snap := zfs.Snapshot{Name: "tank/home@a"}
+
+	if got := snap.GetUsed(t.Context(), client, false); got != 8192 {
+		t.Errorf("GetUsed() = %d, want 8192", got)
+	}
+}
+
+func TestZFS_ListPools(t *testing.T) {
+	t.Parallel()
+
+	fake := newFake(t)
+
+	err := fake.AddPool("backup")
+	if err != nil {
+		t.Fatalf("AddPool() error = %v", err)
+	}
+
+	client := zfs.NewClient(fake)
+
+	got, err := client.ListPools(t.Context(), "", []string{"feature@bookmarks"}, false)
+	if err != nil {
+		t.Fatalf("ListPools() error = %v", err)
+	}
+
+	want := []zfs.Pool{
+		{Name: "tank", Properties: map[string]string{"feature@bookmarks": "active"}},
+	}
+
+	diff := deep.Equal(got, want)
+	if diff != nil {
+		t.Errorf("compare failed: %v", diff)
+	}
+}
+
+func TestZFS_Unsupported(t *testing.T) {
+	t.Parallel()
+
+	err := New().Run(t.Context(), "zfs", "rename", "tank/a", "tank/b")
+	if !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Run() error = %v, want %v", err, ErrUnsupported)
+	}
+}
@@ -0,0 +1,110 @@
+package zfstools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"zfstools-go/internal/config"
+	"zfstools-go/internal/report"
+	"zfstools-go/internal/zfs"
+)
+
+var ErrBookmarksUnsupported = errors.New("feature@bookmarks is not enabled")
+
+// bookmarkSnapshot bookmarks snap, so that it can still be sent from incrementally once it is destroyed
+func bookmarkSnapshot(ctx context.Context, client *zfs.Client, cfg config.Config, snap zfs.Snapshot) error {
+	if !client.HasBookmarks(ctx, zfs.PoolName(snap.Name), cfg.Debug) {
+		return &zfs.SnapshotError{Err: ErrBookmarksUnsupported, Op: "bookmarking", Snapshots: []string{snap.Name}}
+	}
+
+	start := time.Now()
+	dataset, _, _ := strings.Cut(snap.Name, "@")
+
+	err := client.CreateBookmark(ctx, snap.Name, cfg.DryRun, cfg.Debug)
+	if err != nil {
+		// the bookmark may be left from a run which failed to destroy the snapshot
+		bookmarks, listErr := client.ListBookmarks(ctx, dataset, false, cfg.Debug)
+		if listErr != nil || !slices.ContainsFunc(bookmarks, func(bookmark zfs.Bookmark) bool {
+			return bookmark.Name == zfs.BookmarkName(snap.Name)
+		}) {
+			return err //nolint:wrapcheck
+		}
+
+		return nil
+	}
+
+	notify(cfg, report.Event{
+		Type:     report.BookmarkCreated,
+		Dataset:  dataset,
+		Snapshot: zfs.BookmarkName(snap.Name),
+		Duration: time.Since(start),
+	})
+
+	return nil
+}
+
+// cleanupExpiredBookmarks destroys all but the newest cfg.KeepBookmarks bookmarks of the interval of each included
+// dataset, returning the joined errors of those which could not be listed or destroyed. Nothing is destroyed when
+// cfg.KeepBookmarks is zero.
+func cleanupExpiredBookmarks(
+	ctx context.Context,
+	client *zfs.Client,
+	cfg config.Config,
+	pool string,
+	included map[string]zfs.Dataset,
+) error {
+	if cfg.KeepBookmarks <= 0 || ctx.Err() != nil {
+		return nil
+	}
+
+	bookmarks, err := client.ListBookmarks(ctx, pool, true, cfg.Debug)
+	if err != nil {
+		err = fmt.Errorf("error cleaning up expired bookmarks: %w", err)
+		ReportFailures(cfg, err)
+
+		return err
+	}
+
+	byDataset := map[string][]zfs.Bookmark{}
+
+	for _, bookmark := range bookmarks {
+		dataset, name, _ := strings.Cut(bookmark.Name, "#")
+		if _, ok := included[dataset]; ok && strings.Contains(name, snapshotPrefixInterval(cfg)) {
+			byDataset[dataset] = append(byDataset[dataset], bookmark)
+		}
+	}
+
+	var errs []error
+
+	for dataset, bookmarks := range byDataset {
+		// bookmarks are listed oldest first
+		for _, bookmark := range bookmarks[:max(len(bookmarks)-cfg.KeepBookmarks, 0)] {
+			if ctx.Err() != nil {
+				break
+			}
+
+			start := time.Now()
+
+			err = client.DestroyBookmark(ctx, bookmark.Name, cfg.DryRun, cfg.Debug)
+			if err != nil {
+				ReportFailures(cfg, err)
+				errs = append(errs, err)
+
+				continue
+			}
+
+			notify(cfg, report.Event{
+				Type:     report.BookmarkDestroyed,
+				Dataset:  dataset,
+				Snapshot: bookmark.Name,
+				Duration: time.Since(start),
+			})
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,178 @@
+package zfstools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"zfstools-go/internal/config"
+	"zfstools-go/internal/report"
+	"zfstools-go/internal/zfs"
+)
+
+// HoldSnapshots places a hold with tag on each of the snapshots, which keeps CleanupExpiredSnapshots from
+// destroying them, and records when it expires or, with a zero expires, that it doesn't. A snapshot which already
+// has the hold only has its expiry updated. It returns the joined errors of the snapshots which could not be held.
+func HoldSnapshots(
+	ctx context.Context,
+	client *zfs.Client,
+	cfg config.Config,
+	tag string,
+	snapshots []string,
+	expires time.Time,
+) error {
+	var errs []error
+
+	for _, snapshot := range snapshots {
+		if ctx.Err() != nil {
+			break
+		}
+
+		if cfg.Verbose {
+			fmt.Println("Holding snapshot:", snapshot) //nolint:forbidigo
+		}
+
+		err := client.Hold(ctx, tag, snapshot, cfg.DryRun, cfg.Debug)
+		if err != nil {
+			tags, holdsErr := client.Holds(ctx, snapshot, cfg.Debug)
+			if holdsErr == nil && slices.Contains(tags, tag) {
+				err = nil
+			}
+		}
+
+		if err == nil {
+			err = client.SetHoldExpiry(ctx, tag, snapshot, expires, cfg.DryRun, cfg.Debug)
+		}
+
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// ReleaseSnapshots releases the hold with tag on each of the snapshots, along with its expiry. It returns the
+// joined errors of the snapshots which could not be released.
+func ReleaseSnapshots(
+	ctx context.Context,
+	client *zfs.Client,
+	cfg config.Config,
+	tag string,
+	snapshots []string,
+) error {
+	var errs []error
+
+	for _, snapshot := range snapshots {
+		if ctx.Err() != nil {
+			break
+		}
+
+		if cfg.Verbose {
+			fmt.Println("Releasing hold on snapshot:", snapshot) //nolint:forbidigo
+		}
+
+		err := client.Release(ctx, tag, snapshot, cfg.DryRun, cfg.Debug)
+		if err == nil {
+			err = client.SetHoldExpiry(ctx, tag, snapshot, time.Time{}, cfg.DryRun, cfg.Debug)
+		}
+
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// releaseExpiredHolds releases the holds on snapshot which expired by cfg.Timestamp, and reports whether it is
+// still held
+func releaseExpiredHolds(ctx context.Context, client *zfs.Client, cfg config.Config, snapshot string) (bool, error) {
+	expiries, err := client.HoldExpiries(ctx, snapshot, cfg.Debug)
+	if err != nil || len(expiries) == 0 {
+		return true, err //nolint:wrapcheck
+	}
+
+	tags, err := client.Holds(ctx, snapshot, cfg.Debug)
+	if err != nil {
+		return true, err //nolint:wrapcheck
+	}
+
+	var expired []string
+
+	for _, tag := range tags {
+		expires, ok := expiries[tag]
+		if ok && !expires.After(cfg.Timestamp) {
+			expired = append(expired, tag)
+		}
+	}
+
+	var errs []error
+
+	for _, tag := range expired {
+		err = ReleaseSnapshots(ctx, client, cfg, tag, []string{snapshot})
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return len(tags) > len(expired) || len(errs) > 0, errors.Join(errs...)
+}
+
+// skipHeldSnapshots takes the held snapshots out of grouped, once their expired holds are released, reporting each
+// of them. Snapshots which might be held, because they could not be checked, are taken out too. It returns the
+// joined errors of the snapshots which could not be checked.
+func skipHeldSnapshots(
+	ctx context.Context,
+	client *zfs.Client,
+	cfg config.Config,
+	pool string,
+	grouped map[string][]zfs.Snapshot,
+) error {
+	held, err := client.HeldSnapshots(ctx, pool, cfg.Debug)
+	if err != nil {
+		// any of them might be held
+		clear(grouped)
+
+		return fmt.Errorf("error cleaning up expired snapshots: %w", err)
+	}
+
+	var errs []error
+
+	for dataset, snaps := range grouped {
+		var unheld []zfs.Snapshot
+
+		for _, snap := range snaps {
+			if !held[snap.Name] {
+				unheld = append(unheld, snap)
+
+				continue
+			}
+
+			stillHeld, err := releaseExpiredHolds(ctx, client, cfg, snap.Name)
+			if err != nil {
+				errs = append(errs, err)
+
+				continue
+			}
+
+			if !stillHeld {
+				unheld = append(unheld, snap)
+
+				continue
+			}
+
+			if cfg.Verbose {
+				fmt.Println("Skipping held snapshot:", snap.Name) //nolint:forbidigo
+			}
+
+			notify(cfg, report.Event{Type: report.SnapshotHeld, Dataset: dataset, Snapshot: snap.Name})
+		}
+
+		grouped[dataset] = unheld
+	}
+
+	return errors.Join(errs...)
+}
@@ -1,7 +0,0 @@
-package zfstools
-
-import "zfstools-go/internal/zfs"
-
-var createManySnapshotsFn = zfs.CreateManySnapshots
-
-var destroySnapshotFn = zfs.DestroySnapshot
@@ -0,0 +1,58 @@
+package zfstools
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"zfstools-go/internal/config"
+	"zfstools-go/internal/lock"
+	"zfstools-go/internal/zfs"
+)
+
+// PoolNames returns the pool of pool, which may be a dataset as -P takes, or, when it is empty, the names of every
+// pool
+func PoolNames(ctx context.Context, client *zfs.Client, cfg config.Config, pool string) ([]string, error) {
+	if pool != "" {
+		return []string{zfs.PoolName(pool)}, nil
+	}
+
+	pools, err := client.ListPools(ctx, "", []string{"health"}, cfg.Debug)
+	if err != nil {
+		return nil, fmt.Errorf("error listing pools: %w", err)
+	}
+
+	names := make([]string, 0, len(pools))
+
+	for _, pool := range pools {
+		names = append(names, pool.Name)
+	}
+
+	return names, nil
+}
+
+// LockPools locks pool, or every pool when it is empty, against the runs of the other commands on it, with the lock
+// files in dir. It waits for the other runs as lock.Acquire does.
+func LockPools(
+	ctx context.Context,
+	client *zfs.Client,
+	cfg config.Config,
+	dir, pool string,
+	wait time.Duration,
+) (*lock.Lock, error) {
+	pools, err := PoolNames(ctx, client, cfg, pool)
+	if err != nil {
+		ReportFailures(cfg, err)
+
+		return nil, err
+	}
+
+	poolLock, err := lock.Acquire(ctx, dir, pools, wait)
+	if err != nil {
+		ReportFailures(cfg, err)
+
+		return nil, err //nolint:wrapcheck
+	}
+
+	return poolLock, nil
+}
@@ -0,0 +1,54 @@
+package zfstools
+
+import (
+	"errors"
+	"testing"
+
+	"zfstools-go/internal/config"
+	"zfstools-go/internal/lock"
+	"zfstools-go/internal/zfs"
+)
+
+func TestLockPools(t *testing.T) {
+	t.Parallel()
+
+	fake := newScenario(t)
+
+	err := fake.AddPool("backup")
+	if err != nil {
+		t.Fatalf("setting up fake: %v", err)
+	}
+
+	client := zfs.NewClient(fake)
+	dir := t.TempDir()
+
+	all, err := LockPools(t.Context(), client, config.Config{}, dir, "", 0)
+	if err != nil {
+		t.Fatalf("LockPools() error = %v", err)
+	}
+
+	for _, pool := range []string{"tank", "backup"} {
+		_, err = LockPools(t.Context(), client, config.Config{}, dir, pool, 0)
+		if !errors.Is(err, lock.ErrLocked) {
+			t.Errorf("LockPools(%s) error = %v, want %v", pool, err, lock.ErrLocked)
+		}
+	}
+
+	err = all.Release()
+	if err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+
+	tank, err := LockPools(t.Context(), client, config.Config{}, dir, "tank", 0)
+	if err != nil {
+		t.Fatalf("LockPools() error = %v once released", err)
+	}
+
+	// -P may name a dataset, which locks its pool
+	_, err = LockPools(t.Context(), client, config.Config{}, dir, "tank/data", 0)
+	if !errors.Is(err, lock.ErrLocked) {
+		t.Errorf("LockPools(tank/data) error = %v, want %v", err, lock.ErrLocked)
+	}
+
+	_ = tank.Release()
+}
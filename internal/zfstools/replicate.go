@@ -0,0 +1,199 @@
+package zfstools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"zfstools-go/internal/config"
+	"zfstools-go/internal/zfs"
+)
+
+var ErrNoCommonSnapshot = errors.New("no snapshot in common")
+
+// ReplicationHoldTag is the tag of the hold placed on the last snapshot a dataset has in common with its replica,
+// so that it isn't destroyed before the next snapshot is sent
+const ReplicationHoldTag = "zfs-replicate"
+
+// ReplicationTarget is where datasets are replicated to: below Root, through Remote, such as "ssh backup", or on
+// this host when it is empty
+type ReplicationTarget struct {
+	Remote []string
+	Root   string
+}
+
+// dataset returns the name of the replica of source
+func (t ReplicationTarget) dataset(source string) string {
+	return t.Root + "/" + source
+}
+
+// Replicate sends the newest snapshot, named with the snapshot prefix, of each included dataset to the target,
+// incrementally from the newest snapshot they have in common (or failing that, the newest bookmark of one) or in
+// full when the dataset hasn't been replicated yet. It returns the joined errors of the datasets which could not
+// be replicated.
+func Replicate(
+	ctx context.Context,
+	client *zfs.Client,
+	cfg config.Config,
+	datasets map[string][]zfs.Dataset,
+	target ReplicationTarget,
+) error {
+	included := slices.Clone(datasets["included"])
+
+	// parents are received first, so that their children can be received below them
+	slices.SortFunc(included, func(a, b zfs.Dataset) int { return strings.Compare(a.Name, b.Name) })
+
+	var errs []error
+
+	for _, dataset := range included {
+		if ctx.Err() != nil {
+			break
+		}
+
+		err := replicateDataset(ctx, client, cfg, dataset.Name, target)
+		if err != nil {
+			ReportFailures(cfg, err)
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// newestCommon returns the newest of snapshots which is also in replicas, by guid
+func newestCommon(snapshots, replicas []zfs.Replica) (zfs.Replica, bool) {
+	for _, snapshot := range slices.Backward(snapshots) {
+		if slices.ContainsFunc(replicas, func(replica zfs.Replica) bool { return replica.GUID == snapshot.GUID }) {
+			return snapshot, true
+		}
+	}
+
+	return zfs.Replica{}, false
+}
+
+// replicateDataset sends the newest snapshot of source to its replica, then moves the hold to it from the snapshot
+// it was sent from
+func replicateDataset(
+	ctx context.Context,
+	client *zfs.Client,
+	cfg config.Config,
+	source string,
+	target ReplicationTarget,
+) error {
+	all, err := client.ListReplicas(ctx, nil, source, cfg.Debug)
+	if err != nil {
+		return fmt.Errorf("error replicating %s: %w", source, err)
+	}
+
+	snapshots := slices.DeleteFunc(all, func(snapshot zfs.Replica) bool {
+		_, name, _ := strings.Cut(snapshot.Name, "@")
+
+		return !strings.HasPrefix(name, snapshotPrefix(cfg)+"_")
+	})
+	if len(snapshots) == 0 {
+		return nil
+	}
+
+	newest := snapshots[len(snapshots)-1]
+	replica := target.dataset(source)
+
+	replicas, err := client.ListReplicas(ctx, target.Remote, replica, cfg.Debug)
+	if err != nil && !errors.Is(err, zfs.ErrDoesNotExist) {
+		return fmt.Errorf("error replicating %s: %w", source, err)
+	}
+
+	exists := err == nil
+
+	base, found := newestCommon(snapshots, replicas)
+	if !found && exists {
+		// the snapshot last sent may have expired, leaving a bookmark to send from
+		base, found, err = newestCommonBookmark(ctx, client, cfg, source, replicas)
+		if err != nil {
+			return fmt.Errorf("error replicating %s: %w", source, err)
+		}
+	}
+
+	switch {
+	case found && base.Name == newest.Name:
+		// already replicated, though it may not have been held
+		return moveReplicationHold(ctx, client, cfg, "", newest.Name)
+
+	case found:
+		err = client.Send(ctx, base.Name, newest.Name, target.Remote, replica, cfg.DryRun, cfg.Verbose, cfg.Debug)
+
+	case exists:
+		// a full stream can't be received over a dataset, so it would have to be destroyed first
+		return fmt.Errorf("error replicating %s: %w with %s", source, ErrNoCommonSnapshot, replica)
+
+	default:
+		err = client.CreateParents(ctx, target.Remote, replica, cfg.DryRun, cfg.Debug)
+		if err == nil {
+			err = client.Send(ctx, "", newest.Name, target.Remote, replica, cfg.DryRun, cfg.Verbose, cfg.Debug)
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("error replicating %s: %w", source, err)
+	}
+
+	previous := base.Name
+	if strings.Contains(previous, "#") {
+		// bookmarks can't be held
+		previous = ""
+	}
+
+	return moveReplicationHold(ctx, client, cfg, previous, newest.Name)
+}
+
+// newestCommonBookmark returns the newest bookmark of source which is also a snapshot in replicas, by guid
+func newestCommonBookmark(
+	ctx context.Context,
+	client *zfs.Client,
+	cfg config.Config,
+	source string,
+	replicas []zfs.Replica,
+) (zfs.Replica, bool, error) {
+	bookmarks, err := client.ListBookmarks(ctx, source, false, cfg.Debug)
+	if err != nil {
+		return zfs.Replica{}, false, err //nolint:wrapcheck
+	}
+
+	candidates := make([]zfs.Replica, 0, len(bookmarks))
+
+	for _, bookmark := range bookmarks {
+		candidates = append(candidates, zfs.Replica{Name: bookmark.Name, GUID: bookmark.GUID})
+	}
+
+	base, found := newestCommon(candidates, replicas)
+
+	return base, found, nil
+}
+
+// moveReplicationHold holds newest, now the last snapshot in common with the replica, and releases the hold on
+// previous, the last one before it, when there was one
+func moveReplicationHold(ctx context.Context, client *zfs.Client, cfg config.Config, previous, newest string) error {
+	tags, err := client.Holds(ctx, newest, cfg.Debug)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	if !slices.Contains(tags, ReplicationHoldTag) {
+		err = client.Hold(ctx, ReplicationHoldTag, newest, cfg.DryRun, cfg.Debug)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+	}
+
+	if previous == "" || previous == newest {
+		return nil
+	}
+
+	tags, err = client.Holds(ctx, previous, cfg.Debug)
+	if err != nil || !slices.Contains(tags, ReplicationHoldTag) {
+		return err //nolint:wrapcheck
+	}
+
+	return client.Release(ctx, ReplicationHoldTag, previous, cfg.DryRun, cfg.Debug) //nolint:wrapcheck
+}
@@ -0,0 +1,206 @@
+package zfstools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/go-test/deep"
+
+	"zfstools-go/internal/config"
+	"zfstools-go/internal/zfs"
+)
+
+var errUnexpectedCommand = errors.New("unexpected command")
+
+// replicationExecutor runs zfs on a source and, through "ssh backup", a target, each a map from dataset to its
+// snapshots, oldest first. The source's datasets may have bookmarks too. The guid of a snapshot or bookmark is its
+// name after the @ or #.
+type replicationExecutor struct {
+	datasets  map[string]map[string][]string
+	bookmarks map[string][]string
+	holds     map[string][]string
+	commands  []string
+}
+
+func (e *replicationExecutor) host(command []string) (string, []string) {
+	if command[0] == "ssh" {
+		return "target", command[3:]
+	}
+
+	return "source", command[1:]
+}
+
+func (e *replicationExecutor) Run(_ context.Context, name string, args ...string) error {
+	command := append([]string{name}, args...)
+	e.commands = append(e.commands, strings.Join(command, " "))
+
+	_, args = e.host(command)
+
+	switch args[0] {
+	case "hold":
+		e.holds[args[2]] = append(e.holds[args[2]], args[1])
+	case "release":
+		e.holds[args[2]] = slices.DeleteFunc(e.holds[args[2]], func(tag string) bool { return tag == args[1] })
+	case "create":
+	default:
+		return errUnexpectedCommand
+	}
+
+	return nil
+}
+
+func (e *replicationExecutor) Output(_ context.Context, _ string, _ ...string) ([]byte, error) {
+	return nil, errUnexpectedCommand
+}
+
+func (e *replicationExecutor) Stream(_ context.Context, onLine func(line string), name string, args ...string) error {
+	command := append([]string{name}, args...)
+	host, args := e.host(command)
+
+	if args[0] == "holds" {
+		for _, tag := range e.holds[args[2]] {
+			onLine(args[2] + "\t" + tag + "\tThu Jan  1 00:00 2025")
+		}
+
+		return nil
+	}
+
+	dataset := args[len(args)-1]
+
+	if slices.Contains(args, "bookmark") {
+		for _, bookmark := range e.bookmarks[dataset] {
+			onLine(dataset + "#" + bookmark + "\t" + bookmark)
+		}
+
+		return nil
+	}
+
+	snapshots, ok := e.datasets[host][dataset]
+	if !ok {
+		return fmt.Errorf("cannot open '%s': dataset does not exist", dataset) //nolint:err113
+	}
+
+	for _, snapshot := range snapshots {
+		onLine(dataset + "@" + snapshot + "\t" + snapshot)
+	}
+
+	return nil
+}
+
+func (e *replicationExecutor) Pipe(_ context.Context, from, to []string) error {
+	e.commands = append(e.commands, strings.Join(from, " ")+" | "+strings.Join(to, " "))
+
+	source, snapshot, _ := strings.Cut(from[len(from)-1], "@")
+	first := slices.Index(e.datasets["source"][source], snapshot)
+
+	if from[2] == "-I" {
+		_, base, _ := strings.Cut(from[3], "@")
+		first = slices.Index(e.datasets["source"][source], base) + 1
+	}
+
+	// -i sends only the snapshot, as does a full send
+
+	replica := to[len(to)-1]
+	e.datasets["target"][replica] = append(e.datasets["target"][replica],
+		e.datasets["source"][source][first:slices.Index(e.datasets["source"][source], snapshot)+1]...)
+
+	return nil
+}
+
+func TestReplicate(t *testing.T) {
+	t.Parallel()
+
+	executor := &replicationExecutor{
+		datasets: map[string]map[string][]string{
+			"source": {"tank/data": {"zfs-auto-snap_hourly-1", "manual", "zfs-auto-snap_hourly-2"}},
+			"target": {},
+		},
+		holds: map[string][]string{},
+	}
+	client := zfs.NewClient(executor)
+	cfg := config.Config{}
+	datasets := map[string][]zfs.Dataset{"included": {{Name: "tank/data"}}}
+	target := ReplicationTarget{Remote: []string{"ssh", "backup"}, Root: "backup"}
+
+	steps := []struct {
+		snapshot string
+		want     []string
+	}{
+		{
+			want: []string{
+				"ssh backup zfs create -p backup/tank",
+				"zfs send tank/data@zfs-auto-snap_hourly-2 | ssh backup zfs receive -u backup/tank/data",
+				"zfs hold zfs-replicate tank/data@zfs-auto-snap_hourly-2",
+			},
+		},
+		{
+			snapshot: "zfs-auto-snap_daily-3",
+			want: []string{
+				"zfs send -I tank/data@zfs-auto-snap_hourly-2 tank/data@zfs-auto-snap_daily-3 | " +
+					"ssh backup zfs receive -u backup/tank/data",
+				"zfs hold zfs-replicate tank/data@zfs-auto-snap_daily-3",
+				"zfs release zfs-replicate tank/data@zfs-auto-snap_hourly-2",
+			},
+		},
+		{
+			// nothing new
+		},
+	}
+
+	for _, step := range steps {
+		if step.snapshot != "" {
+			executor.datasets["source"]["tank/data"] = append(executor.datasets["source"]["tank/data"], step.snapshot)
+		}
+
+		executor.commands = nil
+
+		err := Replicate(t.Context(), client, cfg, datasets, target)
+		if err != nil {
+			t.Fatalf("Replicate() error = %v", err)
+		}
+
+		if diff := deep.Equal(executor.commands, step.want); diff != nil {
+			t.Error(diff)
+		}
+	}
+
+	wantHolds := map[string][]string{
+		"tank/data@zfs-auto-snap_hourly-2": {},
+		"tank/data@zfs-auto-snap_daily-3":  {"zfs-replicate"},
+	}
+	if diff := deep.Equal(executor.holds, wantHolds); diff != nil {
+		t.Error(diff)
+	}
+
+	// once the snapshots in common have expired, their bookmarks are sent from
+	executor.datasets["source"]["tank/data"] = []string{"zfs-auto-snap_hourly-4"}
+	executor.bookmarks = map[string][]string{"tank/data": {"zfs-auto-snap_hourly-2", "zfs-auto-snap_daily-3"}}
+	executor.holds = map[string][]string{}
+	executor.commands = nil
+
+	err := Replicate(t.Context(), client, cfg, datasets, target)
+	if err != nil {
+		t.Fatalf("Replicate() error = %v", err)
+	}
+
+	want := []string{
+		"zfs send -i tank/data#zfs-auto-snap_daily-3 tank/data@zfs-auto-snap_hourly-4 | " +
+			"ssh backup zfs receive -u backup/tank/data",
+		"zfs hold zfs-replicate tank/data@zfs-auto-snap_hourly-4",
+	}
+	if diff := deep.Equal(executor.commands, want); diff != nil {
+		t.Error(diff)
+	}
+
+	// a replica which has nothing in common can't be sent to
+	executor.datasets["target"]["backup/tank/data"] = []string{"other"}
+
+	err = Replicate(t.Context(), client, cfg, datasets, target)
+	if !errors.Is(err, ErrNoCommonSnapshot) {
+		t.Errorf("Replicate() error = %v, want %v", err, ErrNoCommonSnapshot)
+	}
+}
@@ -0,0 +1,246 @@
+package zfstools
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"zfstools-go/internal/config"
+	"zfstools-go/internal/report"
+	"zfstools-go/internal/zfs"
+)
+
+var ErrInvalidPolicy = errors.New("invalid retention policy")
+
+var ErrEmptyPolicy = errors.New("retention policy keeps nothing")
+
+// retentionBucket is a kind of period a RetentionPolicy can keep one snapshot of, with how to name the period a
+// time falls in
+type retentionBucket struct {
+	bucket func(t time.Time) string
+	name   string
+}
+
+// retentionBuckets are from finest to coarsest
+var retentionBuckets = []retentionBucket{
+	{name: "hourly", bucket: func(t time.Time) string { return t.Format("2006-01-02 15h") }},
+	{name: "daily", bucket: func(t time.Time) string { return t.Format("2006-01-02") }},
+	{name: "weekly", bucket: func(t time.Time) string {
+		year, week := t.ISOWeek()
+
+		return fmt.Sprintf("%d-W%02d", year, week)
+	}},
+	{name: "monthly", bucket: func(t time.Time) string { return t.Format("2006-01") }},
+	{name: "yearly", bucket: func(t time.Time) string { return t.Format("2006") }},
+}
+
+// RetentionPolicy is how many of the most recent hours, days, weeks, months and years, by the name of the bucket,
+// keep their newest snapshot
+type RetentionPolicy map[string]int
+
+// ParseRetentionPolicy parses a policy such as "hourly=24,daily=30,monthly=12,yearly=5"
+func ParseRetentionPolicy(value string) (RetentionPolicy, error) {
+	policy := RetentionPolicy{}
+
+	for rule := range strings.SplitSeq(value, ",") {
+		name, countString, found := strings.Cut(strings.TrimSpace(rule), "=")
+
+		count, err := strconv.Atoi(countString)
+		known := slices.ContainsFunc(retentionBuckets, func(bucket retentionBucket) bool {
+			return bucket.name == name
+		})
+
+		if !found || err != nil || count < 0 || !known {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidPolicy, rule)
+		}
+
+		policy[name] = count
+	}
+
+	for _, count := range policy {
+		if count > 0 {
+			return policy, nil
+		}
+	}
+
+	return nil, ErrEmptyPolicy
+}
+
+// Retention is the decision made by a RetentionPolicy about one snapshot
+type Retention struct {
+	Taken    time.Time
+	Snapshot zfs.Snapshot
+	// Reasons are the buckets the snapshot is kept for, such as "daily 2025-01-02", it is destroyed when there are
+	// none
+	Reasons []string
+}
+
+// Keep reports whether the snapshot is kept
+func (r Retention) Keep() bool {
+	return len(r.Reasons) > 0
+}
+
+// ApplyRetentionPolicy decides which of one dataset's snapshots the policy keeps: for each bucket, the newest
+// snapshot of each of the policy's most recent periods which have a snapshot. Snapshots which weren't dated (with
+// a zero Taken) are always kept. The result is ordered newest first.
+func ApplyRetentionPolicy(policy RetentionPolicy, retentions []Retention) []Retention {
+	retentions = slices.Clone(retentions)
+
+	slices.SortStableFunc(retentions, func(a, b Retention) int {
+		return cmp.Or(b.Taken.Compare(a.Taken), strings.Compare(b.Snapshot.Name, a.Snapshot.Name))
+	})
+
+	for _, bucket := range retentionBuckets {
+		count := policy[bucket.name]
+		seen := 0
+		last := ""
+
+		for index := range retentions {
+			if retentions[index].Taken.IsZero() {
+				continue
+			}
+
+			period := bucket.bucket(retentions[index].Taken)
+			if period == last {
+				continue
+			}
+
+			seen++
+			if seen > count {
+				break
+			}
+
+			last = period
+			retentions[index].Reasons = append(retentions[index].Reasons, bucket.name+" "+period)
+		}
+	}
+
+	for index := range retentions {
+		if retentions[index].Taken.IsZero() {
+			retentions[index].Reasons = append(retentions[index].Reasons, "unknown age")
+		}
+	}
+
+	return retentions
+}
+
+// PruneSnapshots applies the policy to the snapshots of every interval, those named with the snapshot prefix, of
+// each dataset in pool which is snapshot for that interval, and destroys those it doesn't keep. Held snapshots are
+// skipped, once their expired holds are released, and don't count towards the policy. It returns the decisions,
+// grouped by dataset and newest first, along with the joined errors of the snapshots which could not be listed or
+// destroyed.
+func PruneSnapshots(
+	ctx context.Context,
+	client *zfs.Client,
+	cfg config.Config,
+	pool string,
+	policy RetentionPolicy,
+) ([]Retention, error) {
+	snaps, err := client.ListSnapshots(ctx, pool, true, cfg.Debug)
+	if err != nil {
+		err = fmt.Errorf("error pruning snapshots: %w", err)
+		ReportFailures(cfg, err)
+
+		return nil, err
+	}
+
+	grouped, err := selectPrunedSnapshots(ctx, client, cfg, pool, snaps)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+
+	// held snapshots are neither destroyed nor counted by the policy
+	err = skipHeldSnapshots(ctx, client, cfg, pool, grouped)
+	if err != nil {
+		ReportFailures(cfg, err)
+		errs = append(errs, err)
+	}
+
+	var retentions []Retention
+
+	var expired []zfs.Snapshot
+
+	for _, dataset := range slices.Sorted(maps.Keys(grouped)) {
+		var dated []Retention
+
+		for _, snap := range grouped[dataset] {
+			retention := Retention{Snapshot: snap}
+
+			// an undated snapshot is left alone
+			taken, err := snapshotTime(ctx, client, cfg, &snap)
+			if err == nil {
+				retention.Taken = taken
+			}
+
+			dated = append(dated, retention)
+		}
+
+		for _, retention := range ApplyRetentionPolicy(policy, dated) {
+			retentions = append(retentions, retention)
+
+			if !retention.Keep() {
+				expired = append(expired, retention.Snapshot)
+			}
+		}
+	}
+
+	errs = append(errs, destroySnapshots(ctx, client, cfg, expired, report.SnapshotDestroyed))
+
+	return retentions, errors.Join(errs...)
+}
+
+// selectPrunedSnapshots returns the snapshots named with the snapshot prefix, grouped by dataset, of the datasets
+// which are snapshot for the interval in their names, as zfs-auto-snapshot would choose them
+func selectPrunedSnapshots(
+	ctx context.Context,
+	client *zfs.Client,
+	cfg config.Config,
+	pool string,
+	snaps []zfs.Snapshot,
+) (map[string][]zfs.Snapshot, error) {
+	grouped := map[string][]zfs.Snapshot{}
+
+	// the datasets which are snapshot, by interval
+	selected := map[string]map[string]bool{}
+
+	for _, snap := range snaps {
+		dataset, name, _ := strings.Cut(snap.Name, "@")
+
+		rest, ok := strings.CutPrefix(name, snapshotPrefix(cfg)+"_")
+		if !ok {
+			continue
+		}
+
+		interval, _, _ := strings.Cut(rest, "-")
+
+		if selected[interval] == nil {
+			intervalCfg := cfg
+			intervalCfg.Interval = interval
+
+			included, _, err := selectDatasets(ctx, client, intervalCfg, pool)
+			if err != nil {
+				return nil, err
+			}
+
+			selected[interval] = map[string]bool{}
+
+			for _, ds := range included {
+				selected[interval][ds.Name] = true
+			}
+		}
+
+		if selected[interval][dataset] {
+			grouped[dataset] = append(grouped[dataset], snap)
+		}
+	}
+
+	return grouped, nil
+}
@@ -0,0 +1,168 @@
+package zfstools
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+
+	"zfstools-go/internal/config"
+	"zfstools-go/internal/zfs"
+)
+
+func TestParseRetentionPolicy(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		want    RetentionPolicy
+		wantErr error
+		value   string
+	}{
+		{
+			value: "hourly=24,daily=30,monthly=12,yearly=5",
+			want:  RetentionPolicy{"hourly": 24, "daily": 30, "monthly": 12, "yearly": 5},
+		},
+		{value: "weekly=4, daily=7", want: RetentionPolicy{"weekly": 4, "daily": 7}},
+		{value: "hourly=0", wantErr: ErrEmptyPolicy},
+		{value: "fortnightly=2", wantErr: ErrInvalidPolicy},
+		{value: "daily", wantErr: ErrInvalidPolicy},
+		{value: "daily=-1", wantErr: ErrInvalidPolicy},
+		{value: "", wantErr: ErrInvalidPolicy},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.value, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ParseRetentionPolicy(testCase.value)
+			if !errors.Is(err, testCase.wantErr) {
+				t.Fatalf("ParseRetentionPolicy() error = %v, want %v", err, testCase.wantErr)
+			}
+
+			if diff := deep.Equal(got, testCase.want); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestApplyRetentionPolicy(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// three days of hourly snapshots, oldest first, and one which couldn't be dated
+	retentions := []Retention{{Snapshot: zfs.Snapshot{Name: "tank@zfs-auto-snap_manual"}}}
+
+	for hour := range 72 {
+		taken := start.Add(time.Duration(hour) * time.Hour)
+		retentions = append(retentions, Retention{
+			Taken:    taken,
+			Snapshot: zfs.Snapshot{Name: "tank@zfs-auto-snap_hourly-" + taken.Format(snapshotFormat()) + "U"},
+		})
+	}
+
+	got := map[string][]string{}
+
+	for _, retention := range ApplyRetentionPolicy(RetentionPolicy{"hourly": 3, "daily": 2}, retentions) {
+		if retention.Keep() {
+			got[retention.Snapshot.Name] = retention.Reasons
+		}
+	}
+
+	want := map[string][]string{
+		"tank@zfs-auto-snap_hourly-2025-01-03-23h00U": {"hourly 2025-01-03 23h", "daily 2025-01-03"},
+		"tank@zfs-auto-snap_hourly-2025-01-03-22h00U": {"hourly 2025-01-03 22h"},
+		"tank@zfs-auto-snap_hourly-2025-01-03-21h00U": {"hourly 2025-01-03 21h"},
+		"tank@zfs-auto-snap_hourly-2025-01-02-23h00U": {"daily 2025-01-02"},
+		"tank@zfs-auto-snap_manual":                   {"unknown age"},
+	}
+
+	if diff := deep.Equal(got, want); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestPruneSnapshots(t *testing.T) {
+	t.Parallel()
+
+	fake := newScenario(t)
+	client := zfs.NewClient(fake)
+	start := time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)
+
+	// a month of hourlies and of dailies alongside them, the hourlies thin out into one a day
+	for hour := range 31 * 24 {
+		taken := start.Add(time.Duration(hour) * time.Hour)
+
+		names := []string{"tank/data@zfs-auto-snap_hourly-" + taken.Format(snapshotFormat()) + "U"}
+		if taken.Hour() == 0 {
+			names = append(names, "tank/data@zfs-auto-snap_daily-"+taken.Format(snapshotFormat())+"U")
+		}
+
+		// tank/scratch is excluded, its snapshots are left alone
+		if hour <= 24 {
+			names = append(names, "tank/scratch@zfs-auto-snap_hourly-"+taken.Format(snapshotFormat())+"U")
+		}
+
+		for _, name := range names {
+			err := fake.AddSnapshot(name, 1024)
+			if err != nil {
+				t.Fatalf("setting up fake: %v", err)
+			}
+		}
+	}
+
+	// a held snapshot which would otherwise be destroyed is left alone
+	old := "tank/data@zfs-auto-snap_hourly-" + start.Format(snapshotFormat()) + "U"
+
+	for _, err := range []error{
+		fake.AddSnapshot("tank/data@manual", 0),
+		fake.Hold(old, "zfs-replicate"),
+	} {
+		if err != nil {
+			t.Fatalf("setting up fake: %v", err)
+		}
+	}
+
+	cfg := config.Config{Timestamp: start.AddDate(0, 1, 0)}
+
+	retentions, err := PruneSnapshots(t.Context(), client, cfg, "", RetentionPolicy{"hourly": 24, "daily": 7})
+	if err != nil {
+		t.Fatalf("PruneSnapshots() error = %v", err)
+	}
+
+	if len(retentions) != 31*24+31-1 {
+		t.Errorf("PruneSnapshots() decided about %d snapshots, want %d", len(retentions), 31*24+31-1)
+	}
+
+	snaps := fake.Snapshots("tank/data")
+
+	// the newest 24 hourlies, the newest snapshot of the six days before those, the held one and the one it doesn't
+	// manage
+	if len(snaps) != 24+6+2 {
+		t.Fatalf("tank/data has %d snapshots, want %d: %v", len(snaps), 24+6+2, snaps)
+	}
+
+	// a deferred destroy of the held snapshot would happen once it is released
+	err = fake.Release(old, "zfs-replicate")
+	if err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+
+	if !fake.Exists(old) {
+		t.Errorf("%s was destroyed while held", old)
+	}
+
+	if len(fake.Snapshots("tank/scratch")) != 25 {
+		t.Errorf("snapshots of excluded tank/scratch were destroyed: %v", fake.Snapshots("tank/scratch"))
+	}
+
+	for day := 25; day < 31; day++ {
+		want := fmt.Sprintf("tank/data@zfs-auto-snap_hourly-2024-12-%02d-23h00U", day)
+		if !fake.Exists(want) {
+			t.Errorf("%s was destroyed, it is the newest snapshot of its day", want)
+		}
+	}
+}
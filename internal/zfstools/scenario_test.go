@@ -0,0 +1,1021 @@
+package zfstools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+
+	"zfstools-go/internal/config"
+	"zfstools-go/internal/report"
+	"zfstools-go/internal/zfs"
+	"zfstools-go/internal/zfsfake"
+)
+
+// newScenario returns a fake with a pool holding one snapshotted and one excluded filesystem
+func newScenario(t *testing.T) *zfsfake.ZFS {
+	t.Helper()
+
+	fake := zfsfake.New()
+
+	for _, err := range []error{
+		fake.AddPool("tank", "bookmarks"),
+		fake.AddFilesystem("tank/data", map[string]string{"com.sun:auto-snapshot": "true"}),
+		fake.AddFilesystem("tank/data/db", nil),
+		fake.AddFilesystem("tank/scratch", map[string]string{"com.sun:auto-snapshot": "false"}),
+	} {
+		if err != nil {
+			t.Fatalf("setting up fake: %v", err)
+		}
+	}
+
+	return fake
+}
+
+// autoSnapshot does what one zfs-auto-snapshot run does
+func autoSnapshot(t *testing.T, client *zfs.Client, cfg config.Config) {
+	t.Helper()
+
+	datasets, err := FindEligibleDatasets(t.Context(), client, cfg, "")
+	if err != nil {
+		t.Fatalf("FindEligibleDatasets() error = %v", err)
+	}
+
+	if cfg.Keep > 0 || cfg.KeepAge > 0 {
+		err = DoNewSnapshots(t.Context(), client, cfg, datasets)
+		if err != nil {
+			t.Fatalf("DoNewSnapshots() error = %v", err)
+		}
+	}
+
+	err = CleanupExpiredSnapshots(t.Context(), client, cfg, "", datasets)
+	if err != nil {
+		t.Fatalf("CleanupExpiredSnapshots() error = %v", err)
+	}
+}
+
+func TestScenario_HourlyRotation(t *testing.T) {
+	t.Parallel()
+
+	fake := newScenario(t)
+	client := zfs.NewClient(fake)
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for hour := range 25 {
+		cfg := config.Config{
+			Timestamp:              start.Add(time.Duration(hour) * time.Hour),
+			Interval:               "hourly",
+			Keep:                   24,
+			UseUTC:                 true,
+			ShouldDestroyZeroSized: true,
+		}
+
+		autoSnapshot(t, client, cfg)
+
+		// keep every snapshot from being zero-sized
+		for _, name := range []string{"tank/data", "tank/data/db"} {
+			err := fake.Write(name, 1024)
+			if err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+		}
+	}
+
+	for _, name := range []string{"tank/data", "tank/data/db"} {
+		snaps := fake.Snapshots(name)
+		if len(snaps) != 24 {
+			t.Fatalf("%s has %d snapshots, want 24", name, len(snaps))
+		}
+
+		if snaps[0] != name+"@zfs-auto-snap_hourly-2025-01-01-01h00U" {
+			t.Errorf("oldest snapshot of %s is %s, the first one should have rotated out", name, snaps[0])
+		}
+	}
+
+	if len(fake.Snapshots("tank/scratch")) != 0 {
+		t.Errorf("excluded dataset was snapshotted")
+	}
+}
+
+func TestScenario_ZeroSizedSnapshots(t *testing.T) {
+	t.Parallel()
+
+	fake := newScenario(t)
+	client := zfs.NewClient(fake)
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for minute := 0; minute < 60; minute += 15 {
+		cfg := config.Config{
+			Timestamp:              start.Add(time.Duration(minute) * time.Minute),
+			Interval:               "frequent",
+			Keep:                   4,
+			ShouldDestroyZeroSized: true,
+		}
+
+		autoSnapshot(t, client, cfg)
+	}
+
+	// nothing was ever written, so each run destroys all but the snapshot it just created
+	snaps := fake.Snapshots("tank/data")
+	if len(snaps) != 1 || !strings.HasSuffix(snaps[0], "-00h45") {
+		t.Errorf("unexpected snapshots %v", snaps)
+	}
+}
+
+func TestScenario_DryRun(t *testing.T) {
+	t.Parallel()
+
+	fake := newScenario(t)
+	client := zfs.NewClient(fake)
+
+	cfg := config.Config{
+		Timestamp: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		Interval:  "daily",
+		Keep:      7,
+		DryRun:    true,
+	}
+
+	autoSnapshot(t, client, cfg)
+
+	if len(fake.Snapshots("tank/data")) != 0 {
+		t.Errorf("dry run created snapshots")
+	}
+}
+
+func TestScenario_Failures(t *testing.T) {
+	t.Parallel()
+
+	fake := newScenario(t)
+	client := zfs.NewClient(fake)
+
+	for _, err := range []error{
+		fake.AddFilesystem("tank/other", map[string]string{"com.sun:auto-snapshot": "true"}),
+		// a leftover snapshot with the name about to be used makes creating it fail
+		fake.AddSnapshot("tank/other@zfs-auto-snap_daily-2025-01-01-00h00", 1024),
+		fake.SetPoolProperty("tank", "feature@bookmarks", ""),
+	} {
+		if err != nil {
+			t.Fatalf("setting up fake: %v", err)
+		}
+	}
+
+	cfg := config.Config{
+		Timestamp: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		Interval:  "daily",
+		Keep:      7,
+	}
+
+	datasets, err := FindEligibleDatasets(t.Context(), client, cfg, "")
+	if err != nil {
+		t.Fatalf("FindEligibleDatasets() error = %v", err)
+	}
+
+	err = DoNewSnapshots(t.Context(), client, cfg, datasets)
+	if err == nil || !strings.Contains(err.Error(), "tank/other@zfs-auto-snap_daily-2025-01-01-00h00") {
+		t.Errorf("DoNewSnapshots() error = %v, want one naming the failed snapshot", err)
+	}
+
+	// the other dataset was still snapshotted
+	if len(fake.Snapshots("tank/data")) != 1 {
+		t.Errorf("snapshot of tank/data was not created")
+	}
+}
+
+func TestScenario_ListFailure(t *testing.T) {
+	t.Parallel()
+
+	client := zfs.NewClient(zfsfake.New())
+
+	cfg := config.Config{Interval: "daily", Keep: 7}
+
+	_, err := FindEligibleDatasets(t.Context(), client, cfg, "missing")
+	if err == nil || !strings.Contains(err.Error(), "dataset does not exist") {
+		t.Errorf("FindEligibleDatasets() error = %v, want the zfs error", err)
+	}
+
+	err = CleanupExpiredSnapshots(t.Context(), client, cfg, "missing", nil)
+	if err == nil {
+		t.Errorf("CleanupExpiredSnapshots() error = nil, want an error")
+	}
+}
+
+// recordingReporter keeps the type, snapshot (or dataset) and bytes of each event reported
+type recordingReporter struct {
+	events []string
+	mutex  sync.Mutex
+}
+
+func (r *recordingReporter) Report(event report.Event) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	name := event.Snapshot
+	if name == "" {
+		name = event.Dataset
+	}
+
+	r.events = append(r.events, strings.Join([]string{event.Type, name, strconv.FormatInt(event.Bytes, 10)}, " "))
+}
+
+func TestScenario_Events(t *testing.T) {
+	t.Parallel()
+
+	fake := newScenario(t)
+	client := zfs.NewClient(fake)
+
+	for _, err := range []error{
+		fake.AddFilesystem("tank/other", map[string]string{"com.sun:auto-snapshot": "true"}),
+		fake.SetPoolProperty("tank", "feature@bookmarks", ""),
+	} {
+		if err != nil {
+			t.Fatalf("setting up fake: %v", err)
+		}
+	}
+
+	cfg := config.Config{
+		Timestamp: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		Interval:  "daily",
+		Keep:      1,
+	}
+
+	autoSnapshot(t, client, cfg)
+
+	for _, err := range []error{
+		fake.Write("tank/data", 1024),
+		fake.Write("tank/data/db", 2048),
+		fake.Write("tank/other", 4096),
+		// a leftover snapshot with the name about to be used makes creating it fail
+		fake.AddSnapshot("tank/other@zfs-auto-snap_daily-2025-01-02-00h00", 0),
+	} {
+		if err != nil {
+			t.Fatalf("setting up fake: %v", err)
+		}
+	}
+
+	reporter := &recordingReporter{}
+	cfg.Timestamp = cfg.Timestamp.AddDate(0, 0, 1)
+	cfg.Reporter = reporter
+
+	datasets, err := FindEligibleDatasets(t.Context(), client, cfg, "")
+	if err != nil {
+		t.Fatalf("FindEligibleDatasets() error = %v", err)
+	}
+
+	_ = DoNewSnapshots(t.Context(), client, cfg, datasets)
+
+	err = CleanupExpiredSnapshots(t.Context(), client, cfg, "", datasets)
+	if err != nil {
+		t.Fatalf("CleanupExpiredSnapshots() error = %v", err)
+	}
+
+	slices.Sort(reporter.events)
+
+	want := []string{
+		"dataset_excluded tank/scratch 0",
+		"error tank/other@zfs-auto-snap_daily-2025-01-02-00h00 0",
+		"snapshot_created tank/data@zfs-auto-snap_daily-2025-01-02-00h00 0",
+		"snapshot_destroyed tank/data/db@zfs-auto-snap_daily-2025-01-01-00h00 2048",
+		"snapshot_destroyed tank/data@zfs-auto-snap_daily-2025-01-01-00h00 1024",
+		"snapshot_destroyed tank/other@zfs-auto-snap_daily-2025-01-01-00h00 4096",
+	}
+
+	if diff := deep.Equal(reporter.events, want); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestScenario_AgeRetention(t *testing.T) {
+	t.Parallel()
+
+	fake := newScenario(t)
+	client := zfs.NewClient(fake)
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for hour := range 73 {
+		cfg := config.Config{
+			Timestamp:              start.Add(time.Duration(hour) * time.Hour),
+			Interval:               "hourly",
+			KeepAge:                36 * time.Hour,
+			UseUTC:                 true,
+			ShouldDestroyZeroSized: true,
+		}
+
+		autoSnapshot(t, client, cfg)
+
+		err := fake.Write("tank/data", 1024)
+		if err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+
+	snaps := fake.Snapshots("tank/data")
+
+	// 36 hours back from the last run at hour 72, inclusive
+	if len(snaps) != 37 {
+		t.Fatalf("tank/data has %d snapshots, want 37: %v", len(snaps), snaps)
+	}
+
+	if snaps[0] != "tank/data@zfs-auto-snap_hourly-2025-01-02-12h00U" {
+		t.Errorf("oldest snapshot is %s, want the one taken 36 hours before the last run", snaps[0])
+	}
+}
+
+func TestScenario_KeepProperty(t *testing.T) {
+	t.Parallel()
+
+	fake := newScenario(t)
+	client := zfs.NewClient(fake)
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, err := range []error{
+		fake.SetProperty("tank/data", "com.sun:auto-snapshot-keep:hourly", "2"),
+		fake.SetProperty("tank/data/db", "com.sun:auto-snapshot-keep:hourly", "6h"),
+		fake.AddFilesystem("tank/other", map[string]string{
+			"com.sun:auto-snapshot":             "true",
+			"com.sun:auto-snapshot-keep:hourly": "lots",
+		}),
+		// other intervals' settings don't matter
+		fake.AddFilesystem("tank/logs", map[string]string{
+			"com.sun:auto-snapshot":            "true",
+			"com.sun:auto-snapshot-keep:daily": "1",
+		}),
+	} {
+		if err != nil {
+			t.Fatalf("setting up fake: %v", err)
+		}
+	}
+
+	for hour := range 10 {
+		cfg := config.Config{
+			Timestamp: start.Add(time.Duration(hour) * time.Hour),
+			Interval:  "hourly",
+			Keep:      24,
+			UseUTC:    true,
+		}
+
+		datasets, err := FindEligibleDatasets(t.Context(), client, cfg, "")
+		if err != nil {
+			t.Fatalf("FindEligibleDatasets() error = %v", err)
+		}
+
+		err = DoNewSnapshots(t.Context(), client, cfg, datasets)
+		if err != nil {
+			t.Fatalf("DoNewSnapshots() error = %v", err)
+		}
+
+		err = CleanupExpiredSnapshots(t.Context(), client, cfg, "", datasets)
+		if err == nil || !strings.Contains(err.Error(), "tank/other") {
+			t.Fatalf("CleanupExpiredSnapshots() error = %v, want one about tank/other", err)
+		}
+	}
+
+	want := map[string]int{
+		"tank/data":    2,
+		"tank/data/db": 7,
+		"tank/other":   10,
+		"tank/logs":    10,
+	}
+
+	for name, count := range want {
+		if got := len(fake.Snapshots(name)); got != count {
+			t.Errorf("%s has %d snapshots, want %d", name, got, count)
+		}
+	}
+}
+
+// countingCoordinator counts the snapshots taken through it
+type countingCoordinator struct {
+	snapshots int
+}
+
+func (c *countingCoordinator) Snapshot(
+	ctx context.Context,
+	take func(ctx context.Context) error,
+) (map[string]string, error) {
+	c.snapshots++
+
+	return nil, take(ctx)
+}
+
+func TestScenario_DatasetTree(t *testing.T) {
+	t.Parallel()
+
+	fake := newScenario(t)
+	client := zfs.NewClient(fake)
+	mysql := &countingCoordinator{}
+	client.SetCoordinator("mysql", mysql)
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// the tree is snapshot whatever its properties say
+	err := fake.SetProperty("tank/data/db", "com.sun:auto-snapshot", "false")
+	if err != nil {
+		t.Fatalf("setting up fake: %v", err)
+	}
+
+	for hour := range 3 {
+		cfg := config.Config{
+			Timestamp: start.Add(time.Duration(hour) * time.Hour),
+			Interval:  "hourly",
+			Keep:      2,
+			UseUTC:    true,
+		}
+
+		datasets, err := FindDatasetTree(t.Context(), client, cfg, "tank/data", "mysql", true)
+		if err != nil {
+			t.Fatalf("FindDatasetTree() error = %v", err)
+		}
+
+		err = DoNewSnapshots(t.Context(), client, cfg, datasets)
+		if err != nil {
+			t.Fatalf("DoNewSnapshots() error = %v", err)
+		}
+
+		err = CleanupExpiredSnapshots(t.Context(), client, cfg, "tank/data", datasets)
+		if err != nil {
+			t.Fatalf("CleanupExpiredSnapshots() error = %v", err)
+		}
+	}
+
+	if mysql.snapshots != 3 {
+		t.Errorf("took %d snapshots through the coordinator, want 3", mysql.snapshots)
+	}
+
+	for _, name := range []string{"tank/data", "tank/data/db"} {
+		want := []string{name + "@zfs-auto-snap_hourly-2025-01-01-01h00U", name + "@zfs-auto-snap_hourly-2025-01-01-02h00U"}
+		if diff := deep.Equal(fake.Snapshots(name), want); diff != nil {
+			t.Errorf("%s: %v", name, diff)
+		}
+	}
+}
+
+func TestScenario_DatasetTreeNotRecursive(t *testing.T) {
+	t.Parallel()
+
+	fake := newScenario(t)
+	client := zfs.NewClient(fake)
+	mysql := &countingCoordinator{}
+	client.SetCoordinator("mysql", mysql)
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// the snapshot of the dataset below, taken by someone else, is left alone
+	err := fake.AddSnapshot("tank/data/db@zfs-auto-snap_hourly-2024-12-31-23h00U", 1024)
+	if err != nil {
+		t.Fatalf("setting up fake: %v", err)
+	}
+
+	for hour := range 3 {
+		cfg := config.Config{
+			Timestamp: start.Add(time.Duration(hour) * time.Hour),
+			Interval:  "hourly",
+			Keep:      2,
+			UseUTC:    true,
+		}
+
+		datasets, err := FindDatasetTree(t.Context(), client, cfg, "tank/data", "mysql", false)
+		if err != nil {
+			t.Fatalf("FindDatasetTree() error = %v", err)
+		}
+
+		err = DoNewSnapshots(t.Context(), client, cfg, datasets)
+		if err != nil {
+			t.Fatalf("DoNewSnapshots() error = %v", err)
+		}
+
+		err = CleanupExpiredSnapshots(t.Context(), client, cfg, "tank/data", datasets)
+		if err != nil {
+			t.Fatalf("CleanupExpiredSnapshots() error = %v", err)
+		}
+	}
+
+	if mysql.snapshots != 3 {
+		t.Errorf("took %d snapshots through the coordinator, want 3", mysql.snapshots)
+	}
+
+	want := []string{
+		"tank/data@zfs-auto-snap_hourly-2025-01-01-01h00U",
+		"tank/data@zfs-auto-snap_hourly-2025-01-01-02h00U",
+	}
+	if diff := deep.Equal(fake.Snapshots("tank/data"), want); diff != nil {
+		t.Error(diff)
+	}
+
+	want = []string{"tank/data/db@zfs-auto-snap_hourly-2024-12-31-23h00U"}
+	if diff := deep.Equal(fake.Snapshots("tank/data/db"), want); diff != nil {
+		t.Errorf("tank/data/db: %v", diff)
+	}
+}
+
+func TestScenario_CleanupZeroSized(t *testing.T) {
+	t.Parallel()
+
+	fake := newScenario(t)
+	client := zfs.NewClient(fake)
+
+	for _, err := range []error{
+		fake.AddSnapshot("tank/data@manual", 0),
+		fake.AddSnapshot("tank/data@pinned", 0),
+		fake.AddSnapshot("tank/data@written", 1024),
+		fake.AddSnapshot("tank/data@zfs-auto-snap_hourly-2025-01-01-00h00U", 0),
+		fake.AddSnapshot("tank/data@newest", 0),
+		fake.Hold("tank/data@pinned", "zfs-snapshot-hold"),
+	} {
+		if err != nil {
+			t.Fatalf("setting up fake: %v", err)
+		}
+	}
+
+	cfg := config.Config{SnapshotPrefix: "zfs-auto-snap"}
+
+	err := CleanupZeroSizedSnapshots(t.Context(), client, cfg, "")
+	if err != nil {
+		t.Fatalf("CleanupZeroSizedSnapshots() error = %v", err)
+	}
+
+	// a deferred destroy of the held snapshot would happen once it is released
+	err = fake.Release("tank/data@pinned", "zfs-snapshot-hold")
+	if err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+
+	// the newest snapshot is always kept
+	want := []string{
+		"tank/data@pinned",
+		"tank/data@written",
+		"tank/data@zfs-auto-snap_hourly-2025-01-01-00h00U",
+		"tank/data@newest",
+	}
+	if diff := deep.Equal(fake.Snapshots("tank/data"), want); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestScenario_Bookmarks(t *testing.T) {
+	t.Parallel()
+
+	fake := newScenario(t)
+	client := zfs.NewClient(fake)
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for hour := range 6 {
+		cfg := config.Config{
+			Timestamp:     start.Add(time.Duration(hour) * time.Hour),
+			Interval:      "hourly",
+			Keep:          2,
+			KeepBookmarks: 3,
+			UseUTC:        true,
+			Bookmark:      true,
+		}
+
+		autoSnapshot(t, client, cfg)
+	}
+
+	want := []string{
+		"tank/data#zfs-auto-snap_hourly-2025-01-01-01h00U",
+		"tank/data#zfs-auto-snap_hourly-2025-01-01-02h00U",
+		"tank/data#zfs-auto-snap_hourly-2025-01-01-03h00U",
+	}
+
+	diff := deep.Equal(fake.Bookmarks("tank/data"), want)
+	if diff != nil {
+		t.Errorf("compare failed: %v", diff)
+	}
+
+	if len(fake.Snapshots("tank/data")) != 2 {
+		t.Errorf("snapshots %v, want the newest 2", fake.Snapshots("tank/data"))
+	}
+
+	// without bookmarks, expired snapshots are kept rather than destroyed unbookmarked
+	err := fake.SetPoolProperty("tank", "feature@bookmarks", "")
+	if err != nil {
+		t.Fatalf("SetPoolProperty() error = %v", err)
+	}
+
+	client = zfs.NewClient(fake)
+	cfg := config.Config{
+		Timestamp: start.Add(6 * time.Hour),
+		Interval:  "hourly",
+		Keep:      2,
+		UseUTC:    true,
+		Bookmark:  true,
+	}
+
+	datasets, err := FindEligibleDatasets(t.Context(), client, cfg, "")
+	if err != nil {
+		t.Fatalf("FindEligibleDatasets() error = %v", err)
+	}
+
+	err = DoNewSnapshots(t.Context(), client, cfg, datasets)
+	if err != nil {
+		t.Fatalf("DoNewSnapshots() error = %v", err)
+	}
+
+	err = CleanupExpiredSnapshots(t.Context(), client, cfg, "", datasets)
+	if !errors.Is(err, ErrBookmarksUnsupported) {
+		t.Errorf("CleanupExpiredSnapshots() error = %v, want %v", err, ErrBookmarksUnsupported)
+	}
+
+	if len(fake.Snapshots("tank/data")) != 3 {
+		t.Errorf("snapshots %v, want the expired one kept", fake.Snapshots("tank/data"))
+	}
+}
+
+func TestScenario_Holds(t *testing.T) {
+	t.Parallel()
+
+	fake := newScenario(t)
+	client := zfs.NewClient(fake)
+	reporter := &recordingReporter{}
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	name := func(hour int) string {
+		return fmt.Sprintf("tank/data@zfs-auto-snap_hourly-2025-01-01-%02dh00U", hour)
+	}
+
+	for hour := range 5 {
+		cfg := config.Config{
+			Timestamp: start.Add(time.Duration(hour) * time.Hour),
+			Interval:  "hourly",
+			Keep:      2,
+			UseUTC:    true,
+			Reporter:  reporter,
+		}
+
+		autoSnapshot(t, client, cfg)
+
+		if hour != 1 {
+			continue
+		}
+
+		err := HoldSnapshots(t.Context(), client, cfg, "pinned", []string{name(0)}, time.Time{})
+		if err != nil {
+			t.Fatalf("HoldSnapshots() error = %v", err)
+		}
+
+		err = HoldSnapshots(t.Context(), client, cfg, "audit", []string{name(1)}, start.Add(210*time.Minute))
+		if err != nil {
+			t.Fatalf("HoldSnapshots() error = %v", err)
+		}
+	}
+
+	// held snapshots don't count towards KEEP, until the hold expires
+	want := []string{name(0), name(3), name(4)}
+
+	diff := deep.Equal(fake.Snapshots("tank/data"), want)
+	if diff != nil {
+		t.Errorf("compare failed: %v", diff)
+	}
+
+	if !slices.Contains(reporter.events, "snapshot_held "+name(1)+" 0") {
+		t.Errorf("holding %s was not reported in %v", name(1), reporter.events)
+	}
+
+	expiries, err := client.HoldExpiries(t.Context(), name(1), false)
+	if err == nil {
+		t.Errorf("%s still exists with expiries %v", name(1), expiries)
+	}
+}
+
+func TestScenario_MixedPools(t *testing.T) {
+	t.Parallel()
+
+	fake := newScenario(t)
+
+	for _, err := range []error{
+		fake.AddFilesystem("tank/home", map[string]string{"com.sun:auto-snapshot": "true"}),
+		fake.AddPool("old"),
+		fake.AddFilesystem("old/data", map[string]string{"com.sun:auto-snapshot": "true"}),
+		fake.AddFilesystem("old/logs", map[string]string{"com.sun:auto-snapshot": "true"}),
+	} {
+		if err != nil {
+			t.Fatalf("setting up fake: %v", err)
+		}
+	}
+
+	client := zfs.NewClient(fake)
+	cfg := config.Config{
+		Timestamp: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		Interval:  "hourly",
+		Keep:      1,
+		UseUTC:    true,
+	}
+
+	autoSnapshot(t, client, cfg)
+
+	// only the pool with feature@bookmarks takes several snapshots at once
+	snap := "@zfs-auto-snap_hourly-2025-01-01-00h00U"
+	want := [][]string{
+		{"-r", "tank/data" + snap, "tank/home" + snap},
+		{"-r", "old/data" + snap},
+		{"-r", "old/logs" + snap},
+	}
+
+	diff := deep.Equal(snapshotCommands(fake), want)
+	if diff != nil {
+		t.Errorf("compare failed: %v", diff)
+	}
+}
+
+func TestScenario_ConfigFile(t *testing.T) {
+	t.Parallel()
+
+	fake := newScenario(t)
+
+	for _, err := range []error{
+		fake.AddPool("backup"),
+		fake.AddFilesystem("backup/home", nil),
+		fake.AddFilesystem("backup/home/cache", nil),
+		fake.AddFilesystem("backup/tmp", nil),
+		// the property wins over the include pattern
+		fake.AddFilesystem("backup/keep", map[string]string{"com.sun:auto-snapshot": "false"}),
+	} {
+		if err != nil {
+			t.Fatalf("setting up fake: %v", err)
+		}
+	}
+
+	client := zfs.NewClient(fake)
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for hour := range 4 {
+		autoSnapshot(t, client, config.Config{
+			Timestamp: start.Add(time.Duration(hour) * time.Hour),
+			Interval:  "hourly",
+			Keep:      3,
+			UseUTC:    true,
+			PoolKeep:  map[string]map[string]string{"backup": {"hourly": "2", "daily": "7"}},
+			Include:   []string{"backup"},
+			Exclude:   []string{"tank/data/db", "backup/*/cache"},
+		})
+	}
+
+	want := map[string]int{
+		"tank/data":         3,
+		"tank/data/db":      0,
+		"tank/scratch":      0,
+		"backup":            2,
+		"backup/home":       2,
+		"backup/home/cache": 0,
+		"backup/tmp":        2,
+		"backup/keep":       0,
+	}
+
+	for name, count := range want {
+		if got := len(fake.Snapshots(name)); got != count {
+			t.Errorf("%s has %d snapshots, want %d", name, got, count)
+		}
+	}
+}
+
+func TestScenario_Parallelism(t *testing.T) {
+	t.Parallel()
+
+	fake := newScenario(t)
+
+	for _, err := range []error{
+		fake.AddFilesystem("tank/home", map[string]string{"com.sun:auto-snapshot": "true"}),
+		fake.AddPool("old"),
+	} {
+		if err != nil {
+			t.Fatalf("setting up fake: %v", err)
+		}
+	}
+
+	for i := range 6 {
+		err := fake.AddFilesystem(fmt.Sprintf("old/fs%d", i), map[string]string{"com.sun:auto-snapshot": "true"})
+		if err != nil {
+			t.Fatalf("setting up fake: %v", err)
+		}
+	}
+
+	client := zfs.NewClient(fake)
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for hour := range 5 {
+		autoSnapshot(t, client, config.Config{
+			Timestamp:              start.Add(time.Duration(hour) * time.Hour),
+			Interval:               "hourly",
+			Keep:                   2,
+			UseUTC:                 true,
+			ShouldDestroyZeroSized: true,
+			Parallelism:            4,
+		})
+	}
+
+	// the snapshots are never written to, so all but the newest zero-sized one are destroyed too
+	for _, name := range []string{"tank/data", "tank/data/db", "tank/home", "old/fs0", "old/fs5"} {
+		want := []string{name + "@zfs-auto-snap_hourly-2025-01-01-04h00U"}
+		if diff := deep.Equal(fake.Snapshots(name), want); diff != nil {
+			t.Errorf("%s: %v", name, diff)
+		}
+	}
+}
+
+func TestScenario_BatchedDestroy(t *testing.T) {
+	t.Parallel()
+
+	fake := newScenario(t)
+	client := zfs.NewClient(fake)
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for hour := range 6 {
+		keep := 24
+		if hour == 5 {
+			keep = 2
+		}
+
+		autoSnapshot(t, client, config.Config{
+			Timestamp: start.Add(time.Duration(hour) * time.Hour),
+			Interval:  "hourly",
+			Keep:      keep,
+			UseUTC:    true,
+		})
+	}
+
+	// the last run expires four snapshots of each dataset, and destroys them at once
+	var destroys [][]string
+
+	for _, command := range fake.Commands() {
+		if command[0] == "zfs" && command[1] == "destroy" {
+			destroys = append(destroys, command[1:])
+		}
+	}
+
+	var want [][]string
+
+	for _, name := range []string{"tank/data", "tank/data/db"} {
+		want = append(want, []string{"destroy", "-d", name + "@zfs-auto-snap_hourly-2025-01-01-03h00U," +
+			"zfs-auto-snap_hourly-2025-01-01-02h00U,zfs-auto-snap_hourly-2025-01-01-01h00U," +
+			"zfs-auto-snap_hourly-2025-01-01-00h00U"})
+
+		if len(fake.Snapshots(name)) != 2 {
+			t.Errorf("%s has snapshots %v, want the newest 2", name, fake.Snapshots(name))
+		}
+	}
+
+	if diff := deep.Equal(destroys, want); diff != nil {
+		t.Error(diff)
+	}
+}
+
+// snapshotCommands returns the snapshots taken by each zfs snapshot command run by fake
+func snapshotCommands(fake *zfsfake.ZFS) [][]string {
+	var commands [][]string
+
+	for _, command := range fake.Commands() {
+		if len(command) > 1 && command[0] == "zfs" && command[1] == "snapshot" {
+			commands = append(commands, command[2:])
+		}
+	}
+
+	return commands
+}
+
+func TestScenario_ConsistencyGroups(t *testing.T) {
+	t.Parallel()
+
+	snap := "@zfs-auto-snap_hourly-2025-01-01-00h00U"
+	group := map[string]string{"com.sun:auto-snapshot": "true", zfs.GroupProperty: "app"}
+
+	tests := []struct {
+		name    string
+		setup   func(fake *zfsfake.ZFS) error
+		argMax  int
+		wantErr error
+		want    [][]string
+	}{
+		{
+			name:   "recursive",
+			argMax: 262144,
+			want: [][]string{
+				{"-r", "old/app" + snap},
+				{"-r", "tank/data" + snap, "tank/logs" + snap},
+				{"-r", "tank/web" + snap},
+			},
+		},
+		{
+			name: "singleAndRecursive",
+			setup: func(fake *zfsfake.ZFS) error {
+				return fake.AddFilesystem("tank/data/tmp", map[string]string{"com.sun:auto-snapshot": "false"})
+			},
+			argMax: 262144,
+			want: [][]string{
+				{"tank/data" + snap, "tank/data/db" + snap, "tank/logs" + snap},
+				{"-r", "old/app" + snap},
+				{"-r", "tank/web" + snap},
+			},
+		},
+		{
+			name:    "tooLarge",
+			argMax:  1060,
+			wantErr: zfs.ErrGroupNotAtomic,
+			want: [][]string{
+				{"-r", "old/app" + snap},
+				{"-r", "tank/web" + snap},
+			},
+		},
+		{
+			name: "longerThanOneArgument",
+			setup: func(fake *zfsfake.ZFS) error {
+				// within ARG_MAX but, together, longer than the longest single argument
+				for i := range 1000 {
+					name := fmt.Sprintf("tank/app-%03d-%s", i, strings.Repeat("x", 128))
+
+					err := fake.AddFilesystem(name, group)
+					if err != nil {
+						return err
+					}
+				}
+
+				return nil
+			},
+			argMax:  4 * 1024 * 1024,
+			wantErr: zfs.ErrGroupNotAtomic,
+			want: [][]string{
+				{"-r", "old/app" + snap},
+				{"-r", "tank/web" + snap},
+			},
+		},
+		{
+			name: "noMultiSnap",
+			setup: func(fake *zfsfake.ZFS) error {
+				return fake.SetPoolProperty("tank", "feature@bookmarks", "")
+			},
+			argMax:  262144,
+			wantErr: zfs.ErrGroupNotAtomic,
+			want: [][]string{
+				{"-r", "old/app" + snap},
+				{"-r", "tank/web" + snap},
+			},
+		},
+		{
+			name: "database",
+			setup: func(fake *zfsfake.ZFS) error {
+				return fake.SetProperty("tank/logs", "com.sun:auto-snapshot", "mysql")
+			},
+			argMax:  262144,
+			wantErr: zfs.ErrGroupNotAtomic,
+			want: [][]string{
+				{"-r", "old/app" + snap},
+				{"-r", "tank/web" + snap},
+			},
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			fake := newScenario(t)
+
+			for _, err := range []error{
+				fake.SetProperty("tank/data", zfs.GroupProperty, "app"),
+				fake.AddFilesystem("tank/logs", group),
+				fake.AddFilesystem("tank/web", map[string]string{"com.sun:auto-snapshot": "true"}),
+				fake.AddPool("old"),
+				fake.AddFilesystem("old/app", group),
+			} {
+				if err != nil {
+					t.Fatalf("setting up fake: %v", err)
+				}
+			}
+
+			if testCase.setup != nil {
+				err := testCase.setup(fake)
+				if err != nil {
+					t.Fatalf("setting up fake: %v", err)
+				}
+			}
+
+			fake.SetArgMax(testCase.argMax)
+
+			client := zfs.NewClient(fake)
+			cfg := config.Config{
+				Timestamp: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+				Interval:  "hourly",
+				Keep:      1,
+				UseUTC:    true,
+			}
+
+			datasets, err := FindEligibleDatasets(t.Context(), client, cfg, "")
+			if err != nil {
+				t.Fatalf("FindEligibleDatasets() error = %v", err)
+			}
+
+			err = DoNewSnapshots(t.Context(), client, cfg, datasets)
+			if !errors.Is(err, testCase.wantErr) {
+				t.Errorf("DoNewSnapshots() error = %v, want %v", err, testCase.wantErr)
+			}
+
+			diff := deep.Equal(snapshotCommands(fake), testCase.want)
+			if diff != nil {
+				t.Errorf("compare failed: %v", diff)
+			}
+		})
+	}
+}
@@ -1,11 +1,18 @@
 package zfstools
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"maps"
+	"path"
+	"slices"
 	"strings"
 	"sync"
+	"time"
 
 	"zfstools-go/internal/config"
+	"zfstools-go/internal/report"
 	"zfstools-go/internal/zfs"
 )
 
@@ -13,6 +20,11 @@ func snapshotProperty() string {
 	return "com.sun:auto-snapshot"
 }
 
+// keepProperty is the user property which overrides KEEP for the interval on a dataset and those below it
+func keepProperty(cfg config.Config) string {
+	return snapshotProperty() + "-keep:" + cfg.Interval
+}
+
 func snapshotPrefix(cfg config.Config) string {
 	if cfg.SnapshotPrefix != "" {
 		return cfg.SnapshotPrefix
@@ -40,6 +52,145 @@ func snapshotName(cfg config.Config) string {
 	return snapshotPrefixInterval(cfg) + timestamp.Format(snapshotFormat())
 }
 
+// snapshotTime returns when the snapshot was taken, from the timestamp in its name (of any interval) or, failing
+// that, its creation property
+func snapshotTime(ctx context.Context, client *zfs.Client, cfg config.Config, snap *zfs.Snapshot) (time.Time, error) {
+	_, name, _ := strings.Cut(snap.Name, "@")
+
+	if strings.HasPrefix(name, snapshotPrefix(cfg)+"_") {
+		location := time.Local
+
+		if utc, ok := strings.CutSuffix(name, "U"); ok {
+			name = utc
+			location = time.UTC
+		}
+
+		if len(name) >= len(snapshotFormat()) {
+			taken, err := time.ParseInLocation(snapshotFormat(), name[len(name)-len(snapshotFormat()):], location)
+			if err == nil {
+				return taken, nil
+			}
+		}
+	}
+
+	return snap.GetCreation(ctx, client, cfg.Debug) //nolint:wrapcheck
+}
+
+// datasetKeep returns cfg with Keep and KeepAge set by the dataset's keep property, or else, when KEEP wasn't given,
+// that of its pool in cfg.PoolKeep, when it has one
+func datasetKeep(cfg config.Config, dataset zfs.Dataset) (config.Config, error) {
+	value, ok := dataset.Properties[keepProperty(cfg)]
+	if !ok && !cfg.KeepGiven {
+		value, ok = cfg.PoolKeep[zfs.PoolName(dataset.Name)][cfg.Interval]
+	}
+
+	if !ok {
+		return cfg, nil
+	}
+
+	keep, age, err := config.ParseKeep(value)
+	if err != nil {
+		return cfg, fmt.Errorf("error in %s of %s: %w", keepProperty(cfg), dataset.Name, err)
+	}
+
+	cfg.Keep = keep
+	cfg.KeepAge = age
+
+	return cfg, nil
+}
+
+// expiredSnapshots returns which of a dataset's snapshots, newest first, are beyond the newest cfg.Keep or, with
+// cfg.KeepAge, were taken more than cfg.KeepAge before cfg.Timestamp. The newest is always kept under cfg.KeepAge, so
+// that a dataset whose snapshots stopped, or a run long after the last, doesn't lose all of them.
+func expiredSnapshots(ctx context.Context, client *zfs.Client, cfg config.Config, snaps []zfs.Snapshot) []zfs.Snapshot {
+	if cfg.KeepAge <= 0 {
+		if len(snaps) > cfg.Keep {
+			return snaps[cfg.Keep:]
+		}
+
+		return nil
+	}
+
+	cutoff := cfg.Timestamp.Add(-cfg.KeepAge)
+
+	var expired []zfs.Snapshot
+
+	for _, snap := range snaps[min(len(snaps), 1):] {
+		taken, err := snapshotTime(ctx, client, cfg, &snap)
+
+		// a snapshot of unknown age is kept
+		if err == nil && taken.Before(cutoff) {
+			expired = append(expired, snap)
+		}
+	}
+
+	return expired
+}
+
+// notify sends event, for the interval being run, to cfg.Reporter when there is one
+func notify(cfg config.Config, event report.Event) {
+	if cfg.Reporter == nil {
+		return
+	}
+
+	event.Interval = cfg.Interval
+	event.DryRun = cfg.DryRun
+
+	cfg.Reporter.Report(event)
+}
+
+// ReportFailures sends a failure event to cfg.Reporter, when there is one, for each of the errors joined into err
+func ReportFailures(cfg config.Config, err error) {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok { //nolint:errorlint
+		for _, e := range joined.Unwrap() {
+			ReportFailures(cfg, e)
+		}
+
+		return
+	}
+
+	if err == nil {
+		return
+	}
+
+	var snapErr *zfs.SnapshotError
+	if !errors.As(err, &snapErr) {
+		notify(cfg, report.Event{Type: report.Failure, Error: err.Error()})
+
+		return
+	}
+
+	for _, snapshot := range snapErr.Snapshots {
+		dataset, _, _ := strings.Cut(snapshot, "@")
+
+		notify(cfg, report.Event{Type: report.Failure, Dataset: dataset, Snapshot: snapshot, Error: err.Error()})
+	}
+}
+
+// failedSnapshots returns the names of the snapshots which err reports could not be created or destroyed
+func failedSnapshots(err error) map[string]bool {
+	failed := map[string]bool{}
+
+	if joined, ok := err.(interface{ Unwrap() []error }); ok { //nolint:errorlint
+		for _, e := range joined.Unwrap() {
+			for name := range failedSnapshots(e) {
+				failed[name] = true
+			}
+		}
+
+		return failed
+	}
+
+	var snapErr *zfs.SnapshotError
+	if errors.As(err, &snapErr) {
+		for _, name := range snapErr.Snapshots {
+			failed[name] = true
+		}
+	}
+
+	return failed
+}
+
 // filterDatasets does the filtering work for FindEligibleDatasets
 func filterDatasets(datasets []zfs.Dataset, included, excluded *[]zfs.Dataset, prop string) {
 	all := append([]zfs.Dataset{}, *included...)
@@ -71,6 +222,52 @@ func filterDatasets(datasets []zfs.Dataset, included, excluded *[]zfs.Dataset, p
 	}
 }
 
+// matchesDataset reports whether any of patterns matches the dataset name or one of those above it
+func matchesDataset(patterns []string, name string) bool {
+	for {
+		for _, pattern := range patterns {
+			if matched, _ := path.Match(pattern, name); matched {
+				return true
+			}
+		}
+
+		parent := name[:max(strings.LastIndex(name, "/"), 0)]
+		if parent == "" {
+			return false
+		}
+
+		name = parent
+	}
+}
+
+// configureDatasets sets the properties of the datasets which cfg.Include and cfg.Exclude decide, and the hooks of
+// those which have none but cfg.Hooks has one of them or of one above them
+func configureDatasets(cfg config.Config, datasets []zfs.Dataset) {
+	for i := range datasets {
+		dataset := &datasets[i]
+
+		switch {
+		case matchesDataset(cfg.Exclude, dataset.Name):
+			dataset.Properties[snapshotProperty()+":"+cfg.Interval] = "false"
+		case dataset.Properties[snapshotProperty()+":"+cfg.Interval] == "" &&
+			dataset.Properties[snapshotProperty()] == "" && matchesDataset(cfg.Include, dataset.Name):
+			dataset.Properties[snapshotProperty()] = "true"
+		}
+
+		if len(dataset.Hooks) > 0 || len(cfg.Hooks) == 0 {
+			continue
+		}
+
+		for name := dataset.Name; name != ""; name = name[:max(strings.LastIndex(name, "/"), 0)] {
+			if hook, ok := cfg.Hooks[name]; ok {
+				dataset.Hooks = []zfs.Hook{{Path: hook, Dataset: dataset.Name}}
+
+				break
+			}
+		}
+	}
+}
+
 // findRecursiveDatasets helps FindEligibleDatasets decide which datasets can be snapshot recursively
 //
 //nolint:gocognit,cyclop
@@ -143,9 +340,16 @@ func findRecursiveDatasets(datasets map[string][]zfs.Dataset) map[string][]zfs.D
 	for i := range cleanedRecursive {
 		parent := &cleanedRecursive[i]
 		for _, d := range all {
-			if strings.HasPrefix(d.Name, parent.Name+"/") && d.DB != "" {
+			if !strings.HasPrefix(d.Name, parent.Name+"/") {
+				continue
+			}
+
+			if d.DB != "" {
 				parent.DB = d.DB
 			}
+
+			// the recursive snapshot is of the descendants too, so their hooks are run around it
+			parent.Hooks = zfs.AddHooks(parent.Hooks, d.Hooks)
 		}
 	}
 
@@ -157,19 +361,32 @@ func findRecursiveDatasets(datasets map[string][]zfs.Dataset) map[string][]zfs.D
 	}
 }
 
-// FindEligibleDatasets returns datasets eligible for snapshotting, groups into 4 groups:
-// - single: datasets which cannot be snapshot recursively and must be done individually
-// - recursive: datasets which can be snapshot recursively, since all snapshots below them are eligible as well
-// - included: datasets which were included in one of those two lists
-// - excluded: datasets which were excluded from both of those lists
-func FindEligibleDatasets(cfg config.Config, pool string) map[string][]zfs.Dataset {
+// selectDatasets returns the datasets of pool which are snapshot for cfg.Interval, going by their properties and
+// cfg.Include and cfg.Exclude, and those which are excluded
+func selectDatasets(
+	ctx context.Context,
+	client *zfs.Client,
+	cfg config.Config,
+	pool string,
+) ([]zfs.Dataset, []zfs.Dataset, error) {
 	props := []string{
 		snapshotProperty() + ":" + cfg.Interval,
 		snapshotProperty(),
 		"mounted",
+		keepProperty(cfg),
+		zfs.HookProperty,
+		zfs.GroupProperty,
+	}
+
+	all, err := client.ListDatasets(ctx, pool, props, cfg.Debug)
+	if err != nil {
+		err = fmt.Errorf("error finding eligible datasets: %w", err)
+		ReportFailures(cfg, err)
+
+		return nil, nil, err
 	}
 
-	all := zfs.ListDatasets(pool, props, cfg.Debug)
+	configureDatasets(cfg, all)
 
 	var included []zfs.Dataset
 
@@ -178,17 +395,294 @@ func FindEligibleDatasets(cfg config.Config, pool string) map[string][]zfs.Datas
 	filterDatasets(all, &included, &excluded, snapshotProperty()+":"+cfg.Interval)
 	filterDatasets(all, &included, &excluded, snapshotProperty())
 
-	return findRecursiveDatasets(map[string][]zfs.Dataset{
+	return included, excluded, nil
+}
+
+// FindEligibleDatasets returns datasets eligible for snapshotting, groups into 4 groups:
+// - single: datasets which cannot be snapshot recursively and must be done individually
+// - recursive: datasets which can be snapshot recursively, since all snapshots below them are eligible as well
+// - included: datasets which were included in one of those two lists
+// - excluded: datasets which were excluded from both of those lists
+func FindEligibleDatasets(
+	ctx context.Context,
+	client *zfs.Client,
+	cfg config.Config,
+	pool string,
+) (map[string][]zfs.Dataset, error) {
+	included, excluded, err := selectDatasets(ctx, client, cfg, pool)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dataset := range excluded {
+		notify(cfg, report.Event{Type: report.DatasetExcluded, Dataset: dataset.Name})
+	}
+
+	datasets := findRecursiveDatasets(map[string][]zfs.Dataset{
 		"included": included,
 		"excluded": excluded,
 	})
+	mergeGroups(datasets)
+
+	return datasets, nil
+}
+
+// mergeGroups moves the recursive datasets of consistency groups which have single datasets in the same pool too,
+// along with their descendants, to the single ones. A command takes its snapshots either all recursively or not at
+// all, so this way each group is still taken by one.
+func mergeGroups(datasets map[string][]zfs.Dataset) {
+	hasSingle := map[[2]string]bool{}
+
+	for _, dataset := range datasets["single"] {
+		if dataset.Group != "" {
+			hasSingle[[2]string{zfs.PoolName(dataset.Name), dataset.Group}] = true
+		}
+	}
+
+	var recursive []zfs.Dataset
+
+	for _, dataset := range datasets["recursive"] {
+		if dataset.Group == "" || !hasSingle[[2]string{zfs.PoolName(dataset.Name), dataset.Group}] {
+			recursive = append(recursive, dataset)
+
+			continue
+		}
+
+		datasets["single"] = append(datasets["single"], dataset)
+
+		for _, descendant := range datasets["included"] {
+			if strings.HasPrefix(descendant.Name, dataset.Name+"/") {
+				// taken along with dataset, whatever its own group
+				descendant.Group = dataset.Group
+				datasets["single"] = append(datasets["single"], descendant)
+			}
+		}
+	}
+
+	datasets["recursive"] = recursive
 }
 
-// DoNewSnapshots creates the single and recursive snapshots
-func DoNewSnapshots(cfg config.Config, datasets map[string][]zfs.Dataset) {
+// FindDatasetTree returns the dataset name and those below it, grouped like FindEligibleDatasets, to be snapshot
+// with the database db whatever their com.sun:auto-snapshot properties say. Without recursive only name itself is
+// snapshot, those below it are excluded.
+func FindDatasetTree(
+	ctx context.Context,
+	client *zfs.Client,
+	cfg config.Config,
+	name, db string,
+	recursive bool,
+) (map[string][]zfs.Dataset, error) {
+	all, err := client.ListDatasets(ctx, name, []string{keepProperty(cfg), zfs.HookProperty}, cfg.Debug)
+	if err != nil {
+		err = fmt.Errorf("error finding datasets: %w", err)
+		ReportFailures(cfg, err)
+
+		return nil, err
+	}
+
+	if !recursive {
+		var root, below []zfs.Dataset
+
+		for _, dataset := range all {
+			if dataset.Name == name {
+				dataset.DB = db
+				root = append(root, dataset)
+			} else {
+				below = append(below, dataset)
+			}
+		}
+
+		return map[string][]zfs.Dataset{"single": root, "included": root, "excluded": below}, nil
+	}
+
+	datasets := findRecursiveDatasets(map[string][]zfs.Dataset{"included": all})
+
+	for i := range datasets["recursive"] {
+		datasets["recursive"][i].DB = db
+	}
+
+	return datasets, nil
+}
+
+// DoNewSnapshots creates the single and recursive snapshots, returning the joined errors of those which failed
+func DoNewSnapshots(
+	ctx context.Context,
+	client *zfs.Client,
+	cfg config.Config,
+	datasets map[string][]zfs.Dataset,
+) error {
 	name := snapshotName(cfg)
-	_ = createManySnapshotsFn(name, datasets["single"], false, cfg.DryRun, cfg.Verbose, cfg.Debug, cfg.UseThreads)
-	_ = createManySnapshotsFn(name, datasets["recursive"], true, cfg.DryRun, cfg.Verbose, cfg.Debug, cfg.UseThreads)
+
+	var errs []error
+
+	for _, group := range []string{"single", "recursive"} {
+		if len(datasets[group]) == 0 {
+			continue
+		}
+
+		start := time.Now()
+
+		err := client.CreateManySnapshots(ctx, name, datasets[group], group == "recursive",
+			cfg.DryRun, cfg.Verbose, cfg.Debug, cfg.Parallelism)
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		// the snapshots of a group are created together, so they share its duration
+		duration := time.Since(start)
+		failed := failedSnapshots(err)
+
+		for _, dataset := range datasets[group] {
+			if !failed[dataset.Name+"@"+name] {
+				notify(cfg, report.Event{
+					Type:     report.SnapshotCreated,
+					Dataset:  dataset.Name,
+					Snapshot: dataset.Name + "@" + name,
+					Duration: duration,
+				})
+			}
+		}
+
+		ReportFailures(cfg, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// destroySnapshotsTogether destroys the snapshots with one call of destroy, bookmarking them first with cfg.Bookmark
+// and keeping those which can't be, rather than lose them as a base for incremental sends. Each is reported as an
+// event of eventType, and the joined errors of those which could not be destroyed are returned.
+func destroySnapshotsTogether(
+	ctx context.Context,
+	client *zfs.Client,
+	cfg config.Config,
+	snaps []zfs.Snapshot,
+	eventType string,
+	destroy func(names []string) error,
+) error {
+	var errs []error
+
+	var destroying []zfs.Snapshot
+
+	for _, snap := range snaps {
+		if ctx.Err() != nil {
+			break
+		}
+
+		if cfg.Bookmark {
+			err := bookmarkSnapshot(ctx, client, cfg, snap)
+			if err != nil {
+				ReportFailures(cfg, err)
+				errs = append(errs, err)
+
+				continue
+			}
+		}
+
+		destroying = append(destroying, snap)
+	}
+
+	if len(destroying) == 0 {
+		return errors.Join(errs...)
+	}
+
+	names := make([]string, 0, len(destroying))
+
+	for _, snap := range destroying {
+		names = append(names, snap.Name)
+	}
+
+	start := time.Now()
+
+	err := destroy(names)
+	if err != nil {
+		ReportFailures(cfg, err)
+		errs = append(errs, err)
+	}
+
+	// the snapshots are destroyed together, so they share the duration
+	duration := time.Since(start)
+	failed := failedSnapshots(err)
+
+	for _, snap := range destroying {
+		if failed[snap.Name] {
+			continue
+		}
+
+		dataset, _, _ := strings.Cut(snap.Name, "@")
+
+		notify(cfg, report.Event{
+			Type:     eventType,
+			Dataset:  dataset,
+			Snapshot: snap.Name,
+			Bytes:    snap.Used,
+			Duration: duration,
+		})
+	}
+
+	return errors.Join(errs...)
+}
+
+// destroySnapshots destroys the snapshots, those of each dataset together with as few zfs destroy commands as they
+// fit in, cfg.Parallelism datasets at a time on each pool or, in the pools which use them, with a channel program
+// each. Each is reported as an event of eventType, and the joined errors of those which could not be destroyed are
+// returned.
+func destroySnapshots(
+	ctx context.Context,
+	client *zfs.Client,
+	cfg config.Config,
+	snaps []zfs.Snapshot,
+	eventType string,
+) error {
+	var errsMutex sync.Mutex
+
+	var errs []error
+
+	pools := map[string][]zfs.Snapshot{}
+
+	for _, snap := range snaps {
+		pool := zfs.PoolName(snap.Name)
+		pools[pool] = append(pools[pool], snap)
+	}
+
+	datasets := map[string][]zfs.Snapshot{}
+
+	for _, pool := range slices.Sorted(maps.Keys(pools)) {
+		if !client.UsesChannelPrograms(ctx, pool, cfg.Debug) {
+			for _, snap := range pools[pool] {
+				dataset, _, _ := strings.Cut(snap.Name, "@")
+				datasets[dataset] = append(datasets[dataset], snap)
+			}
+
+			continue
+		}
+
+		program := func(names []string) error {
+			return client.DestroySnapshotsProgram(ctx, pool, names, cfg.DryRun, cfg.Debug)
+		}
+
+		errs = append(errs, destroySnapshotsTogether(ctx, client, cfg, pools[pool], eventType, program))
+	}
+
+	names := slices.Sorted(maps.Keys(datasets))
+
+	zfs.ForEachInPools(names, func(name string) string { return name }, cfg.Parallelism, func(name string) {
+		// don't start any more destroys once interrupted
+		if ctx.Err() != nil {
+			return
+		}
+
+		err := destroySnapshotsTogether(ctx, client, cfg, datasets[name], eventType, func(names []string) error {
+			return client.DestroySnapshots(ctx, names, cfg.DryRun, cfg.Debug)
+		})
+		if err != nil {
+			errsMutex.Lock()
+			errs = append(errs, err)
+			errsMutex.Unlock()
+		}
+	})
+
+	return errors.Join(errs...)
 }
 
 func GroupSnapshotsIntoDatasets(snaps []zfs.Snapshot, datasets []zfs.Dataset) map[string][]zfs.Snapshot {
@@ -213,55 +707,114 @@ func GroupSnapshotsIntoDatasets(snaps []zfs.Snapshot, datasets []zfs.Dataset) ma
 	return result
 }
 
-func destroyZeroSizedSnapshots(snaps []zfs.Snapshot, cfg config.Config) []zfs.Snapshot {
+// destroyZeroSizedSnapshots destroys the zero-sized snapshots other than the newest, together, and returns the
+// snapshots which remain, along with the joined errors of those which could not be destroyed
+func destroyZeroSizedSnapshots(
+	ctx context.Context,
+	client *zfs.Client,
+	snaps []zfs.Snapshot,
+	cfg config.Config,
+) ([]zfs.Snapshot, error) {
 	if len(snaps) == 0 {
-		return nil
+		return nil, nil
 	}
 
 	// retain the newest snapshot (first in list)
-	keep := []zfs.Snapshot{snaps[0]}
+	examined := []zfs.Snapshot{snaps[0]}
+
+	var zeroSized []zfs.Snapshot
 
 	for _, snap := range snaps[1:] {
-		if snap.IsZero(cfg.Debug) {
+		// stop destroying once interrupted, but keep what was not looked at
+		if ctx.Err() == nil && snap.IsZero(ctx, client, cfg.Debug) {
 			if cfg.Verbose {
 				fmt.Println("Destroying zero-sized snapshot:", snap.Name) //nolint:forbidigo
 			}
 
-			if !cfg.DryRun {
-				_ = destroySnapshotFn(snap.Name, cfg.DryRun, cfg.Debug)
-			}
-		} else {
-			keep = append(keep, snap)
+			zeroSized = append(zeroSized, snap)
 		}
+
+		examined = append(examined, snap)
 	}
 
-	return keep
-}
+	if len(zeroSized) == 0 || ctx.Err() != nil {
+		return examined, nil
+	}
 
-func DatasetsDestroyZeroSizedSnapshots(grouped map[string][]zfs.Snapshot, cfg config.Config) map[string][]zfs.Snapshot {
-	var waitGroup sync.WaitGroup
+	// DatasetsDestroyZeroSizedSnapshots already runs cfg.Parallelism of these at a time on each pool
+	serial := cfg
+	serial.Parallelism = 1
 
-	for name, snaps := range grouped {
-		waitGroup.Add(1)
+	err := destroySnapshots(ctx, client, serial, zeroSized, report.ZeroSizedDestroyed)
 
-		go func() {
-			grouped[name] = destroyZeroSizedSnapshots(snaps, cfg)
+	// once interrupted, which of them were destroyed isn't known, so they are all kept
+	if ctx.Err() != nil {
+		return examined, err
+	}
 
-			waitGroup.Done()
-		}()
+	failed := failedSnapshots(err)
+	destroyed := map[string]bool{}
 
-		if !cfg.UseThreads {
-			waitGroup.Wait()
-		}
+	for _, snap := range zeroSized {
+		destroyed[snap.Name] = !failed[snap.Name]
 	}
 
-	waitGroup.Wait()
+	keep := slices.DeleteFunc(examined, func(snap zfs.Snapshot) bool { return destroyed[snap.Name] })
 
-	return grouped
+	return keep, err
 }
 
-func CleanupExpiredSnapshots(cfg config.Config, pool string, datasets map[string][]zfs.Dataset) {
-	snaps, _ := zfs.ListSnapshotsFn(pool, true, cfg.Debug)
+// DatasetsDestroyZeroSizedSnapshots destroys the zero-sized snapshots of each dataset, see
+// destroyZeroSizedSnapshots
+func DatasetsDestroyZeroSizedSnapshots(
+	ctx context.Context,
+	client *zfs.Client,
+	grouped map[string][]zfs.Snapshot,
+	cfg config.Config,
+) (map[string][]zfs.Snapshot, error) {
+	var mutex sync.Mutex
+
+	var errs []error
+
+	result := make(map[string][]zfs.Snapshot, len(grouped))
+
+	names := slices.Sorted(maps.Keys(grouped))
+
+	zfs.ForEachInPools(names, func(name string) string { return name }, cfg.Parallelism, func(name string) {
+		keep, err := destroyZeroSizedSnapshots(ctx, client, grouped[name], cfg)
+
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		result[name] = keep
+
+		if err != nil {
+			errs = append(errs, err)
+		}
+	})
+
+	return result, errors.Join(errs...)
+}
+
+// CleanupExpiredSnapshots destroys the expired snapshots of the interval of each included dataset (see
+// expiredSnapshots), going by the dataset's keep property in place of cfg's KEEP when it has one, returning the
+// joined errors of those which could not be listed or destroyed. Held snapshots are skipped, once their expired
+// holds are released, and don't count towards KEEP. With cfg.KeepBookmarks the older bookmarks of the interval are
+// destroyed too.
+func CleanupExpiredSnapshots(
+	ctx context.Context,
+	client *zfs.Client,
+	cfg config.Config,
+	pool string,
+	datasets map[string][]zfs.Dataset,
+) error {
+	snaps, err := client.ListSnapshots(ctx, pool, true, cfg.Debug)
+	if err != nil {
+		err = fmt.Errorf("error cleaning up expired snapshots: %w", err)
+		ReportFailures(cfg, err)
+
+		return err
+	}
 
 	var filtered []zfs.Snapshot
 
@@ -275,55 +828,106 @@ func CleanupExpiredSnapshots(cfg config.Config, pool string, datasets map[string
 
 	grouped := GroupSnapshotsIntoDatasets(filtered, append(datasets["included"], datasets["excluded"]...))
 
-	// keep only datasets we include
-	for name := range grouped {
-		found := false
-
-		for _, ds := range datasets["included"] {
-			if ds.Name == name {
-				found = true
+	included := map[string]zfs.Dataset{}
 
-				break
-			}
-		}
+	for _, ds := range datasets["included"] {
+		included[ds.Name] = ds
+	}
 
-		if !found {
+	// keep only datasets we include
+	for name := range grouped {
+		if _, ok := included[name]; !ok {
 			delete(grouped, name)
 		}
 	}
 
+	var errs []error
+
+	// held snapshots are neither destroyed nor counted towards KEEP
+	err = skipHeldSnapshots(ctx, client, cfg, pool, grouped)
+	if err != nil {
+		ReportFailures(cfg, err)
+		errs = append(errs, err)
+	}
+
 	if cfg.ShouldDestroyZeroSized {
-		grouped = DatasetsDestroyZeroSizedSnapshots(grouped, cfg)
+		grouped, err = DatasetsDestroyZeroSizedSnapshots(ctx, client, grouped, cfg)
+		if err != nil {
+			errs = append(errs, err)
+		}
 	}
 
 	for name := range grouped {
-		snaps := grouped[name]
-		if len(snaps) > cfg.Keep {
-			grouped[name] = snaps[cfg.Keep:]
-		} else {
+		datasetCfg, err := datasetKeep(cfg, included[name])
+		if err != nil {
+			// rather than guess what was meant, leave its snapshots alone
+			ReportFailures(cfg, err)
+			errs = append(errs, err)
 			grouped[name] = nil
+
+			continue
 		}
+
+		grouped[name] = expiredSnapshots(ctx, client, datasetCfg, grouped[name])
 	}
 
-	var waitGroup sync.WaitGroup
+	var expired []zfs.Snapshot
 
 	for _, snaps := range grouped {
-		for _, snap := range snaps {
-			s := snap
+		expired = append(expired, snaps...)
+	}
+
+	errs = append(errs, destroySnapshots(ctx, client, cfg, expired, report.SnapshotDestroyed))
+	errs = append(errs, cleanupExpiredBookmarks(ctx, client, cfg, pool, included))
 
-			waitGroup.Add(1)
+	return errors.Join(errs...)
+}
 
-			go func() {
-				_ = destroySnapshotFn(s.Name, cfg.DryRun, cfg.Debug)
+// CleanupZeroSizedSnapshots destroys the zero-sized snapshots of pool, or of every pool when it is empty, which
+// weren't taken by zfs-auto-snapshot. Held snapshots are left alone, as a deferred destroy would take them away
+// once released. It returns the joined errors of those which could not be checked or destroyed.
+func CleanupZeroSizedSnapshots(ctx context.Context, client *zfs.Client, cfg config.Config, pool string) error {
+	snapshots, err := client.ListSnapshots(ctx, pool, true, cfg.Debug)
+	if err != nil {
+		err = fmt.Errorf("error listing snapshots: %w", err)
+		ReportFailures(cfg, err)
 
-				waitGroup.Done()
-			}()
+		return err
+	}
 
-			if !cfg.UseThreads {
-				waitGroup.Wait()
-			}
+	var filtered []zfs.Snapshot
+
+	prefix := cfg.SnapshotPrefix + "_"
+
+	for _, snap := range snapshots {
+		if !strings.Contains(snap.Name, prefix) && snap.IsZero(ctx, client, cfg.Debug) {
+			filtered = append(filtered, snap)
 		}
 	}
 
-	waitGroup.Wait()
+	if ctx.Err() != nil {
+		return context.Cause(ctx)
+	}
+
+	datasets, err := client.ListDatasets(ctx, pool, []string{}, cfg.Debug)
+	if err != nil {
+		err = fmt.Errorf("error listing datasets: %w", err)
+		ReportFailures(cfg, err)
+
+		return err
+	}
+
+	grouped := GroupSnapshotsIntoDatasets(filtered, datasets)
+
+	var errs []error
+
+	err = skipHeldSnapshots(ctx, client, cfg, pool, grouped)
+	if err != nil {
+		ReportFailures(cfg, err)
+		errs = append(errs, err)
+	}
+
+	_, err = DatasetsDestroyZeroSizedSnapshots(ctx, client, grouped, cfg)
+
+	return errors.Join(append(errs, err)...)
 }
@@ -1,8 +1,11 @@
 package zfstools
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -10,28 +13,60 @@ import (
 
 	"zfstools-go/internal/config"
 	"zfstools-go/internal/zfs"
+	"zfstools-go/internal/zfsfake"
 	"zfstools-go/internal/zfstoolstest"
 )
 
-var createdSnapshots []string
+// recordingExecutor records the commands it is asked to run and answers them all with the same output
+type recordingExecutor struct {
+	output   string
+	commands [][]string
+	mu       sync.Mutex
+}
 
-var destroyedSnapshots []string
+func (e *recordingExecutor) record(name string, args ...string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
 
-func init() {
-	createdSnapshots = nil
-	destroyedSnapshots = nil
-	createManySnapshotsFn = func(name string, datasets []zfs.Dataset, _, _, _, _, _ bool) error {
-		for _, ds := range datasets {
-			createdSnapshots = append(createdSnapshots, ds.Name+"@"+name)
-		}
+	e.commands = append(e.commands, append([]string{name}, args...))
+}
+
+func (e *recordingExecutor) Run(_ context.Context, name string, args ...string) error {
+	e.record(name, args...)
+
+	return nil
+}
+
+func (e *recordingExecutor) Output(_ context.Context, name string, args ...string) ([]byte, error) {
+	e.record(name, args...)
 
-		return nil
+	return []byte(e.output), nil
+}
+
+func (e *recordingExecutor) Stream(_ context.Context, onLine func(line string), name string, args ...string) error {
+	e.record(name, args...)
+
+	for line := range strings.Lines(e.output) {
+		onLine(strings.TrimSuffix(line, "\n"))
 	}
-	destroySnapshotFn = func(name string, _, _ bool) error {
-		destroyedSnapshots = append(destroyedSnapshots, name)
 
-		return nil
+	return nil
+}
+
+// ran returns the commands starting with name
+func (e *recordingExecutor) ran(name string) [][]string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var commands [][]string
+
+	for _, command := range e.commands {
+		if command[0] == name {
+			commands = append(commands, command)
+		}
 	}
+
+	return commands
 }
 
 func testConfig(interval string) config.Config {
@@ -43,14 +78,19 @@ func testConfig(interval string) config.Config {
 func TestDoNewSnapshots(t *testing.T) {
 	t.Parallel()
 
-	createdSnapshots = nil
+	executor := &recordingExecutor{}
 	cfg := testConfig("frequent")
 	datasets := map[string][]zfs.Dataset{
 		"single":    {{Name: "pool/fs1"}},
 		"recursive": {{Name: "pool/fs2"}},
 	}
-	DoNewSnapshots(cfg, datasets)
 
+	err := DoNewSnapshots(t.Context(), zfs.NewClient(executor), cfg, datasets)
+	if err != nil {
+		t.Errorf("DoNewSnapshots() error = %v", err)
+	}
+
+	createdSnapshots := executor.ran("zfs")
 	if len(createdSnapshots) != 2 {
 		t.Errorf("expected 2 snapshots, got %d", len(createdSnapshots))
 	}
@@ -619,9 +659,12 @@ func TestFindEligibleDatasets(t *testing.T) {
 
 	for _, testCase := range tests {
 		t.Run(testCase.name, func(t *testing.T) {
-			zfs.RunZfsFn = zfstoolstest.MakeFakeCommand(testCase.mockCmdFunc)
+			client := zfs.NewClient(zfs.CommandExecutor{CommandContext: zfstoolstest.MakeFakeCommand(testCase.mockCmdFunc)})
 
-			got := FindEligibleDatasets(testCase.args.cfg, testCase.args.pool)
+			got, err := FindEligibleDatasets(t.Context(), client, testCase.args.cfg, testCase.args.pool)
+			if err != nil {
+				t.Errorf("FindEligibleDatasets() error = %v", err)
+			}
 
 			diff := deep.Equal(got, testCase.want)
 			if diff != nil {
@@ -1226,6 +1269,54 @@ func Test_findRecursiveDatasets(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "gives a recursive dataset the hooks of its children",
+			args: args{
+				datasets: map[string][]zfs.Dataset{
+					"included": {
+						{
+							Name:  "tank/a",
+							Hooks: []zfs.Hook{{Path: "/hooks/vm", Dataset: "tank/a"}},
+						},
+						{
+							Name:  "tank/a/1",
+							Hooks: []zfs.Hook{{Path: "/hooks/vm", Dataset: "tank/a/1"}},
+						},
+						{
+							Name:  "tank/a/2",
+							Hooks: []zfs.Hook{{Path: "/hooks/redis", Dataset: "tank/a/2"}},
+						},
+					},
+				},
+			},
+			want: map[string][]zfs.Dataset{
+				"single": nil,
+				"recursive": {
+					{
+						Name: "tank/a",
+						Hooks: []zfs.Hook{
+							{Path: "/hooks/vm", Dataset: "tank/a"},
+							{Path: "/hooks/redis", Dataset: "tank/a/2"},
+						},
+					},
+				},
+				"included": {
+					{
+						Name:  "tank/a",
+						Hooks: []zfs.Hook{{Path: "/hooks/vm", Dataset: "tank/a"}},
+					},
+					{
+						Name:  "tank/a/1",
+						Hooks: []zfs.Hook{{Path: "/hooks/vm", Dataset: "tank/a/1"}},
+					},
+					{
+						Name:  "tank/a/2",
+						Hooks: []zfs.Hook{{Path: "/hooks/redis", Dataset: "tank/a/2"}},
+					},
+				},
+				"excluded": nil,
+			},
+		},
 	}
 
 	for _, testCase := range tests {
@@ -1240,6 +1331,68 @@ func Test_findRecursiveDatasets(t *testing.T) {
 	}
 }
 
+func Test_configureDatasets(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Config{
+		Interval: "hourly",
+		Include:  []string{"tank/home"},
+		Exclude:  []string{"tank/*/cache"},
+		Hooks:    map[string]string{"tank/db": "/hooks/flush", "tank/db/logs": "/hooks/logs"},
+	}
+
+	datasets := []zfs.Dataset{
+		{Name: "tank", Properties: map[string]string{}},
+		{Name: "tank/home", Properties: map[string]string{}},
+		{Name: "tank/home/alice", Properties: map[string]string{"com.sun:auto-snapshot": "false"}},
+		{Name: "tank/home/cache", Properties: map[string]string{"com.sun:auto-snapshot": "true"}},
+		{Name: "tank/db", Properties: map[string]string{}},
+		{Name: "tank/db/data", Properties: map[string]string{}},
+		{Name: "tank/db/logs", Properties: map[string]string{}},
+		{
+			Name:       "tank/db/own",
+			Properties: map[string]string{},
+			Hooks:      []zfs.Hook{{Path: "/hooks/own", Dataset: "tank/db/own"}},
+		},
+	}
+
+	configureDatasets(cfg, datasets)
+
+	want := []zfs.Dataset{
+		{Name: "tank", Properties: map[string]string{}},
+		{Name: "tank/home", Properties: map[string]string{"com.sun:auto-snapshot": "true"}},
+		{Name: "tank/home/alice", Properties: map[string]string{"com.sun:auto-snapshot": "false"}},
+		{Name: "tank/home/cache", Properties: map[string]string{
+			"com.sun:auto-snapshot":        "true",
+			"com.sun:auto-snapshot:hourly": "false",
+		}},
+		{
+			Name:       "tank/db",
+			Properties: map[string]string{},
+			Hooks:      []zfs.Hook{{Path: "/hooks/flush", Dataset: "tank/db"}},
+		},
+		{
+			Name:       "tank/db/data",
+			Properties: map[string]string{},
+			Hooks:      []zfs.Hook{{Path: "/hooks/flush", Dataset: "tank/db/data"}},
+		},
+		{
+			Name:       "tank/db/logs",
+			Properties: map[string]string{},
+			Hooks:      []zfs.Hook{{Path: "/hooks/logs", Dataset: "tank/db/logs"}},
+		},
+		{
+			Name:       "tank/db/own",
+			Properties: map[string]string{},
+			Hooks:      []zfs.Hook{{Path: "/hooks/own", Dataset: "tank/db/own"}},
+		},
+	}
+
+	if diff := deep.Equal(datasets, want); diff != nil {
+		t.Error(diff)
+	}
+}
+
 func Test_snapshotPrefix(t *testing.T) {
 	type args struct {
 		cfg config.Config
@@ -1362,6 +1515,197 @@ func Test_snapshotName(t *testing.T) {
 	}
 }
 
+func Test_snapshotTime(t *testing.T) {
+	t.Parallel()
+
+	created := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	fake := zfsfake.New()
+	fake.SetClock(func() time.Time { return created })
+
+	for _, err := range []error{
+		fake.AddPool("tank"),
+		fake.AddSnapshot("tank@manual", 0),
+	} {
+		if err != nil {
+			t.Fatalf("setting up fake: %v", err)
+		}
+	}
+
+	client := zfs.NewClient(fake)
+	cfg := config.Config{Interval: "hourly"}
+
+	tests := []struct {
+		want    time.Time
+		name    string
+		wantErr bool
+	}{
+		{
+			name: "tank@zfs-auto-snap_hourly-2025-05-05-17h45U",
+			want: time.Date(2025, 5, 5, 17, 45, 0, 0, time.UTC),
+		},
+		{
+			name: "tank@zfs-auto-snap_hourly-2025-05-05-17h45",
+			want: time.Date(2025, 5, 5, 17, 45, 0, 0, time.Local),
+		},
+		{
+			name: "tank@manual",
+			want: created,
+		},
+		{
+			name:    "tank@missing",
+			wantErr: true,
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := snapshotTime(t.Context(), client, cfg, &zfs.Snapshot{Name: testCase.name})
+			if (err != nil) != testCase.wantErr {
+				t.Fatalf("snapshotTime() error = %v, wantErr %v", err, testCase.wantErr)
+			}
+
+			if !got.Equal(testCase.want) {
+				t.Errorf("snapshotTime() = %v, want %v", got, testCase.want)
+			}
+		})
+	}
+}
+
+func Test_expiredSnapshots(t *testing.T) {
+	t.Parallel()
+
+	client := zfs.NewClient(zfsfake.New())
+	now := time.Date(2025, 1, 10, 0, 0, 0, 0, time.UTC)
+
+	snapshots := func(names ...string) []zfs.Snapshot {
+		var snaps []zfs.Snapshot
+
+		for _, name := range names {
+			snaps = append(snaps, zfs.Snapshot{Name: "tank@zfs-auto-snap_hourly-" + name})
+		}
+
+		return snaps
+	}
+
+	tests := []struct {
+		name  string
+		cfg   config.Config
+		snaps []zfs.Snapshot
+		want  []zfs.Snapshot
+	}{
+		{
+			name:  "count",
+			cfg:   config.Config{Keep: 2},
+			snaps: snapshots("2025-01-09-23h00U", "2025-01-09-22h00U", "2025-01-09-21h00U"),
+			want:  snapshots("2025-01-09-21h00U"),
+		},
+		{
+			name:  "age",
+			cfg:   config.Config{KeepAge: 90 * time.Minute},
+			snaps: snapshots("2025-01-09-23h00U", "2025-01-09-22h00U", "2025-01-09-21h00U"),
+			want:  snapshots("2025-01-09-22h00U", "2025-01-09-21h00U"),
+		},
+		{
+			name:  "age keeps the newest",
+			cfg:   config.Config{KeepAge: 36 * time.Hour},
+			snaps: snapshots("2025-01-02-23h00U", "2025-01-02-22h00U"),
+			want:  snapshots("2025-01-02-22h00U"),
+		},
+		{
+			name: "age without snapshots",
+			cfg:  config.Config{KeepAge: 36 * time.Hour},
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := testCase.cfg
+			cfg.Interval = "hourly"
+			cfg.Timestamp = now
+
+			got := expiredSnapshots(t.Context(), client, cfg, testCase.snaps)
+			if diff := deep.Equal(got, testCase.want); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func Test_datasetKeep(t *testing.T) {
+	t.Parallel()
+
+	poolKeep := map[string]map[string]string{"backup": {"hourly": "48"}}
+
+	tests := []struct {
+		name        string
+		cfg         config.Config
+		dataset     zfs.Dataset
+		wantKeep    int
+		wantKeepAge time.Duration
+	}{
+		{
+			name:     "fileKeep",
+			cfg:      config.Config{Keep: 24, PoolKeep: poolKeep},
+			dataset:  zfs.Dataset{Name: "tank/home"},
+			wantKeep: 24,
+		},
+		{
+			name:     "poolOverFileKeep",
+			cfg:      config.Config{Keep: 24, PoolKeep: poolKeep},
+			dataset:  zfs.Dataset{Name: "backup/home"},
+			wantKeep: 48,
+		},
+		{
+			name:     "argumentOverPool",
+			cfg:      config.Config{Keep: 12, KeepGiven: true, PoolKeep: poolKeep},
+			dataset:  zfs.Dataset{Name: "backup/home"},
+			wantKeep: 12,
+		},
+		{
+			name: "propertyOverArgument",
+			cfg:  config.Config{Keep: 12, KeepGiven: true, PoolKeep: poolKeep},
+			dataset: zfs.Dataset{
+				Name:       "backup/home",
+				Properties: map[string]string{"com.sun:auto-snapshot-keep:hourly": "7d"},
+			},
+			wantKeepAge: 7 * 24 * time.Hour,
+		},
+		{
+			name: "propertyOverPool",
+			cfg:  config.Config{Keep: 24, PoolKeep: poolKeep},
+			dataset: zfs.Dataset{
+				Name:       "backup/home",
+				Properties: map[string]string{"com.sun:auto-snapshot-keep:hourly": "6"},
+			},
+			wantKeep: 6,
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := testCase.cfg
+			cfg.Interval = "hourly"
+
+			got, err := datasetKeep(cfg, testCase.dataset)
+			if err != nil {
+				t.Fatalf("datasetKeep() error = %v", err)
+			}
+
+			if got.Keep != testCase.wantKeep || got.KeepAge != testCase.wantKeepAge {
+				t.Errorf("datasetKeep() = %d, %s, want %d, %s", got.Keep, got.KeepAge, testCase.wantKeep,
+					testCase.wantKeepAge)
+			}
+		})
+	}
+}
+
 //nolint:paralleltest
 func Test_destroyZeroSizedSnapshots(t *testing.T) {
 	type args struct {
@@ -1370,16 +1714,12 @@ func Test_destroyZeroSizedSnapshots(t *testing.T) {
 	}
 
 	tests := []struct {
-		mockDestroySnapshotFunc func(name string, dryRun bool, debug bool) error
-		name                    string
-		want                    []zfs.Snapshot
-		args                    args
+		name string
+		want []zfs.Snapshot
+		args args
 	}{
 		{
 			name: "zeroSnapshots",
-			mockDestroySnapshotFunc: func(_ string, _ bool, _ bool) error {
-				return nil
-			},
 			args: args{
 				snaps: nil,
 				cfg:   config.Config{},
@@ -1387,9 +1727,6 @@ func Test_destroyZeroSizedSnapshots(t *testing.T) {
 		},
 		{
 			name: "oneSnapshotNotZero",
-			mockDestroySnapshotFunc: func(_ string, _ bool, _ bool) error {
-				return nil
-			},
 			args: args{
 				snaps: []zfs.Snapshot{
 					{
@@ -1408,9 +1745,6 @@ func Test_destroyZeroSizedSnapshots(t *testing.T) {
 		},
 		{
 			name: "oneSnapshotZero",
-			mockDestroySnapshotFunc: func(_ string, _ bool, _ bool) error {
-				return nil
-			},
 			args: args{
 				snaps: []zfs.Snapshot{
 					{
@@ -1429,9 +1763,6 @@ func Test_destroyZeroSizedSnapshots(t *testing.T) {
 		},
 		{
 			name: "twoSnapshotsNeitherZero",
-			mockDestroySnapshotFunc: func(_ string, _ bool, _ bool) error {
-				return nil
-			},
 			args: args{
 				snaps: []zfs.Snapshot{
 					{
@@ -1458,9 +1789,6 @@ func Test_destroyZeroSizedSnapshots(t *testing.T) {
 		},
 		{
 			name: "twoSnapshotsFirstZero",
-			mockDestroySnapshotFunc: func(_ string, _ bool, _ bool) error {
-				return nil
-			},
 			args: args{
 				snaps: []zfs.Snapshot{
 					{
@@ -1483,9 +1811,6 @@ func Test_destroyZeroSizedSnapshots(t *testing.T) {
 		},
 		{
 			name: "twoSnapshotsSecondZero",
-			mockDestroySnapshotFunc: func(_ string, _ bool, _ bool) error {
-				return nil
-			},
 			args: args{
 				snaps: []zfs.Snapshot{
 					{
@@ -1510,13 +1835,46 @@ func Test_destroyZeroSizedSnapshots(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "neighboursZero",
+			args: args{
+				snaps: []zfs.Snapshot{
+					{
+						Name: "tank/a@4",
+						Used: 123456,
+					},
+					{
+						Name: "tank/a@3",
+						Used: 0,
+					},
+					{
+						Name: "tank/a@2",
+						Used: 0,
+					},
+					{
+						Name: "tank/a@1",
+						Used: 0,
+					},
+				},
+				cfg: config.Config{},
+			},
+			want: []zfs.Snapshot{
+				{
+					Name: "tank/a@4",
+					Used: 123456,
+				},
+			},
+		},
 	}
 
 	for _, testCase := range tests {
 		t.Run(testCase.name, func(t *testing.T) {
-			destroySnapshotFn = testCase.mockDestroySnapshotFunc
+			client := zfs.NewClient(&recordingExecutor{})
 
-			got := destroyZeroSizedSnapshots(testCase.args.snaps, testCase.args.cfg)
+			got, err := destroyZeroSizedSnapshots(t.Context(), client, testCase.args.snaps, testCase.args.cfg)
+			if err != nil {
+				t.Errorf("destroyZeroSizedSnapshots() error = %v", err)
+			}
 
 			diff := deep.Equal(got, testCase.want)
 			if diff != nil {
@@ -1526,6 +1884,30 @@ func Test_destroyZeroSizedSnapshots(t *testing.T) {
 	}
 }
 
+func Test_destroyZeroSizedSnapshots_interrupted(t *testing.T) {
+	t.Parallel()
+
+	executor := &recordingExecutor{}
+	client := zfs.NewClient(executor)
+	snaps := []zfs.Snapshot{{Name: "tank/a@3"}, {Name: "tank/a@2"}, {Name: "tank/a@1"}}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	got, err := destroyZeroSizedSnapshots(ctx, client, snaps, config.Config{})
+	if err != nil {
+		t.Errorf("destroyZeroSizedSnapshots() error = %v", err)
+	}
+
+	if diff := deep.Equal(got, snaps); diff != nil {
+		t.Errorf("destroyZeroSizedSnapshots() didn't keep the snapshots once interrupted: %v", diff)
+	}
+
+	if len(executor.ran("zfs")) != 0 {
+		t.Errorf("destroyZeroSizedSnapshots() ran %v once interrupted", executor.ran("zfs"))
+	}
+}
+
 // test helpers from here down
 
 //nolint:paralleltest
@@ -1543,7 +1925,8 @@ func TestFindEligibleDatasets_noExistingSnapshotsOneDataset(_ *testing.T) {
 		"-t",
 		"filesystem,volume",
 		"-o",
-		"name,type,com.sun:auto-snapshot:frequent,com.sun:auto-snapshot,mounted",
+		"name,type,com.sun:auto-snapshot:frequent,com.sun:auto-snapshot,mounted,com.sun:auto-snapshot-keep:frequent," +
+			"com.sun:auto-snapshot-hook,com.sun:auto-snapshot-group",
 		"-s",
 		"name",
 	}
@@ -1552,7 +1935,7 @@ func TestFindEligibleDatasets_noExistingSnapshotsOneDataset(_ *testing.T) {
 		os.Exit(1)
 	}
 
-	fmt.Printf("tank/fs1\tfilesystem\t-\ttrue\tyes\n") //nolint:forbidigo
+	fmt.Printf("tank/fs1\tfilesystem\t-\ttrue\tyes\t-\t-\n") //nolint:forbidigo
 
 	os.Exit(0)
 }
@@ -1572,7 +1955,8 @@ func TestFindEligibleDatasets_noExistingSnapshotsTwoDatasetsOneUnmounted(_ *test
 		"-t",
 		"filesystem,volume",
 		"-o",
-		"name,type,com.sun:auto-snapshot:frequent,com.sun:auto-snapshot,mounted",
+		"name,type,com.sun:auto-snapshot:frequent,com.sun:auto-snapshot,mounted,com.sun:auto-snapshot-keep:frequent," +
+			"com.sun:auto-snapshot-hook,com.sun:auto-snapshot-group",
 		"-s",
 		"name",
 	}
@@ -1581,8 +1965,8 @@ func TestFindEligibleDatasets_noExistingSnapshotsTwoDatasetsOneUnmounted(_ *test
 		os.Exit(1)
 	}
 
-	fmt.Printf("tank/fs1\tfilesystem\t-\ttrue\tyes\n") //nolint:forbidigo
-	fmt.Printf("tank/fs2\tfilesystem\t-\ttrue\tno\n")  //nolint:forbidigo
+	fmt.Printf("tank/fs1\tfilesystem\t-\ttrue\tyes\t-\t-\n") //nolint:forbidigo
+	fmt.Printf("tank/fs2\tfilesystem\t-\ttrue\tno\t-\t-\n")  //nolint:forbidigo
 
 	os.Exit(0)
 }
@@ -1602,7 +1986,8 @@ func TestFindEligibleDatasets_alreadyFound(_ *testing.T) {
 		"-t",
 		"filesystem,volume",
 		"-o",
-		"name,type,com.sun:auto-snapshot:frequent,com.sun:auto-snapshot,mounted",
+		"name,type,com.sun:auto-snapshot:frequent,com.sun:auto-snapshot,mounted,com.sun:auto-snapshot-keep:frequent," +
+			"com.sun:auto-snapshot-hook,com.sun:auto-snapshot-group",
 		"-s",
 		"name",
 	}
@@ -1611,8 +1996,8 @@ func TestFindEligibleDatasets_alreadyFound(_ *testing.T) {
 		os.Exit(1)
 	}
 
-	fmt.Printf("tank/fs1\tfilesystem\t-\ttrue\tyes\n")    //nolint:forbidigo
-	fmt.Printf("tank/fs2\tfilesystem\ttrue\ttrue\tyes\n") //nolint:forbidigo,dupword
+	fmt.Printf("tank/fs1\tfilesystem\t-\ttrue\tyes\t-\t-\n")    //nolint:forbidigo
+	fmt.Printf("tank/fs2\tfilesystem\ttrue\ttrue\tyes\t-\t-\n") //nolint:forbidigo,dupword
 
 	os.Exit(0)
 }
@@ -1632,7 +2017,8 @@ func TestFindEligibleDatasets_onlyFreq(_ *testing.T) {
 		"-t",
 		"filesystem,volume",
 		"-o",
-		"name,type,com.sun:auto-snapshot:frequent,com.sun:auto-snapshot,mounted",
+		"name,type,com.sun:auto-snapshot:frequent,com.sun:auto-snapshot,mounted,com.sun:auto-snapshot-keep:frequent," +
+			"com.sun:auto-snapshot-hook,com.sun:auto-snapshot-group",
 		"-s",
 		"name",
 	}
@@ -1641,10 +2027,10 @@ func TestFindEligibleDatasets_onlyFreq(_ *testing.T) {
 		os.Exit(1)
 	}
 
-	fmt.Printf("tank/fs1\tfilesystem\t-\ttrue\tyes\n")    //nolint:forbidigo
-	fmt.Printf("tank/fs2\tfilesystem\ttrue\ttrue\tyes\n") //nolint:forbidigo,dupword
-	fmt.Printf("tank/fs3\tfilesystem\ttrue\t-\tyes\n")    //nolint:forbidigo
-	fmt.Printf("tank/fs4\tfilesystem\t-\t-\tyes\n")       //nolint:forbidigo
+	fmt.Printf("tank/fs1\tfilesystem\t-\ttrue\tyes\t-\t-\n")    //nolint:forbidigo
+	fmt.Printf("tank/fs2\tfilesystem\ttrue\ttrue\tyes\t-\t-\n") //nolint:forbidigo,dupword
+	fmt.Printf("tank/fs3\tfilesystem\ttrue\t-\tyes\t-\t-\n")    //nolint:forbidigo
+	fmt.Printf("tank/fs4\tfilesystem\t-\t-\tyes\t-\t-\n")       //nolint:forbidigo
 
 	os.Exit(0)
 }
@@ -1664,7 +2050,8 @@ func TestFindEligibleDatasets_manyDatasets(_ *testing.T) {
 		"-t",
 		"filesystem,volume",
 		"-o",
-		"name,type,com.sun:auto-snapshot:frequent,com.sun:auto-snapshot,mounted",
+		"name,type,com.sun:auto-snapshot:frequent,com.sun:auto-snapshot,mounted,com.sun:auto-snapshot-keep:frequent," +
+			"com.sun:auto-snapshot-hook,com.sun:auto-snapshot-group",
 		"-s",
 		"name",
 		"-r",
@@ -1,6 +1,7 @@
 package zfstoolstest
 
 import (
+	"context"
 	"os"
 
 	exec "golang.org/x/sys/execabs"
@@ -11,12 +12,12 @@ func IsTestEnv() bool {
 	return os.Getenv("GO_WANT_HELPER_PROCESS") == "1"
 }
 
-// MakeFakeCommand returns the fake exec.Command() function for testing
-func MakeFakeCommand(mockFuncName string) func(command string, args ...string) *exec.Cmd {
-	return func(command string, args ...string) *exec.Cmd {
+// MakeFakeCommand returns the fake exec.CommandContext() function for testing
+func MakeFakeCommand(mockFuncName string) func(ctx context.Context, command string, args ...string) *exec.Cmd {
+	return func(ctx context.Context, command string, args ...string) *exec.Cmd {
 		mockArg := "-test.run=" + mockFuncName
 		cs := append([]string{mockArg, "--", command}, args...) // -test.run means the self mock function
-		cmd := exec.Command(os.Args[0], cs...)                  //nolint:gosec
+		cmd := exec.CommandContext(ctx, os.Args[0], cs...)      //nolint:gosec
 		cmd.Env = os.Environ()
 		cmd.Env = append(cmd.Env, "GO_WANT_HELPER_PROCESS=1")
 